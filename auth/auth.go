@@ -4,6 +4,9 @@ package auth
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	stdlibtime "time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/pkg/errors"
@@ -11,19 +14,86 @@ import (
 	"github.com/ice-blockchain/wintr/auth/internal"
 	firebaseauth "github.com/ice-blockchain/wintr/auth/internal/firebase"
 	iceauth "github.com/ice-blockchain/wintr/auth/internal/ice"
+	oidcauth "github.com/ice-blockchain/wintr/auth/internal/oidc"
+	appcfg "github.com/ice-blockchain/wintr/config"
+	"github.com/ice-blockchain/wintr/connectors/storage/v3"
+	"github.com/ice-blockchain/wintr/log"
 	"github.com/ice-blockchain/wintr/time"
+	"github.com/ice-blockchain/wintr/totp"
 )
 
-func New(ctx context.Context, applicationYAMLKey string) Client {
-	return &auth{
-		fb:  firebaseauth.New(ctx, applicationYAMLKey),
-		ice: iceauth.New(applicationYAMLKey),
+func New(ctx context.Context, applicationYAMLKey string, opts ...Option) Client {
+	var cfg config
+	appcfg.MustLoadFromKey(applicationYAMLKey, &cfg)
+	cfg.setOTPDefaults(applicationYAMLKey)
+	cfg.setMFADefaults()
+	cfg.setServiceDefaults(applicationYAMLKey)
+	a := &auth{
+		fb:   firebaseauth.New(ctx, applicationYAMLKey),
+		ice:  iceauth.New(applicationYAMLKey),
+		oidc: oidcauth.New(applicationYAMLKey),
+		cfg:  &cfg,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.revocationStore == nil && cfg.WintrAuthIce.Revocation.Enabled {
+		a.revocationStore = NewRedisRevocationStore(a.mustConnect(ctx, applicationYAMLKey))
+	}
+	if a.otpStore == nil && cfg.WintrAuthIce.OTP.Enabled {
+		a.otpStore = NewRedisOTPStore(a.mustConnect(ctx, applicationYAMLKey))
+	}
+	a.mustHaveOTPSecret()
+	if a.mfaStore == nil && cfg.WintrAuthIce.MFA.Enabled {
+		a.mfaStore = NewRedisMFAStore(a.mustConnect(ctx, applicationYAMLKey))
+	}
+	if a.mfaStore != nil {
+		a.totp = totp.New(applicationYAMLKey)
+	}
+	if a.revocationStore == nil {
+		log.Warn(fmt.Sprintf("revocation is disabled, so X-Account-Metadata tokens can't be revoked nor bound to a device, only expire after %v", a.metadataMaxAge()))
+	}
+
+	return a
+}
+
+// mustConnect connects to storage/v3 the first time it's called, so that all the stores enabled via the config share the same connection.
+func (a *auth) mustConnect(ctx context.Context, applicationYAMLKey string) storage.DB {
+	if a.db == nil {
+		a.db = storage.MustConnect(ctx, applicationYAMLKey)
+	}
+
+	return a.db
+}
+
+func (a *auth) Close() error {
+	if a.db == nil {
+		return nil
+	}
+
+	return errors.Wrap(a.db.Close(), "failed to close auth storage")
+}
+
+// WithRevocationStore makes ice tokens revocable, using the provided store, regardless of the config.
+func WithRevocationStore(store RevocationStore) Option {
+	return func(a *auth) {
+		a.revocationStore = store
 	}
 }
 
 func (a *auth) VerifyToken(ctx context.Context, token string) (*Token, error) {
 	var authToken *Token
+	if iceauth.DetectServiceToken(token) {
+		serviceToken, err := a.ice.VerifyServiceToken(token)
+
+		return serviceToken, errors.Wrapf(err, "can't verify service token:%v", token)
+	}
 	if _, err := iceauth.DetectIceToken(token); err != nil {
+		if a.oidc != nil && a.oidc.Detect(token) {
+			authToken, err = a.oidc.VerifyToken(ctx, token)
+
+			return authToken, errors.Wrapf(err, "can't verify oidc token:%v", token)
+		}
 		if a.fb == nil {
 			return nil, errors.Errorf("non-ice token, but firebase auth is disabled")
 		}
@@ -32,11 +102,21 @@ func (a *auth) VerifyToken(ctx context.Context, token string) (*Token, error) {
 		return authToken, errors.Wrapf(err, "can't verify fb token:%v", token)
 	}
 	authToken, err := a.ice.VerifyToken(token)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't verify ice token:%v", token)
+	}
+	if err = a.checkRevoked(ctx, token); err != nil {
+		return nil, errors.Wrapf(err, "can't verify ice token:%v", token)
+	}
 
-	return authToken, errors.Wrapf(err, "can't verify ice token:%v", token)
+	return authToken, nil
 }
 
 func (a *auth) ModifyTokenWithMetadata(token *Token, metadataStr string) (*Token, error) {
+	return a.ModifyTokenWithMetadataContext(context.Background(), token, metadataStr)
+}
+
+func (a *auth) ModifyTokenWithMetadataContext(ctx context.Context, token *Token, metadataStr string) (*Token, error) {
 	if metadataStr == "" {
 		return token, nil
 	}
@@ -50,6 +130,9 @@ func (a *auth) ModifyTokenWithMetadata(token *Token, metadataStr string) (*Token
 	if err := a.checkMetadataOwnership(token.UserID, metadata); err != nil {
 		return nil, errors.Wrapf(ErrWrongTypeToken, "token %v does not own metadata %#v", token.UserID, metadata)
 	}
+	if err := a.checkMetadataReplay(ctx, token, metadata); err != nil {
+		return nil, errors.Wrapf(err, "metadata %#v can't be used by token %v", metadata, token.UserID)
+	}
 	if userID := a.firstRegisteredUserID(metadata); userID != "" {
 		token.UserID = userID
 	}
@@ -68,6 +151,70 @@ func (*auth) checkMetadataOwnership(userID string, metadata jwt.MapClaims) error
 	return nil
 }
 
+// checkMetadataReplay makes sure the metadata isn't too old, that it wasn't revoked and that it's used only by the device it's bound to:
+// either the one it was issued for (its audience), or the first one that used it. Metadata without an id is rejected, unless revocation is disabled,
+// in which case all metadata is only checked for age.
+// Only ice tokens carry the device, so the metadata used with any other tokens (i.e. Firebase or OIDC ones) is not bound to a device.
+func (a *auth) checkMetadataReplay(ctx context.Context, token *Token, metadata jwt.MapClaims) error {
+	issuedAt, err := metadata.GetIssuedAt()
+	if err != nil || issuedAt == nil {
+		return errors.Wrap(ErrInvalidToken, "metadata has no iat")
+	}
+	if time.Now().Sub(issuedAt.Time) > a.metadataMaxAge() {
+		return errors.Wrapf(ErrExpiredToken, "metadata issued at %v is older than %v", issuedAt, a.metadataMaxAge())
+	}
+	deviceUniqueID, _ := token.Claims["deviceUniqueID"].(string) //nolint:errcheck,revive // Not needed.
+	bindsDevice := token.Provider == ProviderIce
+	audience, err := metadata.GetAudience()
+	if err != nil {
+		return errors.Wrap(ErrInvalidToken, "metadata has an invalid aud")
+	}
+	if bindsDevice && len(audience) != 0 && !slices.Contains(audience, deviceUniqueID) {
+		return errors.Wrapf(ErrMetadataReplayed, "metadata issued for %v used by %v", audience, deviceUniqueID)
+	}
+	if a.revocationStore == nil {
+		return nil
+	}
+	tokenID, _ := metadata["jti"].(string) //nolint:errcheck,revive // Not needed.
+	if tokenID == "" {
+		return errors.Wrap(ErrInvalidToken, "metadata has no jti")
+	}
+	userID, _ := metadata["sub"].(string) //nolint:errcheck,revive // Not needed.
+	revokedAt, err := a.revocationStore.RevokedAt(ctx, revokedMetadataKey(tokenID), revokedUserKey(userID))
+	if err != nil {
+		return errors.Wrapf(err, "failed to check if metadata %v was revoked", tokenID)
+	}
+	if revokedAt[0] != nil {
+		return errors.Wrapf(ErrRevokedToken, "metadata %v was revoked at %v", tokenID, revokedAt[0])
+	}
+	if revokedAt[1] != nil && !issuedAt.After(*revokedAt[1]) {
+		return errors.Wrapf(ErrRevokedToken, "metadata issued at %v, before user %v was revoked at %v", issuedAt, userID, revokedAt[1])
+	}
+	if !bindsDevice || len(audience) != 0 || deviceUniqueID == "" {
+		return nil
+	}
+	boundTo, err := a.revocationStore.BindOnce(ctx, metadataDeviceKey(tokenID), deviceUniqueID, a.metadataMaxAge())
+	if err != nil {
+		return errors.Wrapf(err, "failed to bind metadata %v to device %v", tokenID, deviceUniqueID)
+	}
+	if boundTo != deviceUniqueID {
+		return errors.Wrapf(ErrMetadataReplayed, "metadata %v is bound to %v, but used by %v", tokenID, boundTo, deviceUniqueID)
+	}
+
+	return nil
+}
+
+func (a *auth) metadataMaxAge() stdlibtime.Duration {
+	if a.cfg.WintrAuthIce.Metadata.MaxAge > 0 {
+		return a.cfg.WintrAuthIce.Metadata.MaxAge
+	}
+	if a.cfg.WintrAuthIce.RefreshExpirationTime > 0 {
+		return min(defaultMetadataMaxAge, a.cfg.WintrAuthIce.RefreshExpirationTime)
+	}
+
+	return defaultMetadataMaxAge
+}
+
 func (*auth) firstRegisteredUserID(metadata map[string]any) string {
 	var userID string
 	if registeredWithProviderInterface, found := metadata[internal.RegisteredWithProviderClaim]; found {
@@ -135,15 +282,24 @@ func (a *auth) GenerateTokens( //nolint:revive // We need to have these paramete
 		extra = extras[0]
 	}
 	accessToken, refreshToken, err = a.ice.GenerateTokens(now, userID, deviceUniqueID, email, hashCode, seq, role, extra)
-	err = errors.Wrapf(err, "can't generate tokens for userID:%v, email:%v", userID, email)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "can't generate tokens for userID:%v, email:%v", userID, email)
+	}
+	if err = a.saveSession(userID, accessToken, refreshToken); err != nil {
+		return "", "", errors.Wrapf(err, "can't save session for userID:%v, deviceUniqueID:%v", userID, deviceUniqueID)
+	}
 
-	return accessToken, refreshToken, err
+	return accessToken, refreshToken, nil
 }
 
 func (a *auth) GenerateMetadata(
-	now *time.Time, tokenID string, metadata map[string]any,
+	now *time.Time, tokenID string, metadata map[string]any, deviceUniqueID ...string,
 ) (string, error) {
-	md, err := a.ice.GenerateMetadata(now, tokenID, metadata)
+	var device string
+	if len(deviceUniqueID) > 0 {
+		device = deviceUniqueID[0]
+	}
+	md, err := a.ice.GenerateMetadata(now, tokenID, device, metadata)
 
 	return md, errors.Wrapf(err, "failed to generate metadata token for tokenID:%v", tokenID)
 }
@@ -159,3 +315,7 @@ func (a *auth) ParseToken(token string, verify bool) (res *IceToken, err error)
 
 	return res, errors.Wrapf(err, "can't verify token fields for:%v", token)
 }
+
+func (a *auth) JWKS() *JWKS {
+	return a.ice.JWKS()
+}
@@ -259,7 +259,7 @@ func TestMetadata_Empty(t *testing.T) {
 	var decodedMetadata jwt.MapClaims
 	err = client.(*auth).ice.VerifyTokenFields(metadataToken, &decodedMetadata) //nolint:forcetypeassert // .
 	require.NoError(t, err)
-	assert.Len(t, decodedMetadata, 3)
+	assert.Len(t, decodedMetadata, 4)
 	assert.Equal(t, userID, decodedMetadata["sub"])
 	assert.Equal(t, internal.MetadataIssuer, decodedMetadata["iss"])
 	assert.Equal(t, now.Unix(), int64(decodedMetadata["iat"].(float64))) //nolint:forcetypeassert // .
@@ -269,7 +269,7 @@ func TestMetadata_Empty(t *testing.T) {
 	assert.Equal(t, userID, tok.UserID)
 	err = client.(*auth).ice.VerifyTokenFields(metadataToken, &decodedMetadata) //nolint:forcetypeassert // .
 	require.NoError(t, err)
-	assert.Len(t, decodedMetadata, 3)
+	assert.Len(t, decodedMetadata, 4)
 	assert.Equal(t, userID, decodedMetadata["sub"])
 	assert.Equal(t, internal.MetadataIssuer, decodedMetadata["iss"])
 	assert.Equal(t, now.Unix(), int64(decodedMetadata["iat"].(float64))) //nolint:forcetypeassert // .
@@ -297,7 +297,7 @@ func TestMetadata_RegisteredBy(t *testing.T) { //nolint:funlen // .
 		var decodedMetadata jwt.MapClaims
 		err = client.(*auth).ice.VerifyTokenFields(metadataToken, &decodedMetadata) //nolint:forcetypeassert // .
 		require.NoError(t, err)
-		assert.Len(t, decodedMetadata, 6)
+		assert.Len(t, decodedMetadata, 7)
 		assert.Equal(t, userID, decodedMetadata["sub"])
 		assert.Equal(t, internal.MetadataIssuer, decodedMetadata["iss"])
 		assert.Equal(t, now.Unix(), int64(decodedMetadata["iat"].(float64))) //nolint:forcetypeassert // .
@@ -312,7 +312,7 @@ func TestMetadata_RegisteredBy(t *testing.T) { //nolint:funlen // .
 
 		err = client.(*auth).ice.VerifyTokenFields(metadataToken, &decodedMetadata) //nolint:forcetypeassert // .
 		require.NoError(t, err)
-		assert.Len(t, decodedMetadata, 6)
+		assert.Len(t, decodedMetadata, 7)
 		assert.Equal(t, userID, decodedMetadata["sub"])
 		assert.Equal(t, internal.MetadataIssuer, decodedMetadata["iss"])
 		assert.Equal(t, now.Unix(), int64(decodedMetadata["iat"].(float64))) //nolint:forcetypeassert // .
@@ -4,21 +4,43 @@ package auth
 
 import (
 	"context"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"sync"
+	stdlibtime "time"
+
+	"github.com/pkg/errors"
 
 	"github.com/ice-blockchain/wintr/auth/internal"
 	firebaseauth "github.com/ice-blockchain/wintr/auth/internal/firebase"
 	iceauth "github.com/ice-blockchain/wintr/auth/internal/ice"
+	"github.com/ice-blockchain/wintr/auth/internal/jwks"
+	oidcauth "github.com/ice-blockchain/wintr/auth/internal/oidc"
+	"github.com/ice-blockchain/wintr/connectors/storage/v3"
+	"github.com/ice-blockchain/wintr/email"
+	"github.com/ice-blockchain/wintr/sms"
 	"github.com/ice-blockchain/wintr/time"
+	"github.com/ice-blockchain/wintr/totp"
 )
 
 // Public API.
 
+const (
+	OTPChannelEmail OTPChannel = "email"
+	OTPChannelSMS   OTPChannel = "sms"
+)
+
 const (
 	IceIDClaim                  = internal.IceIDClaim
 	FirebaseIDClaim             = internal.FirebaseIDClaim
 	ProviderIce                 = internal.ProviderIce
 	ProviderFirebase            = internal.ProviderFirebase
 	RegisteredWithProviderClaim = internal.RegisteredWithProviderClaim
+	ProviderService             = internal.ProviderService
+	// MFAClaim holds, as `{"method":"totp","authTime":1672762852}`, the last time the user passed a second factor, if ever, for the access token.
+	MFAClaim      = internal.MFAClaim
+	MFAMethodTOTP = "totp"
 )
 
 var (
@@ -29,21 +51,208 @@ var (
 	ErrInvalidToken   = iceauth.ErrInvalidToken
 	ErrExpiredToken   = iceauth.ErrExpiredToken
 	ErrWrongTypeToken = iceauth.ErrWrongTypeToken
+	ErrRevokedToken   = errors.New("revoked token")
+	// ErrRefreshTokenReused is returned when a refresh token that was already rotated is used again, meaning it was most likely stolen.
+	// The whole family, i.e. all the tokens issued for the device, is revoked when it happens.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+	// ErrMetadataReplayed is returned when an X-Account-Metadata token is used with the tokens of another device than the one it's bound to.
+	ErrMetadataReplayed = errors.New("metadata replayed from another device")
+
+	ErrInvalidOTP  = errors.New("invalid one-time code")
+	ErrOTPLocked   = errors.New("too many invalid one-time codes")
+	ErrOTPTooSoon  = errors.New("one-time code requested too soon")
+	ErrOTPDisabled = errors.New("one-time codes are disabled")
+
+	// ErrMFARequired is returned when the token doesn't carry a second factor or when it was passed too long ago.
+	ErrMFARequired        = errors.New("fresh second factor required")
+	ErrInvalidMFACode     = errors.New("invalid second factor code")
+	ErrMFANotEnrolled     = errors.New("second factor not enrolled")
+	ErrMFAAlreadyEnrolled = errors.New("second factor already enrolled")
+	ErrMFADisabled        = errors.New("second factor is disabled")
+	ErrMFALocked          = errors.New("too many invalid second factor codes")
+
+	ErrInvalidClient = errors.New("invalid service client credentials")
+	ErrInvalidScope  = errors.New("scope not granted to the service")
+	ErrMissingScope  = errors.New("missing scope")
 )
 
 type (
 	Token    = internal.Token
 	IceToken = iceauth.Token
-	Client   interface {
+	// JWKS is the set of public keys used to verify asymmetrically signed ice tokens. It's served by the server at `/.well-known/jwks.json`.
+	JWKS       = jwks.Set
+	JSONWebKey = jwks.Key
+	Client     interface {
 		VerifyToken(ctx context.Context, token string) (*Token, error)
 		ParseToken(token string, verify bool) (*IceToken, error)
 		UpdateCustomClaims(ctx context.Context, userID string, customClaims map[string]any) error
 		DeleteUser(ctx context.Context, userID string) error
 		UpdateEmail(ctx context.Context, userID, email string) error
 		GenerateTokens(now *time.Time, userID, deviceUniqueID, email string, hashCode, seq int64, role string, extras ...map[string]any) (accessToken, refreshToken string, err error) //nolint:lll // .
-		GenerateMetadata(now *time.Time, userID string, md map[string]any) (string, error)
+		// GenerateMetadata issues the X-Account-Metadata token of the user. If deviceUniqueID is specified, it can be used only with the tokens of that device.
+		// Only ice tokens carry the device, so the metadata is bound to a device only when it's used with ice tokens.
+		// Otherwise, it's bound to the first device that uses it, if revocation is enabled.
+		GenerateMetadata(now *time.Time, userID string, md map[string]any, deviceUniqueID ...string) (string, error)
 		ModifyTokenWithMetadata(token *Token, metadataStr string) (*Token, error)
+		// ModifyTokenWithMetadataContext is ModifyTokenWithMetadata, with the revocation and the device binding checks bound to ctx.
+		ModifyTokenWithMetadataContext(ctx context.Context, token *Token, metadataStr string) (*Token, error)
+		// RevokeMetadata revokes the X-Account-Metadata token, so that it can't be used anymore, by anyone.
+		RevokeMetadata(ctx context.Context, metadataStr string) error
 		GetUserUIDByEmail(ctx context.Context, email string) (string, error)
+		// RevokeTokenID revokes the pair of ice tokens with the specified id (jti).
+		RevokeTokenID(ctx context.Context, userID, tokenID string) error
+		// RevokeDevice revokes all the ice tokens issued, so far, for the device of the user.
+		RevokeDevice(ctx context.Context, userID, deviceUniqueID string) error
+		// RevokeUser revokes all the ice tokens issued, so far, for the user, on every device. I.e. `logout everywhere`.
+		RevokeUser(ctx context.Context, userID string) error
+		// Sessions returns the active sessions of the user, one per device, with the latest tokens issued for it.
+		Sessions(ctx context.Context, userID string) ([]*Session, error)
+		JWKS() *JWKS
+		// RefreshTokens verifies the refresh token and issues a new pair, with the next seq, for the same user and device.
+		// Every refresh token can be used only once, if revocation is enabled: reusing one fails with ErrRefreshTokenReused.
+		RefreshTokens(ctx context.Context, now *time.Time, refreshToken string, hashCode int64, role string) (newRefreshToken, accessToken string, err error)
+		// IssueOTP sends a new one-time code to the recipient (an email or a phone number), replacing the previous one, if any.
+		// The invalid attempts of the previous codes still count towards the lockout, until LockoutDuration passes since the last code.
+		IssueOTP(ctx context.Context, channel OTPChannel, recipient string) error
+		// VerifyOTP checks the one-time code sent to the recipient and, if it's valid, issues the tokens for the user it belongs to.
+		// The code can be used only once. After too many invalid codes, the recipient is locked out for a while and ErrOTPLocked is returned.
+		VerifyOTP(ctx context.Context, now *time.Time, login *OTPLogin) (refreshToken, accessToken string, err error)
+		// UpgradeWithMFA adds the MFAClaim, with now as its authTime, to the ice access token. Call it only after the second factor was verified,
+		// i.e. after a successful totp.Verify. StepUpTOTP and ConfirmTOTP do both, for the secrets enrolled via EnrollTOTP.
+		UpgradeWithMFA(ctx context.Context, now *time.Time, accessToken, method string) (string, error)
+		// EnrollTOTP starts (or restarts) the enrollment of the user and returns the provisioning URI of its new secret, to be added to its authenticator.
+		EnrollTOTP(ctx context.Context, userID, account string) (uri string, err error)
+		// ConfirmTOTP completes the enrollment of the user of the access token with the first code from its authenticator and upgrades the token.
+		ConfirmTOTP(ctx context.Context, now *time.Time, accessToken, code string) (upgradedAccessToken string, err error)
+		// StepUpTOTP verifies the code of the enrolled user of the access token and upgrades the token. Every code can be used only once.
+		// After too many attempts, the user is locked out for a while and ErrMFALocked is returned, by ConfirmTOTP too.
+		StepUpTOTP(ctx context.Context, now *time.Time, accessToken, code string) (upgradedAccessToken string, err error)
+		// DisableTOTP deletes the enrollment of the user, if any, confirmed or not.
+		DisableTOTP(ctx context.Context, userID string) error
+		// MFAEnrollment returns the enrollment of the user, or nil if there's none.
+		MFAEnrollment(ctx context.Context, userID string) (*MFAEnrollment, error)
+		// IssueServiceToken authenticates the service, by its client id and secret, or by its mTLS certificate, and issues a short-lived token
+		// with the requested scopes or, if none are requested, with all the scopes granted to it.
+		IssueServiceToken(now *time.Time, credentials *ServiceCredentials, scopes ...string) (*ServiceToken, error)
+		// IssuesServiceTokens reports if there are any services that can get service tokens.
+		IssuesServiceTokens() bool
+		// Close closes the storage/v3 connection shared by the stores enabled via the config, if any.
+		// The stores provided via options are left to their owners to close.
+		io.Closer
+	}
+	Option  func(*auth)
+	Session struct {
+		IssuedAt       *time.Time `json:"issuedAt,omitempty" example:"2022-01-03T16:20:52.156534Z"`
+		ExpiresAt      *time.Time `json:"expiresAt,omitempty" example:"2022-01-03T16:20:52.156534Z"`
+		DeviceUniqueID string     `json:"deviceUniqueId,omitempty" example:"6FB988F3-36F4-433D-9C7C-555887E57EB2"`
+		TokenID        string     `json:"tokenId,omitempty" example:"0fb2b2a9-0d54-4c4c-9d6c-2b0c54d1a4f8"`
+		Seq            int64      `json:"seq,omitempty" example:"1"`
+	}
+	OTPChannel string
+	// OTP is a one-time code that has to be delivered to the recipient.
+	OTP struct {
+		ExpiresAt *time.Time
+		Channel   OTPChannel
+		Recipient string
+		Code      string
+	}
+	// OTPLogin is the login of the user, identified by the caller based on the recipient, with the one-time code it received.
+	OTPLogin struct {
+		Claims         map[string]any
+		Channel        OTPChannel
+		Recipient      string
+		Code           string
+		UserID         string
+		DeviceUniqueID string
+		// Email is used for the tokens, if the code was sent by SMS. Otherwise, it's the recipient.
+		Email    string
+		Role     string
+		HashCode int64
+		Seq      int64
+	}
+	// OTPChallenge is the state of the one-time code issued for a recipient. The code itself is never stored, only its HMAC.
+	OTPChallenge struct {
+		IssuedAt    *time.Time
+		ExpiresAt   *time.Time
+		LockedUntil *time.Time
+		CodeHash    string
+		Attempts    int64
+	}
+	OTPSender interface {
+		SendOTP(ctx context.Context, otp *OTP) error
+	}
+	// OTPSenders delivers the codes using the sender registered for their channel.
+	OTPSenders map[OTPChannel]OTPSender
+	OTPStore   interface {
+		io.Closer
+		// SaveOTP stores the challenge, for ttl, replacing the previous one, if any, including its attempts.
+		SaveOTP(ctx context.Context, key string, challenge *OTPChallenge, ttl stdlibtime.Duration) error
+		// GetOTP returns the challenge, or nil if there's none.
+		GetOTP(ctx context.Context, key string) (*OTPChallenge, error)
+		// IncrementOTPAttempts atomically increments the attempts of the challenge and returns them, or 0 if there's no challenge anymore.
+		IncrementOTPAttempts(ctx context.Context, key string) (int64, error)
+		// DeleteOTP deletes the challenge and reports if it was still there, so that a code can be used only once.
+		DeleteOTP(ctx context.Context, key string) (bool, error)
+	}
+	// MFAEnrollment is the TOTP second factor of a user. It's pending until it's confirmed with a code, i.e. while EnrolledAt is nil.
+	MFAEnrollment struct {
+		EnrolledAt *time.Time `json:"enrolledAt,omitempty" example:"2022-01-03T16:20:52.156534Z"`
+		LastUsedAt *time.Time `json:"lastUsedAt,omitempty" example:"2022-01-03T16:20:52.156534Z"`
+		Secret     string     `json:"secret,omitempty"`
+	}
+	MFAStore interface {
+		io.Closer
+		// SaveMFAEnrollment stores the enrollment of the user, for ttl, or forever if ttl is 0, replacing the previous one, if any.
+		SaveMFAEnrollment(ctx context.Context, userID string, enrollment *MFAEnrollment, ttl stdlibtime.Duration) error
+		// GetMFAEnrollment returns the enrollment of the user, or nil if there's none.
+		GetMFAEnrollment(ctx context.Context, userID string) (*MFAEnrollment, error)
+		DeleteMFAEnrollment(ctx context.Context, userID string) error
+		// UseMFACode atomically records the code of the time step as used by the user, for ttl. It returns false if it was already used.
+		UseMFACode(ctx context.Context, userID, code string, step int64, ttl stdlibtime.Duration) (bool, error)
+		// IncrementMFAAttempts atomically counts an attempt of the user and returns the attempts so far. They're counted for ttl from the first one.
+		IncrementMFAAttempts(ctx context.Context, userID string, ttl stdlibtime.Duration) (int64, error)
+		// ResetMFAAttempts forgets the attempts of the user, after a valid code.
+		ResetMFAAttempts(ctx context.Context, userID string) error
+	}
+	ServiceCredentials struct {
+		// Certificate is the client certificate of the mTLS connection. It must be already verified, i.e. by the tls.Config of the server.
+		Certificate  *x509.Certificate
+		ClientID     string
+		ClientSecret string
+	}
+	// ServiceToken is the response of the OAuth 2.0 client credentials grant (RFC 6749, section 4.4).
+	ServiceToken struct {
+		AccessToken string `json:"access_token"` //nolint:tagliatelle // It's the standard.
+		TokenType   string `json:"token_type"`   //nolint:tagliatelle // It's the standard.
+		Scope       string `json:"scope,omitempty"`
+		ExpiresIn   int64  `json:"expires_in"` //nolint:tagliatelle // It's the standard.
+	}
+	// ServiceTokenSource gets service tokens from the token endpoint of the issuing service and caches them until shortly before they expire.
+	ServiceTokenSource struct {
+		expiresAt    stdlibtime.Time
+		client       *http.Client
+		token        string
+		tokenURL     string
+		clientID     string
+		clientSecret string
+		scopes       []string
+		mx           sync.Mutex
+	}
+	// RevocationStore keeps track of revoked ice tokens and of the active sessions of the users.
+	RevocationStore interface {
+		io.Closer
+		// Revoke marks the keys as revoked at revokedAt, for ttl, i.e. until all the tokens they refer to expire anyway.
+		Revoke(ctx context.Context, revokedAt stdlibtime.Time, ttl stdlibtime.Duration, keys ...string) error
+		// RevokedAt returns, for every key, when it was revoked, or nil if it wasn't.
+		RevokedAt(ctx context.Context, keys ...string) ([]*stdlibtime.Time, error)
+		SaveSession(ctx context.Context, userID string, session *Session, ttl stdlibtime.Duration) error
+		// SwapSession replaces the session of the device only if its current token id is previousTokenID, or if there's none and previousTokenID is empty.
+		SwapSession(ctx context.Context, userID, previousTokenID string, session *Session, ttl stdlibtime.Duration) (bool, error)
+		// BindOnce binds the key to the value, for ttl, unless it's already bound, and returns the value it's bound to.
+		BindOnce(ctx context.Context, key, value string, ttl stdlibtime.Duration) (string, error)
+		// DeleteSessions deletes the sessions of the specified devices or, if none are specified, all the sessions of the user.
+		DeleteSessions(ctx context.Context, userID string, deviceUniqueIDs ...string) error
+		Sessions(ctx context.Context, userID string) ([]*Session, error)
 	}
 )
 
@@ -51,7 +260,118 @@ type (
 
 type (
 	auth struct {
-		ice iceauth.Client
-		fb  firebaseauth.Client
+		ice             iceauth.Client
+		fb              firebaseauth.Client
+		oidc            oidcauth.Client
+		revocationStore RevocationStore
+		otpStore        OTPStore
+		otpSender       OTPSender
+		mfaStore        MFAStore
+		totp            totp.TOTP
+		db              storage.DB
+		cfg             *config
+	}
+	serviceTokenTransport struct {
+		base   http.RoundTripper
+		source *ServiceTokenSource
+	}
+	config struct {
+		WintrAuthIce struct {
+			Revocation struct {
+				// Enabled makes ice tokens revocable, using storage/v3, unless a store is provided via WithRevocationStore.
+				Enabled bool `yaml:"enabled" mapstructure:"enabled"`
+			} `yaml:"revocation" mapstructure:"revocation"`
+			OTP struct {
+				// Secret is the key of the HMAC of the codes. If it's not set, it's read from the `<KEY>_OTP_SECRET` or `OTP_SECRET` env vars.
+				Secret string `yaml:"secret" mapstructure:"secret"`
+				// Enabled makes one-time codes available, stored in storage/v3, unless a store is provided via WithOTP.
+				Enabled         bool                `yaml:"enabled" mapstructure:"enabled"`
+				Length          int                 `yaml:"length" mapstructure:"length"`
+				MaxAttempts     int64               `yaml:"maxAttempts" mapstructure:"maxAttempts"`
+				Expiration      stdlibtime.Duration `yaml:"expiration" mapstructure:"expiration"`
+				LockoutDuration stdlibtime.Duration `yaml:"lockoutDuration" mapstructure:"lockoutDuration"`
+				ResendInterval  stdlibtime.Duration `yaml:"resendInterval" mapstructure:"resendInterval"`
+			} `yaml:"otp" mapstructure:"otp"`
+			MFA struct {
+				// Enabled makes TOTP enrollments available, stored in storage/v3, unless a store is provided via WithMFAStore.
+				Enabled bool `yaml:"enabled" mapstructure:"enabled"`
+				// MaxAttempts is how many codes a user can try in LockoutDuration, from the first one. It's locked out for the rest of it after that.
+				MaxAttempts     int64               `yaml:"maxAttempts" mapstructure:"maxAttempts"`
+				LockoutDuration stdlibtime.Duration `yaml:"lockoutDuration" mapstructure:"lockoutDuration"`
+			} `yaml:"mfa" mapstructure:"mfa"`
+			Services struct {
+				// Clients are the services that can get service tokens.
+				Clients []*struct {
+					ID string `yaml:"id" mapstructure:"id"`
+					// Secret is the client secret of the service. If it's not set, it's read from the `<KEY>_<ID>_SERVICE_SECRET` env var.
+					Secret string `yaml:"secret" mapstructure:"secret"`
+					// Identity is the subject common name, or an URI SAN (i.e. a SPIFFE id), of the client certificate of the service, if it uses mTLS.
+					Identity string   `yaml:"identity" mapstructure:"identity"`
+					Scopes   []string `yaml:"scopes" mapstructure:"scopes"`
+				} `yaml:"clients" mapstructure:"clients"`
+				ExpirationTime stdlibtime.Duration `yaml:"expirationTime" mapstructure:"expirationTime"`
+			} `yaml:"services" mapstructure:"services"`
+			Metadata struct {
+				// MaxAge is how long X-Account-Metadata tokens can be used after they're issued. It defaults to a day,
+				// or to RefreshExpirationTime, if that's shorter.
+				MaxAge stdlibtime.Duration `yaml:"maxAge" mapstructure:"maxAge"`
+			} `yaml:"metadata" mapstructure:"metadata"`
+			RefreshExpirationTime stdlibtime.Duration `yaml:"refreshExpirationTime" mapstructure:"refreshExpirationTime"`
+		} `yaml:"wintr/auth/ice" mapstructure:"wintr/auth/ice"` //nolint:tagliatelle // Nope.
+	}
+	redisRevocationStore struct {
+		db storage.DB
+	}
+	redisOTPStore struct {
+		db storage.DB
+	}
+	redisMFAStore struct {
+		db storage.DB
 	}
+	emailOTPSender struct {
+		client  email.Client
+		from    email.Participant
+		subject string
+		body    string
+	}
+	smsOTPSender struct {
+		client  sms.Client
+		message string
+	}
+)
+
+const (
+	revokedTokenKeyPrefix    = "auth:revoked:token:"
+	revokedDeviceKeyPrefix   = "auth:revoked:device:"
+	revokedUserKeyPrefix     = "auth:revoked:user:"
+	sessionsKeyPrefix        = "auth:sessions:"
+	revokedMetadataKeyPrefix = "auth:revoked:metadata:"
+	metadataDeviceKeyPrefix  = "auth:metadata:device:"
+	sessionSavingTimeout     = 5 * stdlibtime.Second
+	defaultMetadataMaxAge    = 24 * stdlibtime.Hour
+
+	otpKeyPrefix              = "auth:otp:"
+	otpCodePlaceholder        = "{{code}}"
+	defaultOTPLength          = 6
+	defaultOTPMaxAttempts     = 5
+	defaultOTPExpiration      = 5 * stdlibtime.Minute
+	defaultOTPLockoutDuration = 15 * stdlibtime.Minute
+	defaultOTPResendInterval  = 30 * stdlibtime.Second
+
+	mfaKeyPrefix                = "auth:mfa:"
+	usedMFACodeKeyPrefix        = "auth:mfa-used:"
+	mfaAttemptsKeyPrefix        = "auth:mfa-attempts:"
+	defaultMFAMaxAttempts       = 5
+	defaultMFALockoutDuration   = 15 * stdlibtime.Minute
+	pendingMFAEnrollmentTimeout = 15 * stdlibtime.Minute
+	// mfaCodeReuseWindow is longer than the validity of a TOTP code, so that an intercepted code can't be replayed.
+	mfaCodeReuseWindow = stdlibtime.Minute
+	// mfaCodeStep is how often the TOTP codes rotate.
+	mfaCodeStep = 30 * stdlibtime.Second
+
+	serviceTokenType                   = "Bearer"
+	defaultServiceTokenExpiration      = 5 * stdlibtime.Minute
+	serviceTokenRefreshBefore          = 30 * stdlibtime.Second
+	serviceTokenFetchTimeout           = 10 * stdlibtime.Second
+	maxServiceTokenResponseSizeInBytes = 1 << 16
 )
@@ -8,11 +8,14 @@ const (
 	RefreshJwtIssuer            = "ice.io/refresh"
 	AccessJwtIssuer             = "ice.io/access"
 	MetadataIssuer              = "ice.io/metadata"
+	ServiceJwtIssuer            = "ice.io/service"
 	RegisteredWithProviderClaim = "registeredWithProvider"
 	ProviderFirebase            = "firebase"
 	ProviderIce                 = "ice"
+	ProviderService             = "service"
 	FirebaseIDClaim             = "firebaseId"
 	IceIDClaim                  = "iceId"
+	MFAClaim                    = "mfa"
 )
 
 type (
@@ -4,12 +4,14 @@ package iceauth //nolint:revive //.
 
 import (
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/pkg/errors"
 
 	"github.com/ice-blockchain/wintr/auth/internal"
+	"github.com/ice-blockchain/wintr/auth/internal/jwks"
 	appcfg "github.com/ice-blockchain/wintr/config"
 )
 
@@ -18,12 +20,12 @@ func New(applicationYAMLKey string) Client {
 	appcfg.MustLoadFromKey(applicationYAMLKey, &cfg)
 	cfg.loadSecretForJWT(applicationYAMLKey)
 
-	return &auth{
-		cfg: &cfg,
-		signToken: func(token *jwt.Token) (string, error) {
-			return token.SignedString([]byte(cfg.WintrAuthIce.JWTSecret))
-		},
+	a := &auth{cfg: &cfg, keys: newKeyRing(&cfg, applicationYAMLKey)}
+	if cfg.WintrAuthIce.JWKSURL != "" {
+		a.remoteKeys = jwks.NewCache(cfg.WintrAuthIce.JWKSURL, 0)
 	}
+
+	return a
 }
 
 func (a *auth) VerifyToken(token string) (*internal.Token, error) {
@@ -59,8 +61,26 @@ func (a *auth) VerifyToken(token string) (*internal.Token, error) {
 	return tok, nil
 }
 
+func (a *auth) VerifyServiceToken(token string) (*internal.Token, error) {
+	var serviceToken ServiceToken
+	if err := a.VerifyTokenFields(token, &serviceToken); err != nil {
+		return nil, errors.Wrapf(err, "invalid service token")
+	}
+	if serviceToken.Issuer != internal.ServiceJwtIssuer {
+		return nil, errors.Wrapf(ErrWrongTypeToken, "non-service token: %v", serviceToken.Issuer)
+	}
+
+	return &internal.Token{
+		Claims: map[string]any{
+			"clientId": serviceToken.Subject,
+			"scope":    serviceToken.Scope,
+		},
+		Provider: internal.ProviderService,
+	}, nil
+}
+
 func (a *auth) VerifyTokenFields(jwtToken string, res jwt.Claims) error {
-	if _, err := jwt.ParseWithClaims(jwtToken, res, a.verify()); err != nil {
+	if _, err := jwt.ParseWithClaims(jwtToken, res, a.verify(), jwt.WithValidMethods(supportedSigningMethods)); err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) || errors.Is(err, jwt.ErrTokenNotValidYet) {
 			return errors.Wrapf(ErrExpiredToken, "expired or not valid yet token")
 		}
@@ -78,7 +98,7 @@ func DetectIceToken(jwtToken string) (*Token, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "parse unverified error for token:%v", jwtToken)
 	}
-	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || token.Method.Alg() != jwt.SigningMethodHS256.Name {
+	if !slices.Contains(supportedSigningMethods, token.Method.Alg()) {
 		return nil, errors.Errorf("unexpected signing method:%v", token.Header["alg"])
 	}
 	if iss, iErr := token.Claims.GetIssuer(); iErr != nil || (iss != internal.AccessJwtIssuer && iss != internal.RefreshJwtIssuer) {
@@ -88,18 +108,26 @@ func DetectIceToken(jwtToken string) (*Token, error) {
 	return &claims, nil
 }
 
+// DetectServiceToken reports if the token claims to be a service token. It isn't verified.
+func DetectServiceToken(jwtToken string) bool {
+	var claims jwt.RegisteredClaims
+	token, _, err := jwt.NewParser().ParseUnverified(jwtToken, &claims)
+
+	return err == nil && slices.Contains(supportedSigningMethods, token.Method.Alg()) && claims.Issuer == internal.ServiceJwtIssuer
+}
+
 func (a *auth) verify() func(token *jwt.Token) (any, error) {
 	return func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || token.Method.Alg() != jwt.SigningMethodHS256.Name {
+		if !slices.Contains(supportedSigningMethods, token.Method.Alg()) {
 			return nil, errors.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		iss, err := token.Claims.GetIssuer()
-		invalidIssuer := (iss != internal.AccessJwtIssuer && iss != internal.RefreshJwtIssuer && iss != internal.MetadataIssuer)
+		invalidIssuer := (iss != internal.AccessJwtIssuer && iss != internal.RefreshJwtIssuer && iss != internal.MetadataIssuer && iss != internal.ServiceJwtIssuer)
 		if err != nil || invalidIssuer {
 			return nil, errors.Wrapf(ErrInvalidToken, "invalid issuer:%v", iss)
 		}
 
-		return []byte(a.cfg.WintrAuthIce.JWTSecret), nil
+		return a.verificationKey(token)
 	}
 }
 
@@ -3,12 +3,14 @@
 package iceauth //nolint:revive //.
 
 import (
+	"crypto"
 	stdlibtime "time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/pkg/errors"
 
 	"github.com/ice-blockchain/wintr/auth/internal"
+	"github.com/ice-blockchain/wintr/auth/internal/jwks"
 	"github.com/ice-blockchain/wintr/time"
 )
 
@@ -25,7 +27,16 @@ type (
 		VerifyToken(token string) (*internal.Token, error)
 		GenerateTokens(now *time.Time, userID, deviceID, email string, hashCode, seq int64, role string, extra map[string]any) (access, refresh string, err error)
 		VerifyTokenFields(token string, res jwt.Claims) error
-		GenerateMetadata(now *time.Time, tokenID string, metadata map[string]any) (string, error)
+		// GenerateMetadata issues a metadata token with an unique id (jti). If deviceUniqueID is set, it's its audience.
+		GenerateMetadata(now *time.Time, tokenID, deviceUniqueID string, metadata map[string]any) (string, error)
+		// UpgradeAccessToken re-signs the (valid) access token with the extra claims added to its custom ones. Everything else, including its id,
+		// issuance and expiration, stays the same.
+		UpgradeAccessToken(now *time.Time, accessToken string, extra map[string]any) (string, error)
+		// GenerateServiceToken issues a token, valid for ttl, for the service with the specified client id and scopes.
+		GenerateServiceToken(now *time.Time, clientID string, scopes []string, ttl stdlibtime.Duration) (string, error)
+		VerifyServiceToken(token string) (*internal.Token, error)
+		// JWKS returns the public keys that can be used to verify the tokens signed by this client, including the upcoming ones.
+		JWKS() *jwks.Set
 	}
 
 	Token struct {
@@ -37,21 +48,52 @@ type (
 		HashCode       int64          `json:"hashCode,omitempty" example:"12356789"`
 		Seq            int64          `json:"seq" example:"1"`
 	}
+	// ServiceToken is the token of a service, not of an user. Its subject is the client id of the service.
+	ServiceToken struct {
+		*jwt.RegisteredClaims
+		// Scope holds the space separated scopes granted to the service, as per RFC 6749.
+		Scope string `json:"scope,omitempty" example:"users:read users:write"`
+	}
 )
 
 // Private API.
 
 type (
 	auth struct {
-		cfg       *config
-		signToken func(token *jwt.Token) (string, error)
+		cfg        *config
+		keys       *keyRing
+		remoteKeys *jwks.Cache
+	}
+	keyRing struct {
+		keys             []*signingKey
+		maxTokenLifetime stdlibtime.Duration
+	}
+	signingKey struct {
+		activeFrom stdlibtime.Time
+		privateKey crypto.Signer
+		method     jwt.SigningMethod
+		kid        string
 	}
 
 	config struct {
 		WintrAuthIce struct {
+			// JWKSURL is the JWKS endpoint of the service issuing the tokens, for services that only verify asymmetrically signed tokens.
+			JWKSURL string `yaml:"jwksUrl" mapstructure:"jwksUrl"` //nolint:tagliatelle // Nope.
+			// SigningKeys are PEM encoded ECDSA (ES256, ES384) or Ed25519 (EdDSA) private keys. The one activated the latest signs new tokens,
+			// the previous ones are still used to verify tokens until they expire. If there are none, tokens are signed with JWTSecret (HS256).
+			SigningKeys []*struct {
+				KID        string `yaml:"kid" mapstructure:"kid"`
+				PrivateKey string `yaml:"privateKey" mapstructure:"privateKey"`
+				ActiveFrom string `yaml:"activeFrom" mapstructure:"activeFrom"`
+			} `yaml:"signingKeys" mapstructure:"signingKeys"`
 			JWTSecret             string              `yaml:"jwtSecret" mapstructure:"jwtSecret"`
 			RefreshExpirationTime stdlibtime.Duration `yaml:"refreshExpirationTime" mapstructure:"refreshExpirationTime"`
 			AccessExpirationTime  stdlibtime.Duration `yaml:"accessExpirationTime" mapstructure:"accessExpirationTime"`
 		} `yaml:"wintr/auth/ice" mapstructure:"wintr/auth/ice"` //nolint:tagliatelle // Nope.
 	}
 )
+
+//nolint:gochecknoglobals // It's immutable.
+var supportedSigningMethods = []string{
+	jwt.SigningMethodHS256.Alg(), jwt.SigningMethodES256.Alg(), jwt.SigningMethodES384.Alg(), jwt.SigningMethodEdDSA.Alg(),
+}
@@ -0,0 +1,196 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package iceauth //nolint:revive //.
+
+import (
+	"cmp"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	stdlibtime "time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+
+	"github.com/ice-blockchain/wintr/auth/internal/jwks"
+	"github.com/ice-blockchain/wintr/log"
+)
+
+//nolint:gochecknoglobals // It's immutable.
+var nonAlphanumeric = regexp.MustCompile(`[^A-Z0-9]+`)
+
+func newKeyRing(cfg *config, applicationYAMLKey string) *keyRing {
+	ring := &keyRing{
+		keys:             make([]*signingKey, 0, len(cfg.WintrAuthIce.SigningKeys)),
+		maxTokenLifetime: max(cfg.WintrAuthIce.RefreshExpirationTime, cfg.WintrAuthIce.AccessExpirationTime),
+	}
+	for _, keyCfg := range cfg.WintrAuthIce.SigningKeys {
+		if keyCfg.KID == "" || slices.ContainsFunc(ring.keys, func(key *signingKey) bool { return key.kid == keyCfg.KID }) {
+			log.Panic(errors.Errorf("signing keys must have unique, non empty, kids, got `%v`", keyCfg.KID))
+		}
+		activeFrom, err := stdlibtime.Parse(stdlibtime.RFC3339, keyCfg.ActiveFrom)
+		log.Panic(errors.Wrapf(err, "invalid activeFrom `%v` for signing key %v, expected RFC3339", keyCfg.ActiveFrom, keyCfg.KID))
+		privateKeyPEM := keyCfg.PrivateKey
+		if privateKeyPEM == "" {
+			privateKeyPEM = os.Getenv(privateKeyEnv(applicationYAMLKey, keyCfg.KID))
+		}
+		key, err := newSigningKey(keyCfg.KID, privateKeyPEM, activeFrom)
+		log.Panic(errors.Wrapf(err, "invalid signing key %v", keyCfg.KID))
+		ring.keys = append(ring.keys, key)
+	}
+	slices.SortStableFunc(ring.keys, func(k1, k2 *signingKey) int { return k1.activeFrom.Compare(k2.activeFrom) })
+
+	return ring
+}
+
+// privateKeyEnv is where the private key is looked for, if it's not in the config, i.e. `SELF_JWT_PRIVATE_KEY_2024_01` for the `2024-01` kid.
+func privateKeyEnv(applicationYAMLKey, kid string) string {
+	module := nonAlphanumeric.ReplaceAllString(strings.ToUpper(applicationYAMLKey), "_")
+
+	return module + "_JWT_PRIVATE_KEY_" + nonAlphanumeric.ReplaceAllString(strings.ToUpper(kid), "_")
+}
+
+func newSigningKey(kid, privateKeyPEM string, activeFrom stdlibtime.Time) (*signingKey, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, errors.New("no PEM encoded private key found")
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		var ecErr error
+		if privateKey, ecErr = x509.ParseECPrivateKey(block.Bytes); ecErr != nil {
+			return nil, errors.Wrap(err, "failed to parse PKCS8 or SEC1 private key")
+		}
+	}
+	key := &signingKey{kid: kid, activeFrom: activeFrom}
+	switch private := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		switch private.Curve {
+		case elliptic.P256():
+			key.method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.method = jwt.SigningMethodES384
+		default:
+			return nil, errors.Errorf("unsupported curve %v", private.Curve.Params().Name)
+		}
+		key.privateKey = private
+	case ed25519.PrivateKey:
+		key.method, key.privateKey = jwt.SigningMethodEdDSA, private
+	default:
+		return nil, errors.Errorf("unsupported private key type %T, expected ECDSA or Ed25519", privateKey)
+	}
+
+	return key, nil
+}
+
+// signingKey returns the key that was activated the latest, or nil if there's none, yet, meaning that tokens are signed with the shared secret.
+func (r *keyRing) signingKey(now stdlibtime.Time) *signingKey {
+	var current *signingKey
+	for _, key := range r.keys {
+		if key.activeFrom.After(now) {
+			break
+		}
+		current = key
+	}
+
+	return current
+}
+
+// verificationKey returns the key with the kid, unless it was replaced long enough ago, so that all the tokens it signed already expired.
+func (r *keyRing) verificationKey(kid string, now stdlibtime.Time) *signingKey {
+	for ix, key := range r.keys {
+		if key.kid == kid && !r.retired(ix, now) {
+			return key
+		}
+	}
+
+	return nil
+}
+
+func (r *keyRing) retired(ix int, now stdlibtime.Time) bool {
+	if ix == len(r.keys)-1 {
+		return false
+	}
+	replacedAt := r.keys[ix+1].activeFrom
+
+	return !replacedAt.After(now) && now.Sub(replacedAt) > r.maxTokenLifetime
+}
+
+// jwks returns the public keys of the active, upcoming and recently replaced keys.
+func (r *keyRing) jwks(now stdlibtime.Time) *jwks.Set {
+	set := &jwks.Set{Keys: make([]*jwks.Key, 0, len(r.keys))}
+	for ix, key := range r.keys {
+		if r.retired(ix, now) {
+			continue
+		}
+		jwk, err := jwks.NewKey(key.kid, key.method.Alg(), key.privateKey.Public())
+		log.Panic(errors.Wrapf(err, "failed to build JWK for %v", key.kid)) //nolint:revive // It's validated when it's parsed.
+		set.Keys = append(set.Keys, jwk)
+	}
+	slices.SortStableFunc(set.Keys, func(k1, k2 *jwks.Key) int { return cmp.Compare(k1.KID, k2.KID) })
+
+	return set
+}
+
+func (a *auth) JWKS() *jwks.Set {
+	return a.keys.jwks(stdlibtime.Now())
+}
+
+// signToken signs the claims with the current signing key, adding its `kid` to the header, or with the shared secret if there's none.
+func (a *auth) signToken(now stdlibtime.Time, claims jwt.Claims) (string, error) {
+	key := a.keys.signingKey(now)
+	if key == nil {
+		if a.cfg.WintrAuthIce.JWTSecret == "" {
+			return "", errors.New("there's neither a jwt secret, nor an active signing key")
+		}
+
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(a.cfg.WintrAuthIce.JWTSecret)) //nolint:wrapcheck // It's wrapped outside.
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+
+	return token.SignedString(key.privateKey) //nolint:wrapcheck // It's wrapped outside.
+}
+
+// verificationKey returns the key used to verify the token, based on its algorithm and `kid`.
+func (a *auth) verificationKey(token *jwt.Token) (any, error) {
+	alg := token.Method.Alg()
+	if alg == jwt.SigningMethodHS256.Alg() {
+		if a.cfg.WintrAuthIce.JWTSecret == "" {
+			return nil, errors.Wrap(ErrInvalidToken, "HS256 tokens aren't accepted, there's no jwt secret")
+		}
+
+		return []byte(a.cfg.WintrAuthIce.JWTSecret), nil
+	}
+	kid, _ := token.Header["kid"].(string) //nolint:errcheck,revive // It's checked below.
+	if kid == "" {
+		return nil, errors.Wrapf(ErrInvalidToken, "missing kid for %v token", alg)
+	}
+	if key := a.keys.verificationKey(kid, stdlibtime.Now()); key != nil {
+		if key.method.Alg() != alg {
+			return nil, errors.Wrapf(ErrInvalidToken, "key %v is for %v, not %v", kid, key.method.Alg(), alg)
+		}
+
+		return key.privateKey.Public(), nil
+	}
+	if a.remoteKeys == nil {
+		return nil, errors.Wrapf(ErrInvalidToken, "unknown or expired key %v", kid)
+	}
+	jwk, err := a.remoteKeys.Key(context.Background(), kid)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidToken, "unknown key %v: %v", kid, err)
+	}
+	if jwk.Alg != "" && jwk.Alg != alg {
+		return nil, errors.Wrapf(ErrInvalidToken, "key %v is for %v, not %v", kid, jwk.Alg, alg)
+	}
+	publicKey, err := jwk.PublicKey()
+
+	return publicKey, errors.Wrapf(err, "invalid key %v", kid)
+}
@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package iceauth //nolint:revive //.
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	stdlibtime "time"
+
+	"github.com/goccy/go-json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/auth/internal/jwks"
+	"github.com/ice-blockchain/wintr/time"
+)
+
+func newKeysTestAuth(t *testing.T, secret string, keys map[string]stdlibtime.Time) *auth {
+	t.Helper()
+	var cfg config
+	cfg.WintrAuthIce.JWTSecret = secret
+	cfg.WintrAuthIce.AccessExpirationTime = stdlibtime.Hour
+	cfg.WintrAuthIce.RefreshExpirationTime = 24 * stdlibtime.Hour
+	for kid, activeFrom := range keys {
+		var privateKey any
+		if kid == "ed" {
+			_, privateKey, _ = ed25519.GenerateKey(rand.Reader) //nolint:errcheck // .
+		} else {
+			privateKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader) //nolint:errcheck // .
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		require.NoError(t, err)
+		cfg.WintrAuthIce.SigningKeys = append(cfg.WintrAuthIce.SigningKeys, &struct {
+			KID        string `yaml:"kid" mapstructure:"kid"`
+			PrivateKey string `yaml:"privateKey" mapstructure:"privateKey"`
+			ActiveFrom string `yaml:"activeFrom" mapstructure:"activeFrom"`
+		}{
+			KID:        kid,
+			PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+			ActiveFrom: activeFrom.Format(stdlibtime.RFC3339),
+		})
+	}
+
+	return &auth{cfg: &cfg, keys: newKeyRing(&cfg, "self")}
+}
+
+func TestKeyRotation(t *testing.T) {
+	t.Parallel()
+	now := stdlibtime.Now().Truncate(stdlibtime.Second)
+	withSecret := newKeysTestAuth(t, "bogus", nil)
+	client := newKeysTestAuth(t, "bogus", map[string]stdlibtime.Time{
+		"retired":  now.Add(-72 * stdlibtime.Hour),
+		"previous": now.Add(-48 * stdlibtime.Hour),
+		"ed":       now.Add(-stdlibtime.Hour),
+		"upcoming": now.Add(stdlibtime.Hour),
+	})
+
+	kids := make([]string, 0, len(client.JWKS().Keys))
+	for _, key := range client.JWKS().Keys {
+		kids = append(kids, key.KID)
+	}
+	assert.Equal(t, []string{"ed", "previous", "upcoming"}, kids)
+
+	_, accessToken, err := client.GenerateTokens(time.New(now), "user", "device", "a@b.c", 0, 1, "app", nil)
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(accessToken, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "ed", parsed.Header["kid"])
+	assert.Equal(t, "EdDSA", parsed.Header["alg"])
+	token, err := client.VerifyToken(accessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user", token.UserID)
+	_, err = DetectIceToken(accessToken)
+	require.NoError(t, err)
+	_, err = withSecret.VerifyToken(accessToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	for kid, valid := range map[string]bool{"previous": true, "upcoming": true, "retired": false, "bogus": false} {
+		signer := kid
+		if kid == "bogus" {
+			signer = "ed"
+		}
+		for _, key := range client.keys.keys {
+			if key.kid != signer {
+				continue
+			}
+			unsigned := jwt.NewWithClaims(key.method, jwt.MapClaims{"iss": "ice.io/access", "sub": "user", "exp": now.Add(stdlibtime.Hour).Unix()})
+			unsigned.Header["kid"] = kid
+			signed, sErr := unsigned.SignedString(key.privateKey)
+			require.NoError(t, sErr)
+			if valid {
+				require.NoError(t, client.VerifyTokenFields(signed, jwt.MapClaims{}), kid)
+			} else {
+				require.ErrorIs(t, client.VerifyTokenFields(signed, jwt.MapClaims{}), ErrInvalidToken, kid)
+			}
+		}
+	}
+
+	_, legacyToken, err := withSecret.GenerateTokens(time.New(now), "user", "device", "a@b.c", 0, 1, "app", nil)
+	require.NoError(t, err)
+	_, err = client.VerifyToken(legacyToken)
+	require.NoError(t, err)
+}
+
+func TestVerifyWithRemoteJWKS(t *testing.T) {
+	t.Parallel()
+	issuer := newKeysTestAuth(t, "", map[string]stdlibtime.Time{"k1": stdlibtime.Now().Add(-stdlibtime.Hour)})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		raw, err := json.Marshal(issuer.JWKS())
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+		_, _ = writer.Write(raw) //nolint:errcheck // .
+	}))
+	defer server.Close()
+	verifier := newKeysTestAuth(t, "", nil)
+	verifier.remoteKeys = jwks.NewCache(server.URL, 0)
+
+	_, accessToken, err := issuer.GenerateTokens(time.Now(), "user", "device", "a@b.c", 0, 1, "app", nil)
+	require.NoError(t, err)
+	token, err := verifier.VerifyToken(accessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user", token.UserID)
+	_, _, err = verifier.GenerateTokens(time.Now(), "user", "device", "a@b.c", 0, 1, "app", nil)
+	require.Error(t, err)
+}
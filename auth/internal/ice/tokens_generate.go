@@ -3,13 +3,19 @@
 package iceauth //nolint:revive //.
 
 import (
+	"strings"
+	stdlibtime "time"
+
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 
 	"github.com/ice-blockchain/wintr/auth/internal"
 	"github.com/ice-blockchain/wintr/time"
 )
 
+// GenerateTokens generates a pair of tokens that share the same id (jti), so that they can be revoked together.
+//
 //nolint:revive // .
 func (a *auth) GenerateTokens(
 	now *time.Time,
@@ -19,19 +25,21 @@ func (a *auth) GenerateTokens(
 	role string,
 	extra map[string]any,
 ) (refreshToken, accessToken string, err error) {
-	refreshToken, err = a.generateRefreshToken(now, userID, deviceUniqueID, email, seq, extra)
+	tokenID := uuid.NewString()
+	refreshToken, err = a.generateRefreshToken(now, tokenID, userID, deviceUniqueID, email, seq, extra)
 	if err != nil {
 		return "", "", errors.Wrapf(err, "failed to generate jwt refreshToken for userID:%v", userID)
 	}
-	accessToken, err = a.generateAccessToken(now, seq, hashCode, userID, deviceUniqueID, email, role, extra)
+	accessToken, err = a.generateAccessToken(now, tokenID, seq, hashCode, userID, deviceUniqueID, email, role, extra)
 
 	return refreshToken, accessToken, errors.Wrapf(err, "failed to generate jwt accessToken for userID:%v", userID)
 }
 
 //nolint:revive // .
-func (a *auth) generateRefreshToken(now *time.Time, userID, deviceUniqueID, email string, seq int64, extra map[string]any) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Token{
+func (a *auth) generateRefreshToken(now *time.Time, tokenID, userID, deviceUniqueID, email string, seq int64, extra map[string]any) (string, error) {
+	refreshToken, err := a.signToken(*now.Time, Token{
 		RegisteredClaims: &jwt.RegisteredClaims{
+			ID:        tokenID,
 			Issuer:    internal.RefreshJwtIssuer,
 			Subject:   userID,
 			ExpiresAt: jwt.NewNumericDate(now.Add(a.cfg.WintrAuthIce.RefreshExpirationTime)),
@@ -43,20 +51,20 @@ func (a *auth) generateRefreshToken(now *time.Time, userID, deviceUniqueID, emai
 		DeviceUniqueID: deviceUniqueID,
 		Claims:         extra,
 	})
-	refreshToken, err := a.signToken(token)
 
 	return refreshToken, errors.Wrapf(err, "failed to generate refresh token for userID:%v, email:%v, deviceUniqueId:%v", userID, email, deviceUniqueID)
 }
 
 //nolint:revive // Fields.
 func (a *auth) generateAccessToken(
-	now *time.Time, refreshTokenSeq, hashCode int64,
+	now *time.Time, tokenID string, refreshTokenSeq, hashCode int64,
 	userID, deviceUniqueID, email string,
 	role string,
 	extra map[string]any,
 ) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Token{
+	tokenStr, err := a.signToken(*now.Time, Token{
 		RegisteredClaims: &jwt.RegisteredClaims{
+			ID:        tokenID,
 			Issuer:    internal.AccessJwtIssuer,
 			Subject:   userID,
 			ExpiresAt: jwt.NewNumericDate(now.Add(a.cfg.WintrAuthIce.AccessExpirationTime)),
@@ -70,17 +78,56 @@ func (a *auth) generateAccessToken(
 		Seq:            refreshTokenSeq,
 		Claims:         extra,
 	})
-	tokenStr, err := a.signToken(token)
 
 	return tokenStr, errors.Wrapf(err, "failed to generate access token for userID:%v, email:%v, deviceUniqueId:%v", userID, email, deviceUniqueID)
 }
 
-func (a *auth) GenerateMetadata(now *time.Time, tokenID string, metadata map[string]any) (string, error) {
+func (a *auth) UpgradeAccessToken(now *time.Time, accessToken string, extra map[string]any) (string, error) {
+	var token Token
+	if err := a.VerifyTokenFields(accessToken, &token); err != nil {
+		return "", errors.Wrapf(err, "invalid access token:%v", accessToken)
+	}
+	if token.Issuer != internal.AccessJwtIssuer {
+		return "", errors.Wrapf(ErrWrongTypeToken, "non-access token: %v", token.Issuer)
+	}
+	claims := make(map[string]any, len(token.Claims)+len(extra))
+	for k, v := range token.Claims {
+		claims[k] = v
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	token.Claims = claims
+	tokenStr, err := a.signToken(*now.Time, token)
+
+	return tokenStr, errors.Wrapf(err, "failed to upgrade access token for userID:%v, deviceUniqueId:%v", token.Subject, token.DeviceUniqueID)
+}
+
+func (a *auth) GenerateServiceToken(now *time.Time, clientID string, scopes []string, ttl stdlibtime.Duration) (string, error) {
+	tokenStr, err := a.signToken(*now.Time, ServiceToken{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    internal.ServiceJwtIssuer,
+			Subject:   clientID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			NotBefore: jwt.NewNumericDate(*now.Time),
+			IssuedAt:  jwt.NewNumericDate(*now.Time),
+		},
+		Scope: strings.Join(scopes, " "),
+	})
+
+	return tokenStr, errors.Wrapf(err, "failed to generate service token for clientID:%v", clientID)
+}
+
+func (a *auth) GenerateMetadata(now *time.Time, tokenID, deviceUniqueID string, metadata map[string]any) (string, error) {
 	metadata["sub"] = tokenID
 	metadata["iss"] = internal.MetadataIssuer
 	metadata["iat"] = jwt.NewNumericDate(*now.Time)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(metadata))
-	tokenStr, err := a.signToken(token)
+	metadata["jti"] = uuid.NewString()
+	if deviceUniqueID != "" {
+		metadata["aud"] = deviceUniqueID
+	}
+	tokenStr, err := a.signToken(*now.Time, jwt.MapClaims(metadata))
 
 	return tokenStr, errors.Wrapf(err, "failed to generate metadata token for payload tokenID:%v, metadata:%#v", tokenID, metadata)
 }
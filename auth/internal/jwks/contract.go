@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package jwks
+
+import (
+	"net/http"
+	"sync"
+	stdlibtime "time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+// Public API.
+
+var (
+	ErrKeyNotFound          = errors.New("key not found")
+	ErrUnsupportedAlgorithm = errors.New("unsupported algorithm")
+)
+
+type (
+	// Set is a JSON Web Key Set, as defined by RFC 7517.
+	Set struct {
+		Keys []*Key `json:"keys"`
+	}
+	// Key is a public JSON Web Key. Only EC (P-256, P-384, P-521), OKP (Ed25519) and RSA keys are supported.
+	// ice keys are EC or OKP; RSA keys come only from the OIDC providers.
+	Key struct {
+		KID string `json:"kid,omitempty"`
+		Kty string `json:"kty"`
+		Alg string `json:"alg,omitempty"`
+		Use string `json:"use,omitempty"`
+		Crv string `json:"crv,omitempty"`
+		X   string `json:"x,omitempty"`
+		Y   string `json:"y,omitempty"`
+		N   string `json:"n,omitempty"`
+		E   string `json:"e,omitempty"`
+	}
+	// Cache keeps the keys of a remote JWKS in memory. They're refreshed periodically and, at most once every minResyncInterval,
+	// when an unknown key is requested, so that newly rotated keys are picked up right away.
+	// Concurrent refreshes share a single request, which never blocks the lookups of known keys.
+	Cache struct {
+		fetchedAt   stdlibtime.Time
+		attemptedAt stdlibtime.Time
+		client      *http.Client
+		keys        map[string]*Key
+		refresh     singleflight.Group
+		url         string
+		ttl         stdlibtime.Duration
+		mx          sync.RWMutex
+	}
+)
+
+// Private API.
+
+const (
+	ktyEC              = "EC"
+	ktyOKP             = "OKP"
+	ktyRSA             = "RSA"
+	crvEd25519         = "Ed25519"
+	useSignature       = "sig"
+	defaultTTL         = stdlibtime.Hour
+	minResyncInterval  = stdlibtime.Minute
+	fetchTimeout       = 10 * stdlibtime.Second
+	maxJWKSSizeInBytes = 1 << 20
+)
@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/http"
+	stdlibtime "time"
+
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+// NewKey builds the public JWK of the key, used to verify signatures made with the `alg` algorithm.
+func NewKey(kid, alg string, publicKey crypto.PublicKey) (*Key, error) {
+	key := &Key{KID: kid, Alg: alg, Use: useSignature}
+	switch pub := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		raw, err := pub.Bytes()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid ecdsa public key %v", kid)
+		}
+		size := (len(raw) - 1) / 2 //nolint:mnd // It's 0x04 || X || Y.
+		key.Kty, key.Crv = ktyEC, pub.Curve.Params().Name
+		key.X, key.Y = base64.RawURLEncoding.EncodeToString(raw[1:1+size]), base64.RawURLEncoding.EncodeToString(raw[1+size:])
+	case ed25519.PublicKey:
+		key.Kty, key.Crv, key.X = ktyOKP, crvEd25519, base64.RawURLEncoding.EncodeToString(pub)
+	case *rsa.PublicKey:
+		key.Kty = ktyRSA
+		key.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		key.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	default:
+		return nil, errors.Wrapf(ErrUnsupportedAlgorithm, "unsupported public key type %T for %v", publicKey, kid)
+	}
+
+	return key, nil
+}
+
+// PublicKey decodes the key to *ecdsa.PublicKey, ed25519.PublicKey or *rsa.PublicKey.
+func (k *Key) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case ktyEC:
+		var curve elliptic.Curve
+		switch k.Crv {
+		case elliptic.P256().Params().Name:
+			curve = elliptic.P256()
+		case elliptic.P384().Params().Name:
+			curve = elliptic.P384()
+		case elliptic.P521().Params().Name:
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Wrapf(ErrUnsupportedAlgorithm, "unsupported curve %v for %v", k.Crv, k.KID)
+		}
+		x, xErr := base64.RawURLEncoding.DecodeString(k.X)
+		y, yErr := base64.RawURLEncoding.DecodeString(k.Y)
+		if xErr != nil || yErr != nil {
+			return nil, errors.Errorf("invalid coordinates for %v", k.KID)
+		}
+		pub, err := ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...)) //nolint:mnd // It's the uncompressed form.
+
+		return pub, errors.Wrapf(err, "invalid ecdsa public key %v", k.KID)
+	case ktyOKP:
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if k.Crv != crvEd25519 || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.Wrapf(ErrUnsupportedAlgorithm, "invalid or unsupported OKP key %v", k.KID)
+		}
+
+		return ed25519.PublicKey(x), nil
+	case ktyRSA:
+		n, nErr := base64.RawURLEncoding.DecodeString(k.N)
+		e, eErr := base64.RawURLEncoding.DecodeString(k.E)
+		if nErr != nil || eErr != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.Errorf("invalid modulus or exponent for %v", k.KID)
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	default:
+		return nil, errors.Wrapf(ErrUnsupportedAlgorithm, "unsupported key type %v for %v", k.Kty, k.KID)
+	}
+}
+
+// Key returns the key with the specified id, or nil if there's none.
+func (s *Set) Key(kid string) *Key {
+	for _, key := range s.Keys {
+		if key.KID == kid {
+			return key
+		}
+	}
+
+	return nil
+}
+
+// NewCache builds a cache for the JWKS served at url. If ttl is 0, keys are refreshed every hour.
+func NewCache(url string, ttl stdlibtime.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+
+	return &Cache{url: url, ttl: ttl, client: &http.Client{Timeout: fetchTimeout}}
+}
+
+// Key returns the key with the specified id, fetching the JWKS again if it's stale or if the key isn't known yet.
+// Known keys are served right away, even while the JWKS is being refreshed in the background.
+func (c *Cache) Key(ctx context.Context, kid string) (*Key, error) {
+	c.mx.RLock()
+	now := stdlibtime.Now()
+	key, found := c.keys[kid]
+	fresh, recentlyAttempted := now.Sub(c.fetchedAt) < c.ttl, now.Sub(c.attemptedAt) < minResyncInterval
+	c.mx.RUnlock()
+	if found && (fresh || recentlyAttempted) {
+		return key, nil
+	}
+	if !found && recentlyAttempted {
+		return nil, errors.Wrapf(ErrKeyNotFound, "no key %v at %v", kid, c.url)
+	}
+	refreshed := c.refresh.DoChan(c.url, func() (any, error) {
+		return nil, c.sync(context.WithoutCancel(ctx))
+	})
+	if found {
+		return key, nil
+	}
+	select {
+	case <-ctx.Done():
+		return nil, errors.Wrapf(ctx.Err(), "context ended while fetching %v", c.url)
+	case res := <-refreshed:
+		if res.Err != nil {
+			return nil, errors.Wrapf(res.Err, "failed to fetch %v", c.url)
+		}
+	}
+	c.mx.RLock()
+	key, found = c.keys[kid]
+	c.mx.RUnlock()
+	if !found {
+		return nil, errors.Wrapf(ErrKeyNotFound, "no key %v at %v", kid, c.url)
+	}
+
+	return key, nil
+}
+
+func (c *Cache) sync(ctx context.Context) error {
+	now := stdlibtime.Now()
+	c.mx.Lock()
+	c.attemptedAt = now
+	c.mx.Unlock()
+	set, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]*Key, len(set.Keys))
+	for _, k := range set.Keys {
+		keys[k.KID] = k
+	}
+	c.mx.Lock()
+	c.fetchedAt, c.keys = now, keys
+	c.mx.Unlock()
+
+	return nil
+}
+
+func (c *Cache) fetch(ctx context.Context) (*Set, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, http.NoBody)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to build request for %v", c.url)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "request to %v failed", c.url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %v from %v", resp.StatusCode, c.url)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSizeInBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read response from %v", c.url)
+	}
+	set := new(Set)
+
+	return set, errors.Wrapf(json.UnmarshalContext(ctx, body, set), "invalid JWKS at %v", c.url)
+}
@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	stdlibtime "time"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRoundTrip(t *testing.T) {
+	t.Parallel()
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048) //nolint:mnd // .
+	require.NoError(t, err)
+
+	for alg, publicKey := range map[string]crypto.PublicKey{"ES256": &ecKey.PublicKey, "EdDSA": edPublicKey, "RS256": &rsaKey.PublicKey} {
+		key, kErr := NewKey("kid-"+alg, alg, publicKey)
+		require.NoError(t, kErr)
+		assert.Equal(t, "sig", key.Use)
+		raw, kErr := json.Marshal(&Set{Keys: []*Key{key}})
+		require.NoError(t, kErr)
+		var set Set
+		require.NoError(t, json.Unmarshal(raw, &set))
+		require.NotNil(t, set.Key("kid-"+alg))
+		assert.Nil(t, set.Key("bogus"))
+		decoded, kErr := set.Key("kid-" + alg).PublicKey()
+		require.NoError(t, kErr)
+		assert.True(t, publicKey.(interface{ Equal(x crypto.PublicKey) bool }).Equal(decoded), alg) //nolint:forcetypeassert,errcheck // They all have it.
+	}
+
+	_, err = (&Key{Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"}).PublicKey()
+	require.Error(t, err)
+	_, err = (&Key{Kty: "oct"}).PublicKey()
+	require.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+}
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+	edPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := NewKey("k1", "EdDSA", edPublicKey)
+	require.NoError(t, err)
+	var fetches atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		raw, mErr := json.Marshal(&Set{Keys: []*Key{key}})
+		if mErr != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+		_, _ = writer.Write(raw) //nolint:errcheck // .
+	}))
+	defer server.Close()
+
+	cache := NewCache(server.URL, 0)
+	found, err := cache.Key(t.Context(), "k1")
+	require.NoError(t, err)
+	assert.Equal(t, key, found)
+	_, err = cache.Key(t.Context(), "k1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), fetches.Load())
+
+	_, err = cache.Key(t.Context(), "k2")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+	assert.Equal(t, int64(1), fetches.Load(), "unknown keys shouldn't be fetched more than once per minute")
+
+	cache.attemptedAt = cache.attemptedAt.Add(-minResyncInterval)
+	_, err = cache.Key(t.Context(), "k2")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+	assert.Equal(t, int64(2), fetches.Load())
+}
+
+func TestCacheServesKnownKeysWhileFetching(t *testing.T) {
+	t.Parallel()
+	edPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := NewKey("k1", "EdDSA", edPublicKey)
+	require.NoError(t, err)
+	var fetches atomic.Int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		raw, mErr := json.Marshal(&Set{Keys: []*Key{key}})
+		if mErr != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+		_, _ = writer.Write(raw) //nolint:errcheck // .
+	}))
+	defer server.Close()
+
+	cache := NewCache(server.URL, 0)
+	_, err = cache.Key(t.Context(), "k1")
+	require.NoError(t, err)
+	cache.attemptedAt = cache.attemptedAt.Add(-minResyncInterval)
+	unknown := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, kErr := cache.Key(context.Background(), "k2")
+			unknown <- kErr
+		}()
+	}
+	require.Eventually(t, func() bool { return fetches.Load() == 2 }, stdlibtime.Second, stdlibtime.Millisecond)
+
+	found, err := cache.Key(t.Context(), "k1")
+	require.NoError(t, err)
+	assert.Equal(t, key, found)
+	close(release)
+	require.ErrorIs(t, <-unknown, ErrKeyNotFound)
+	require.ErrorIs(t, <-unknown, ErrKeyNotFound)
+	assert.Equal(t, int64(2), fetches.Load(), "concurrent fetches should be shared")
+}
@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package oidcauth //nolint:revive //.
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	stdlibtime "time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+
+	"github.com/ice-blockchain/wintr/auth/internal"
+	"github.com/ice-blockchain/wintr/auth/internal/jwks"
+)
+
+// Public API.
+
+var (
+	ErrUnknownIssuer = errors.New("unknown issuer")
+	ErrInvalidToken  = errors.New("invalid token")
+)
+
+type (
+	// Client verifies the ID tokens of the configured OpenID Connect providers, i.e. Apple, Google or Telegram, using their published keys.
+	Client interface {
+		// Detect reports if the token claims to be issued by one of the configured providers. The token isn't verified.
+		Detect(token string) bool
+		VerifyToken(ctx context.Context, token string) (*internal.Token, error)
+	}
+)
+
+// Private API.
+
+type (
+	oidc struct {
+		providers map[string]*provider // By issuer.
+	}
+	provider struct {
+		attemptedAt stdlibtime.Time
+		cfg         *providerConfig
+		keys        *jwks.Cache
+		client      *http.Client
+		mx          sync.Mutex
+	}
+	providerConfig struct {
+		// Name is the Provider of the verified tokens, i.e. `apple`, `google`.
+		Name   string `yaml:"name" mapstructure:"name"`
+		Issuer string `yaml:"issuer" mapstructure:"issuer"`
+		// JWKSURL skips the discovery of the keys of the provider, via `<Issuer>/.well-known/openid-configuration`.
+		JWKSURL string `yaml:"jwksUrl" mapstructure:"jwksUrl"` //nolint:tagliatelle // Nope.
+		// Audiences are the client ids of the applications. The tokens must be issued for one of them.
+		Audiences []string `yaml:"audiences" mapstructure:"audiences"`
+		// Claims maps the claims of the tokens to the user id and email, which default to `sub` and `email`, and to the role.
+		// The role isn't mapped by default, because it would let the provider decide the roles of the users in our apps.
+		Claims struct {
+			UserID string `yaml:"userId" mapstructure:"userId"`
+			Email  string `yaml:"email" mapstructure:"email"`
+			Role   string `yaml:"role" mapstructure:"role"`
+		} `yaml:"claims" mapstructure:"claims"`
+		KeysCacheTTL stdlibtime.Duration `yaml:"keysCacheTTL" mapstructure:"keysCacheTTL"` //nolint:tagliatelle // Nope.
+	}
+	config struct {
+		WintrAuthOIDC struct {
+			Providers []*providerConfig `yaml:"providers" mapstructure:"providers"`
+		} `yaml:"wintr/auth/oidc" mapstructure:"wintr/auth/oidc"` //nolint:tagliatelle // Nope.
+	}
+	discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"` //nolint:tagliatelle // It's the standard.
+	}
+)
+
+const (
+	discoveryPath           = "/.well-known/openid-configuration"
+	discoveryTimeout        = 10 * stdlibtime.Second
+	minDiscoveryInterval    = stdlibtime.Minute
+	maxDiscoverySizeInBytes = 1 << 20
+	allowedClockSkew        = 30 * stdlibtime.Second
+	defaultUserIDClaim      = "sub"
+	defaultEmailClaim       = "email"
+	emailVerifiedClaim      = "email_verified"
+	signatureUse            = "sig"
+)
+
+//nolint:gochecknoglobals // It's immutable.
+var supportedSigningMethods = []string{
+	jwt.SigningMethodRS256.Alg(), jwt.SigningMethodRS384.Alg(), jwt.SigningMethodRS512.Alg(),
+	jwt.SigningMethodPS256.Alg(), jwt.SigningMethodPS384.Alg(), jwt.SigningMethodPS512.Alg(),
+	jwt.SigningMethodES256.Alg(), jwt.SigningMethodES384.Alg(), jwt.SigningMethodES512.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}
@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package oidcauth //nolint:revive //.
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	stdlibtime "time"
+
+	"github.com/goccy/go-json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+
+	"github.com/ice-blockchain/wintr/auth/internal"
+	"github.com/ice-blockchain/wintr/auth/internal/jwks"
+	appcfg "github.com/ice-blockchain/wintr/config"
+	"github.com/ice-blockchain/wintr/log"
+)
+
+// New builds the client of the providers configured under `wintr/auth/oidc`, or returns nil if there are none.
+func New(applicationYAMLKey string) Client {
+	var cfg config
+	appcfg.MustLoadFromKey(applicationYAMLKey, &cfg)
+	if len(cfg.WintrAuthOIDC.Providers) == 0 {
+		return nil
+	}
+
+	return newOIDC(&cfg)
+}
+
+func newOIDC(cfg *config) *oidc {
+	providers := make(map[string]*provider, len(cfg.WintrAuthOIDC.Providers))
+	for ix, providerCfg := range cfg.WintrAuthOIDC.Providers {
+		if providerCfg.Name == "" || providerCfg.Issuer == "" || len(providerCfg.Audiences) == 0 {
+			log.Panic(errors.Errorf("oidc provider #%v requires a name, an issuer and at least one audience", ix))
+		}
+		if _, duplicate := providers[providerCfg.Issuer]; duplicate {
+			log.Panic(errors.Errorf("oidc issuer %v is configured more than once", providerCfg.Issuer))
+		}
+		providerCfg.setDefaults()
+		providers[providerCfg.Issuer] = &provider{cfg: providerCfg, client: &http.Client{Timeout: discoveryTimeout}}
+		if providerCfg.JWKSURL != "" {
+			providers[providerCfg.Issuer].keys = jwks.NewCache(providerCfg.JWKSURL, providerCfg.KeysCacheTTL)
+		}
+	}
+
+	return &oidc{providers: providers}
+}
+
+func (cfg *providerConfig) setDefaults() {
+	if cfg.Claims.UserID == "" {
+		cfg.Claims.UserID = defaultUserIDClaim
+	}
+	if cfg.Claims.Email == "" {
+		cfg.Claims.Email = defaultEmailClaim
+	}
+}
+
+func (o *oidc) Detect(token string) bool {
+	_, found := o.providers[unverifiedIssuer(token)]
+
+	return found
+}
+
+func (o *oidc) VerifyToken(ctx context.Context, token string) (*internal.Token, error) {
+	iss := unverifiedIssuer(token)
+	prov, found := o.providers[iss]
+	if !found {
+		return nil, errors.Wrapf(ErrUnknownIssuer, "no oidc provider for issuer `%v`", iss)
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, prov.verificationKey(ctx),
+		jwt.WithValidMethods(supportedSigningMethods),
+		jwt.WithIssuer(prov.cfg.Issuer),
+		jwt.WithAudience(prov.cfg.Audiences...),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(allowedClockSkew),
+	); err != nil {
+		return nil, errors.Wrapf(err, "invalid %v token", prov.cfg.Name)
+	}
+
+	return prov.token(claims)
+}
+
+func (p *provider) token(claims jwt.MapClaims) (*internal.Token, error) {
+	userID, _ := claims[p.cfg.Claims.UserID].(string) //nolint:errcheck,revive // It's checked below.
+	if userID == "" {
+		return nil, errors.Wrapf(ErrInvalidToken, "%v token has no `%v` claim", p.cfg.Name, p.cfg.Claims.UserID)
+	}
+	email, _ := claims[p.cfg.Claims.Email].(string) //nolint:errcheck,revive // Not needed.
+	if verified, found := claims[emailVerifiedClaim]; found && verified != true && verified != "true" {
+		email = "" // Apple sends it as a string.
+	}
+	var role string
+	if p.cfg.Claims.Role != "" {
+		role, _ = claims[p.cfg.Claims.Role].(string) //nolint:errcheck,revive // Not needed.
+	}
+
+	return &internal.Token{
+		Claims:   claims,
+		UserID:   userID,
+		Email:    email,
+		Role:     role,
+		Provider: p.cfg.Name,
+	}, nil
+}
+
+func (p *provider) verificationKey(ctx context.Context) func(token *jwt.Token) (any, error) {
+	return func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string) //nolint:errcheck,revive // It's checked by the cache.
+		keys, err := p.jwks(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't get the keys of %v", p.cfg.Name)
+		}
+		key, err := keys.Key(ctx, kid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't get key %v of %v", kid, p.cfg.Name)
+		}
+		if (key.Alg != "" && key.Alg != token.Method.Alg()) || (key.Use != "" && key.Use != signatureUse) {
+			return nil, errors.Wrapf(ErrInvalidToken, "key %v of %v can't verify %v tokens", kid, p.cfg.Name, token.Method.Alg())
+		}
+		publicKey, err := key.PublicKey()
+
+		return publicKey, errors.Wrapf(err, "invalid key %v of %v", kid, p.cfg.Name)
+	}
+}
+
+// jwks discovers, once, where the keys of the provider are published. Failed discoveries are retried at most once every minDiscoveryInterval.
+func (p *provider) jwks(ctx context.Context) (*jwks.Cache, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	if p.keys != nil {
+		return p.keys, nil
+	}
+	now := stdlibtime.Now()
+	if now.Sub(p.attemptedAt) < minDiscoveryInterval {
+		return nil, errors.Errorf("discovery of %v failed recently", p.cfg.Issuer)
+	}
+	p.attemptedAt = now
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to discover %v", p.cfg.Issuer)
+	}
+	p.keys = jwks.NewCache(doc.JWKSURI, p.cfg.KeysCacheTTL)
+
+	return p.keys, nil
+}
+
+func (p *provider) discover(ctx context.Context) (*discovery, error) {
+	url := strings.TrimSuffix(p.cfg.Issuer, "/") + discoveryPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to build request for %v", url)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "request to %v failed", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %v from %v", resp.StatusCode, url)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDiscoverySizeInBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read response from %v", url)
+	}
+	doc := new(discovery)
+	if err = json.UnmarshalContext(ctx, body, doc); err != nil {
+		return nil, errors.Wrapf(err, "invalid discovery document at %v", url)
+	}
+	if doc.Issuer != p.cfg.Issuer || doc.JWKSURI == "" {
+		return nil, errors.Errorf("discovery document at %v is for issuer `%v`, with jwks_uri `%v`", url, doc.Issuer, doc.JWKSURI)
+	}
+
+	return doc, nil
+}
+
+func unverifiedIssuer(token string) string {
+	claims := jwt.MapClaims{}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, claims)
+	if err != nil || !slices.Contains(supportedSigningMethods, parsed.Method.Alg()) {
+		return ""
+	}
+	iss, _ := claims.GetIssuer() //nolint:errcheck // Not needed.
+
+	return iss
+}
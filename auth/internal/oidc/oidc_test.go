@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package oidcauth //nolint:revive //.
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	stdlibtime "time"
+
+	"github.com/goccy/go-json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/auth/internal/jwks"
+)
+
+type (
+	oidcStub struct {
+		*httptest.Server
+		keys        map[string]crypto.Signer
+		methods     map[string]jwt.SigningMethod
+		issuer      string
+		discoveries atomic.Int64
+	}
+)
+
+func newOIDCStub(t *testing.T) *oidcStub {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048) //nolint:mnd // .
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	stub := &oidcStub{
+		keys:    map[string]crypto.Signer{"rsa": rsaKey, "ec": ecKey},
+		methods: map[string]jwt.SigningMethod{"rsa": jwt.SigningMethodRS256, "ec": jwt.SigningMethodES256},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+discoveryPath, func(writer http.ResponseWriter, _ *http.Request) {
+		stub.discoveries.Add(1)
+		stub.write(t, writer, &discovery{Issuer: stub.issuer, JWKSURI: stub.URL + "/keys"})
+	})
+	mux.HandleFunc("GET /keys", func(writer http.ResponseWriter, _ *http.Request) {
+		set := new(jwks.Set)
+		for kid, key := range stub.keys {
+			jwk, kErr := jwks.NewKey(kid, stub.methods[kid].Alg(), key.Public())
+			require.NoError(t, kErr)
+			set.Keys = append(set.Keys, jwk)
+		}
+		stub.write(t, writer, set)
+	})
+	stub.Server = httptest.NewServer(mux)
+	stub.issuer = stub.URL
+	t.Cleanup(stub.Close)
+
+	return stub
+}
+
+func (s *oidcStub) write(t *testing.T, writer http.ResponseWriter, body any) {
+	t.Helper()
+	raw, err := json.Marshal(body)
+	require.NoError(t, err)
+	_, err = writer.Write(raw)
+	require.NoError(t, err)
+}
+
+func (s *oidcStub) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	now := stdlibtime.Now()
+	defaults := jwt.MapClaims{"iss": s.issuer, "aud": "app", "sub": "user1", "iat": now.Unix(), "exp": now.Add(stdlibtime.Hour).Unix()}
+	for k, v := range claims {
+		defaults[k] = v
+	}
+	signer := kid
+	if _, found := s.keys[kid]; !found {
+		signer = "rsa"
+	}
+	token := jwt.NewWithClaims(s.methods[signer], defaults)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(s.keys[signer])
+	require.NoError(t, err)
+
+	return signed
+}
+
+func newTestOIDC(issuer string) *oidc {
+	var cfg config
+	cfg.WintrAuthOIDC.Providers = []*providerConfig{{Name: "stub", Issuer: issuer, Audiences: []string{"other", "app"}}}
+	cfg.WintrAuthOIDC.Providers[0].Claims.Role = "role"
+
+	return newOIDC(&cfg)
+}
+
+func TestVerifyTokenWithoutRoleClaim(t *testing.T) {
+	t.Parallel()
+	stub := newOIDCStub(t)
+	var cfg config
+	cfg.WintrAuthOIDC.Providers = []*providerConfig{{Name: "stub", Issuer: stub.issuer, Audiences: []string{"app"}}}
+	verified, err := newOIDC(&cfg).VerifyToken(t.Context(), stub.sign(t, "rsa", jwt.MapClaims{"role": "admin"}))
+	require.NoError(t, err)
+	assert.Empty(t, verified.Role)
+	assert.Equal(t, "admin", verified.Claims["role"])
+}
+
+func TestVerifyToken(t *testing.T) {
+	t.Parallel()
+	stub := newOIDCStub(t)
+	client := newTestOIDC(stub.issuer)
+
+	for _, kid := range []string{"rsa", "ec"} {
+		token := stub.sign(t, kid, jwt.MapClaims{"email": "foo@bar.com", "email_verified": "true", "role": "admin", "nonce": "x"})
+		require.True(t, client.Detect(token))
+		verified, err := client.VerifyToken(t.Context(), token)
+		require.NoError(t, err, kid)
+		assert.Equal(t, "user1", verified.UserID)
+		assert.Equal(t, "foo@bar.com", verified.Email)
+		assert.Equal(t, "admin", verified.Role)
+		assert.Equal(t, "stub", verified.Provider)
+		assert.Equal(t, "x", verified.Claims["nonce"])
+	}
+	assert.Equal(t, int64(1), stub.discoveries.Load())
+
+	verified, err := client.VerifyToken(t.Context(), stub.sign(t, "rsa", jwt.MapClaims{"email": "foo@bar.com", "email_verified": false}))
+	require.NoError(t, err)
+	assert.Empty(t, verified.Email)
+
+	for name, claims := range map[string]jwt.MapClaims{
+		"audience":  {"aud": "bogus"},
+		"expired":   {"exp": stdlibtime.Now().Add(-stdlibtime.Hour).Unix()},
+		"no expiry": {"exp": nil},
+		"no sub":    {"sub": ""},
+	} {
+		_, err = client.VerifyToken(t.Context(), stub.sign(t, "rsa", claims))
+		require.Error(t, err, name)
+	}
+	_, err = client.VerifyToken(t.Context(), stub.sign(t, "bogus", nil))
+	require.ErrorIs(t, err, jwks.ErrKeyNotFound)
+
+	foreign := stub.sign(t, "rsa", jwt.MapClaims{"iss": "https://bogus.com"})
+	assert.False(t, client.Detect(foreign))
+	_, err = client.VerifyToken(t.Context(), foreign)
+	require.ErrorIs(t, err, ErrUnknownIssuer)
+	assert.False(t, client.Detect("bogus"))
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	t.Parallel()
+	stub := newOIDCStub(t)
+	client := newTestOIDC(stub.issuer)
+	stub.issuer = "https://bogus.com"
+	token := stub.sign(t, "rsa", jwt.MapClaims{"iss": stub.URL})
+	_, err := client.VerifyToken(t.Context(), token)
+	require.Error(t, err)
+	_, err = client.VerifyToken(t.Context(), token)
+	require.Error(t, err)
+	assert.Equal(t, int64(1), stub.discoveries.Load())
+}
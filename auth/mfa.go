@@ -0,0 +1,265 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	stdlibtime "time"
+
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+
+	iceauth "github.com/ice-blockchain/wintr/auth/internal/ice"
+	"github.com/ice-blockchain/wintr/connectors/storage/v3"
+	"github.com/ice-blockchain/wintr/time"
+)
+
+//nolint:gochecknoglobals // It's immutable.
+var incrementMFAAttemptsScript = redis.NewScript(`
+local attempts = redis.call('INCR', KEYS[1])
+if attempts == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return attempts
+`)
+
+// WithMFAStore enables TOTP enrollments, using the provided store, regardless of the config.
+func WithMFAStore(store MFAStore) Option {
+	return func(a *auth) {
+		a.mfaStore = store
+	}
+}
+
+func (cfg *config) setMFADefaults() {
+	mfa := &cfg.WintrAuthIce.MFA
+	if mfa.MaxAttempts <= 0 {
+		mfa.MaxAttempts = defaultMFAMaxAttempts
+	}
+	if mfa.LockoutDuration <= 0 {
+		mfa.LockoutDuration = defaultMFALockoutDuration
+	}
+}
+
+// MFAAuthTime returns when the user of the token passed a second factor, or nil if it didn't.
+func MFAAuthTime(token *Token) *time.Time {
+	if token == nil {
+		return nil
+	}
+	mfa, isMap := token.Claims[MFAClaim].(map[string]any)
+	if !isMap {
+		return nil
+	}
+	switch authTime := mfa["authTime"].(type) {
+	case float64:
+		return time.New(stdlibtime.Unix(int64(authTime), 0))
+	case int64:
+		return time.New(stdlibtime.Unix(authTime, 0))
+	default:
+		return nil
+	}
+}
+
+// RequireMFA fails with ErrMFARequired if the user of the (verified) token didn't pass a second factor in the last maxAge.
+func RequireMFA(token *Token, now *time.Time, maxAge stdlibtime.Duration) error {
+	authTime := MFAAuthTime(token)
+	if authTime == nil {
+		return errors.Wrap(ErrMFARequired, "token has no second factor")
+	}
+	if now.Sub(*authTime.Time) > maxAge {
+		return errors.Wrapf(ErrMFARequired, "second factor passed at %v, more than %v ago", authTime, maxAge)
+	}
+
+	return nil
+}
+
+func (a *auth) UpgradeWithMFA(ctx context.Context, now *time.Time, accessToken, method string) (string, error) {
+	if _, err := iceauth.DetectIceToken(accessToken); err != nil {
+		return "", errors.Wrap(ErrWrongTypeToken, "only ice access tokens can be upgraded")
+	}
+	upgraded, err := a.ice.UpgradeAccessToken(now, accessToken, map[string]any{MFAClaim: map[string]any{"method": method, "authTime": now.Unix()}})
+	if err != nil {
+		return "", errors.Wrapf(err, "can't upgrade ice token:%v", accessToken)
+	}
+	if err = a.checkRevoked(ctx, accessToken); err != nil {
+		return "", errors.Wrapf(err, "can't upgrade ice token:%v", accessToken)
+	}
+
+	return upgraded, nil
+}
+
+func (a *auth) EnrollTOTP(ctx context.Context, userID, account string) (string, error) {
+	if a.mfaStore == nil || a.totp == nil {
+		return "", errors.Wrapf(ErrMFADisabled, "can't enroll user %v", userID)
+	}
+	existing, err := a.mfaStore.GetMFAEnrollment(ctx, userID)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get second factor of user %v", userID)
+	}
+	if existing != nil && existing.EnrolledAt != nil {
+		return "", errors.Wrapf(ErrMFAAlreadyEnrolled, "user %v enrolled at %v", userID, existing.EnrolledAt)
+	}
+	enrollment := &MFAEnrollment{Secret: rand.Text()}
+	if err = a.mfaStore.SaveMFAEnrollment(ctx, userID, enrollment, pendingMFAEnrollmentTimeout); err != nil {
+		return "", errors.Wrapf(err, "failed to save pending second factor of user %v", userID)
+	}
+
+	return a.totp.GenerateURI(enrollment.Secret, account), nil
+}
+
+func (a *auth) ConfirmTOTP(ctx context.Context, now *time.Time, accessToken, code string) (string, error) {
+	userID, enrollment, err := a.mfaEnrollmentOfToken(ctx, accessToken)
+	if err != nil {
+		return "", err
+	}
+	if enrollment.EnrolledAt != nil {
+		return "", errors.Wrapf(ErrMFAAlreadyEnrolled, "user %v enrolled at %v", userID, enrollment.EnrolledAt)
+	}
+	if err = a.checkTOTPCode(ctx, now, userID, enrollment, code); err != nil {
+		return "", errors.Wrapf(err, "can't confirm second factor of user %v", userID)
+	}
+	enrollment.EnrolledAt = now
+	if err = a.mfaStore.SaveMFAEnrollment(ctx, userID, enrollment, 0); err != nil {
+		return "", errors.Wrapf(err, "failed to save second factor of user %v", userID)
+	}
+
+	return a.UpgradeWithMFA(ctx, now, accessToken, MFAMethodTOTP)
+}
+
+func (a *auth) StepUpTOTP(ctx context.Context, now *time.Time, accessToken, code string) (string, error) {
+	userID, enrollment, err := a.mfaEnrollmentOfToken(ctx, accessToken)
+	if err != nil {
+		return "", err
+	}
+	if enrollment.EnrolledAt == nil {
+		return "", errors.Wrapf(ErrMFANotEnrolled, "second factor of user %v is not confirmed yet", userID)
+	}
+	if err = a.checkTOTPCode(ctx, now, userID, enrollment, code); err != nil {
+		return "", errors.Wrapf(err, "can't verify second factor of user %v", userID)
+	}
+	if err = a.mfaStore.SaveMFAEnrollment(ctx, userID, enrollment, 0); err != nil {
+		return "", errors.Wrapf(err, "failed to save second factor of user %v", userID)
+	}
+
+	return a.UpgradeWithMFA(ctx, now, accessToken, MFAMethodTOTP)
+}
+
+func (a *auth) DisableTOTP(ctx context.Context, userID string) error {
+	if a.mfaStore == nil {
+		return errors.Wrapf(ErrMFADisabled, "can't disable second factor of user %v", userID)
+	}
+
+	return errors.Wrapf(a.mfaStore.DeleteMFAEnrollment(ctx, userID), "failed to delete second factor of user %v", userID)
+}
+
+func (a *auth) MFAEnrollment(ctx context.Context, userID string) (*MFAEnrollment, error) {
+	if a.mfaStore == nil {
+		return nil, errors.Wrapf(ErrMFADisabled, "can't get second factor of user %v", userID)
+	}
+	enrollment, err := a.mfaStore.GetMFAEnrollment(ctx, userID)
+
+	return enrollment, errors.Wrapf(err, "failed to get second factor of user %v", userID)
+}
+
+func (a *auth) mfaEnrollmentOfToken(ctx context.Context, accessToken string) (string, *MFAEnrollment, error) {
+	if a.mfaStore == nil || a.totp == nil {
+		return "", nil, errors.Wrap(ErrMFADisabled, "can't verify second factor")
+	}
+	token, err := a.VerifyToken(ctx, accessToken)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "can't verify token:%v", accessToken)
+	}
+	enrollment, err := a.mfaStore.GetMFAEnrollment(ctx, token.UserID)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to get second factor of user %v", token.UserID)
+	}
+	if enrollment == nil {
+		return "", nil, errors.Wrapf(ErrMFANotEnrolled, "user %v has no second factor", token.UserID)
+	}
+
+	return token.UserID, enrollment, nil
+}
+
+// checkTOTPCode verifies the code and records it as used, atomically, so that it can't be replayed, not even concurrently, while it's still valid.
+// Every attempt is counted, so that the codes can't be brute forced: after MaxAttempts in LockoutDuration, the user is locked out for the rest of it.
+func (a *auth) checkTOTPCode(ctx context.Context, now *time.Time, userID string, enrollment *MFAEnrollment, code string) error {
+	mfaCfg := &a.cfg.WintrAuthIce.MFA
+	attempts, err := a.mfaStore.IncrementMFAAttempts(ctx, userID, mfaCfg.LockoutDuration)
+	if err != nil {
+		return errors.Wrapf(err, "failed to count the second factor attempt of user %v", userID)
+	}
+	if attempts > mfaCfg.MaxAttempts {
+		return errors.Wrapf(ErrMFALocked, "user %v tried %v codes in %v", userID, attempts-1, mfaCfg.LockoutDuration)
+	}
+	if !a.totp.Verify(now, enrollment.Secret, code) {
+		return errors.Wrapf(ErrInvalidMFACode, "code doesn't match, attempt %v", attempts)
+	}
+	firstUse, err := a.mfaStore.UseMFACode(ctx, userID, code, now.Unix()/int64(mfaCodeStep/stdlibtime.Second), mfaCodeReuseWindow)
+	if err != nil {
+		return errors.Wrapf(err, "failed to record the second factor code of user %v as used", userID)
+	}
+	if !firstUse {
+		return errors.Wrap(ErrInvalidMFACode, "code was already used")
+	}
+	if err = a.mfaStore.ResetMFAAttempts(ctx, userID); err != nil {
+		return errors.Wrapf(err, "failed to reset the second factor attempts of user %v", userID)
+	}
+	enrollment.LastUsedAt = now
+
+	return nil
+}
+
+// NewRedisMFAStore builds an MFAStore backed by storage/v3.
+func NewRedisMFAStore(db storage.DB) MFAStore {
+	return &redisMFAStore{db: db}
+}
+
+func (s *redisMFAStore) SaveMFAEnrollment(ctx context.Context, userID string, enrollment *MFAEnrollment, ttl stdlibtime.Duration) error {
+	val, err := json.MarshalContext(ctx, enrollment)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode second factor of user %v", userID)
+	}
+
+	return errors.Wrapf(s.db.Set(ctx, mfaKeyPrefix+userID, val, ttl).Err(), "failed to save second factor of user %v", userID)
+}
+
+func (s *redisMFAStore) GetMFAEnrollment(ctx context.Context, userID string) (*MFAEnrollment, error) {
+	val, err := s.db.Get(ctx, mfaKeyPrefix+userID).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil //nolint:nilnil // There's none.
+		}
+
+		return nil, errors.Wrapf(err, "failed to get second factor of user %v", userID)
+	}
+	enrollment := new(MFAEnrollment)
+
+	return enrollment, errors.Wrapf(json.UnmarshalContext(ctx, val, enrollment), "failed to decode second factor of user %v", userID)
+}
+
+func (s *redisMFAStore) DeleteMFAEnrollment(ctx context.Context, userID string) error {
+	return errors.Wrapf(s.db.Del(ctx, mfaKeyPrefix+userID).Err(), "failed to delete second factor of user %v", userID)
+}
+
+func (s *redisMFAStore) UseMFACode(ctx context.Context, userID, code string, step int64, ttl stdlibtime.Duration) (bool, error) {
+	key := fmt.Sprintf("%v%v:%v:%v", usedMFACodeKeyPrefix, userID, step, code)
+	firstUse, err := s.db.SetNX(ctx, key, "", ttl).Result()
+
+	return firstUse, errors.Wrapf(err, "failed to record second factor code of user %v as used", userID)
+}
+
+func (s *redisMFAStore) IncrementMFAAttempts(ctx context.Context, userID string, ttl stdlibtime.Duration) (int64, error) {
+	attempts, err := incrementMFAAttemptsScript.Run(ctx, s.db, []string{mfaAttemptsKeyPrefix + userID}, ttl.Milliseconds()).Int64()
+
+	return attempts, errors.Wrapf(err, "failed to increment the second factor attempts of user %v", userID)
+}
+
+func (s *redisMFAStore) ResetMFAAttempts(ctx context.Context, userID string) error {
+	return errors.Wrapf(s.db.Del(ctx, mfaAttemptsKeyPrefix+userID).Err(), "failed to reset the second factor attempts of user %v", userID)
+}
+
+func (s *redisMFAStore) Close() error {
+	return errors.Wrap(s.db.Close(), "failed to close second factor store storage")
+}
@@ -0,0 +1,280 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	stdlibtime "time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/time"
+	"github.com/ice-blockchain/wintr/totp"
+)
+
+type (
+	mfaTestStore struct {
+		enrollments map[string]*MFAEnrollment
+		usedCodes   map[string]struct{}
+		attempts    map[string]int64
+		mx          sync.Mutex
+	}
+	mfaTestDB struct {
+		*redis.Client
+	}
+)
+
+func newMFATestClient(t *testing.T) *auth {
+	t.Helper()
+	cl := newRevocationTestClient(t)
+	cl.cfg.setMFADefaults()
+	store := &mfaTestStore{enrollments: make(map[string]*MFAEnrollment), usedCodes: make(map[string]struct{}), attempts: make(map[string]int64)}
+	cl.mfaStore, cl.totp = store, totp.New(testApplicationYAMLKey)
+
+	return cl
+}
+
+func TestTOTPStepUp(t *testing.T) {
+	t.Parallel()
+	cl := newMFATestClient(t)
+	userID, now := uuid.NewString(), time.New(time.Now().Add(-stdlibtime.Second))
+	_, accessToken, err := cl.GenerateTokens(now, userID, "device1", "foo@bar.com", 0, 1, "app")
+	require.NoError(t, err)
+	token, err := cl.VerifyToken(t.Context(), accessToken)
+	require.NoError(t, err)
+	require.ErrorIs(t, RequireMFA(token, now, stdlibtime.Hour), ErrMFARequired)
+
+	_, err = cl.StepUpTOTP(t.Context(), now, accessToken, "123456")
+	require.ErrorIs(t, err, ErrMFANotEnrolled)
+	uri, err := cl.EnrollTOTP(t.Context(), userID, "foo@bar.com")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/"))
+	enrollment, err := cl.MFAEnrollment(t.Context(), userID)
+	require.NoError(t, err)
+	require.Nil(t, enrollment.EnrolledAt)
+	_, err = cl.StepUpTOTP(t.Context(), now, accessToken, cl.totp.GenerateCode(now, enrollment.Secret))
+	require.ErrorIs(t, err, ErrMFANotEnrolled)
+
+	code := cl.totp.GenerateCode(now, enrollment.Secret)
+	_, err = cl.ConfirmTOTP(t.Context(), now, accessToken, nextTOTPCode(code))
+	require.ErrorIs(t, err, ErrInvalidMFACode)
+	upgradedToken, err := cl.ConfirmTOTP(t.Context(), now, accessToken, code)
+	require.NoError(t, err)
+	token, err = cl.VerifyToken(t.Context(), upgradedToken)
+	require.NoError(t, err)
+	assert.Equal(t, userID, token.UserID)
+	require.NoError(t, RequireMFA(token, now, stdlibtime.Minute))
+	require.ErrorIs(t, RequireMFA(token, time.New(now.Add(stdlibtime.Hour)), stdlibtime.Minute), ErrMFARequired)
+	assert.Equal(t, now.Unix(), MFAAuthTime(token).Unix())
+
+	_, err = cl.StepUpTOTP(t.Context(), now, accessToken, code)
+	require.ErrorIs(t, err, ErrInvalidMFACode)
+	later := time.New(now.Add(stdlibtime.Minute))
+	upgradedToken, err = cl.StepUpTOTP(t.Context(), later, upgradedToken, cl.totp.GenerateCode(later, enrollment.Secret))
+	require.NoError(t, err)
+	token, err = cl.VerifyToken(t.Context(), upgradedToken)
+	require.NoError(t, err)
+	assert.Equal(t, later.Unix(), MFAAuthTime(token).Unix())
+
+	_, err = cl.EnrollTOTP(t.Context(), userID, "foo@bar.com")
+	require.ErrorIs(t, err, ErrMFAAlreadyEnrolled)
+	require.NoError(t, cl.DisableTOTP(t.Context(), userID))
+	enrollment, err = cl.MFAEnrollment(t.Context(), userID)
+	require.NoError(t, err)
+	assert.Nil(t, enrollment)
+}
+
+func TestTOTPStepUpLockout(t *testing.T) {
+	t.Parallel()
+	cl := newMFATestClient(t)
+	userID, now := uuid.NewString(), time.New(time.Now().Add(-stdlibtime.Second))
+	_, accessToken, err := cl.GenerateTokens(now, userID, "device1", "foo@bar.com", 0, 1, "app")
+	require.NoError(t, err)
+	_, err = cl.EnrollTOTP(t.Context(), userID, "foo@bar.com")
+	require.NoError(t, err)
+	enrollment, err := cl.MFAEnrollment(t.Context(), userID)
+	require.NoError(t, err)
+	code := cl.totp.GenerateCode(now, enrollment.Secret)
+	_, err = cl.ConfirmTOTP(t.Context(), now, accessToken, nextTOTPCode(code))
+	require.ErrorIs(t, err, ErrInvalidMFACode)
+	_, err = cl.ConfirmTOTP(t.Context(), now, accessToken, code)
+	require.NoError(t, err)
+
+	later := time.New(now.Add(stdlibtime.Minute))
+	code = cl.totp.GenerateCode(later, enrollment.Secret)
+	for range cl.cfg.WintrAuthIce.MFA.MaxAttempts {
+		_, err = cl.StepUpTOTP(t.Context(), later, accessToken, nextTOTPCode(code))
+		require.ErrorIs(t, err, ErrInvalidMFACode)
+	}
+	_, err = cl.StepUpTOTP(t.Context(), later, accessToken, code)
+	require.ErrorIs(t, err, ErrMFALocked)
+}
+
+func TestUpgradeWithMFARevokedToken(t *testing.T) {
+	t.Parallel()
+	cl := newMFATestClient(t)
+	now := time.New(time.Now().Add(-stdlibtime.Second))
+	_, accessToken, err := cl.GenerateTokens(now, "bogus", "device1", "foo@bar.com", 0, 1, "app")
+	require.NoError(t, err)
+	require.NoError(t, cl.RevokeUser(t.Context(), "bogus"))
+	_, err = cl.UpgradeWithMFA(t.Context(), now, accessToken, MFAMethodTOTP)
+	require.ErrorIs(t, err, ErrRevokedToken)
+	_, err = cl.UpgradeWithMFA(t.Context(), now, "bogus", MFAMethodTOTP)
+	require.ErrorIs(t, err, ErrWrongTypeToken)
+}
+
+func TestTOTPStepUpConcurrentReplay(t *testing.T) {
+	t.Parallel()
+	cl := newMFATestClient(t)
+	userID, now := uuid.NewString(), time.New(time.Now().Add(-stdlibtime.Second))
+	_, accessToken, err := cl.GenerateTokens(now, userID, "device1", "foo@bar.com", 0, 1, "app")
+	require.NoError(t, err)
+	_, err = cl.EnrollTOTP(t.Context(), userID, "foo@bar.com")
+	require.NoError(t, err)
+	enrollment, err := cl.MFAEnrollment(t.Context(), userID)
+	require.NoError(t, err)
+	_, err = cl.ConfirmTOTP(t.Context(), now, accessToken, cl.totp.GenerateCode(now, enrollment.Secret))
+	require.NoError(t, err)
+
+	later := time.New(now.Add(stdlibtime.Minute))
+	code := cl.totp.GenerateCode(later, enrollment.Secret)
+	const attempts = 10
+	cl.cfg.WintrAuthIce.MFA.MaxAttempts = attempts
+	var wg sync.WaitGroup
+	var succeeded atomic.Int64
+	for range attempts {
+		wg.Go(func() {
+			if _, stepUpErr := cl.StepUpTOTP(t.Context(), later, accessToken, code); stepUpErr == nil {
+				succeeded.Add(1)
+			} else {
+				assert.ErrorIs(t, stepUpErr, ErrInvalidMFACode)
+			}
+		})
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, succeeded.Load())
+}
+
+func (*mfaTestDB) IsRW(context.Context) bool {
+	return true
+}
+
+func TestRedisMFAStoreUseMFACode(t *testing.T) {
+	t.Parallel()
+	mr := miniredis.RunT(t)
+	store := NewRedisMFAStore(&mfaTestDB{Client: redis.NewClient(&redis.Options{Addr: mr.Addr()})})
+	defer func() { require.NoError(t, store.Close()) }()
+	firstUse, err := store.UseMFACode(t.Context(), "bogus", "123456", 1, mfaCodeReuseWindow)
+	require.NoError(t, err)
+	assert.True(t, firstUse)
+	firstUse, err = store.UseMFACode(t.Context(), "bogus", "123456", 1, mfaCodeReuseWindow)
+	require.NoError(t, err)
+	assert.False(t, firstUse)
+	firstUse, err = store.UseMFACode(t.Context(), "bogus", "123456", 2, mfaCodeReuseWindow)
+	require.NoError(t, err)
+	assert.True(t, firstUse)
+	firstUse, err = store.UseMFACode(t.Context(), "other", "123456", 1, mfaCodeReuseWindow)
+	require.NoError(t, err)
+	assert.True(t, firstUse)
+	mr.FastForward(mfaCodeReuseWindow)
+	firstUse, err = store.UseMFACode(t.Context(), "bogus", "123456", 1, mfaCodeReuseWindow)
+	require.NoError(t, err)
+	assert.True(t, firstUse)
+}
+
+func TestRedisMFAStoreAttempts(t *testing.T) {
+	t.Parallel()
+	mr := miniredis.RunT(t)
+	store := NewRedisMFAStore(&mfaTestDB{Client: redis.NewClient(&redis.Options{Addr: mr.Addr()})})
+	defer func() { require.NoError(t, store.Close()) }()
+	for expected := range int64(3) {
+		attempts, err := store.IncrementMFAAttempts(t.Context(), "bogus", stdlibtime.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, expected+1, attempts)
+	}
+	mr.FastForward(stdlibtime.Minute)
+	attempts, err := store.IncrementMFAAttempts(t.Context(), "bogus", stdlibtime.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), attempts)
+	require.NoError(t, store.ResetMFAAttempts(t.Context(), "bogus"))
+	attempts, err = store.IncrementMFAAttempts(t.Context(), "bogus", stdlibtime.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), attempts)
+}
+
+func nextTOTPCode(code string) string {
+	digits := []byte(code)
+	digits[0] = '0' + (digits[0]-'0'+1)%10
+
+	return string(digits)
+}
+
+func (s *mfaTestStore) SaveMFAEnrollment(_ context.Context, userID string, enrollment *MFAEnrollment, _ stdlibtime.Duration) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	stored := *enrollment
+	s.enrollments[userID] = &stored
+
+	return nil
+}
+
+func (s *mfaTestStore) GetMFAEnrollment(_ context.Context, userID string) (*MFAEnrollment, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	enrollment, found := s.enrollments[userID]
+	if !found {
+		return nil, nil //nolint:nilnil // There's none.
+	}
+	stored := *enrollment
+
+	return &stored, nil
+}
+
+func (s *mfaTestStore) DeleteMFAEnrollment(_ context.Context, userID string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	delete(s.enrollments, userID)
+
+	return nil
+}
+
+func (s *mfaTestStore) UseMFACode(_ context.Context, userID, code string, step int64, _ stdlibtime.Duration) (bool, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	key := fmt.Sprintf("%v:%v:%v", userID, step, code)
+	if _, found := s.usedCodes[key]; found {
+		return false, nil
+	}
+	s.usedCodes[key] = struct{}{}
+
+	return true, nil
+}
+
+func (s *mfaTestStore) IncrementMFAAttempts(_ context.Context, userID string, _ stdlibtime.Duration) (int64, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.attempts[userID]++
+
+	return s.attempts[userID], nil
+}
+
+func (s *mfaTestStore) ResetMFAAttempts(_ context.Context, userID string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	delete(s.attempts, userID)
+
+	return nil
+}
+
+func (*mfaTestStore) Close() error {
+	return nil
+}
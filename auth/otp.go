@@ -0,0 +1,316 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	stdlibtime "time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ice-blockchain/wintr/connectors/storage/v3"
+	"github.com/ice-blockchain/wintr/email"
+	"github.com/ice-blockchain/wintr/log"
+	"github.com/ice-blockchain/wintr/sms"
+	"github.com/ice-blockchain/wintr/time"
+)
+
+//nolint:gochecknoglobals // It's immutable.
+var incrementOTPAttemptsScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+return redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+`)
+
+// WithOTPStore enables one-time codes, using the provided store, regardless of the config.
+func WithOTPStore(store OTPStore) Option {
+	return func(a *auth) {
+		a.otpStore = store
+	}
+}
+
+// WithOTPSender sets how one-time codes are delivered. Use OTPSenders to support both emails and SMSs.
+func WithOTPSender(sender OTPSender) Option {
+	return func(a *auth) {
+		a.otpSender = sender
+	}
+}
+
+func (cfg *config) setOTPDefaults(applicationYAMLKey string) {
+	otp := &cfg.WintrAuthIce.OTP
+	if otp.Secret == "" {
+		module := strings.ToUpper(strings.ReplaceAll(strings.ReplaceAll(applicationYAMLKey, "-", "_"), "/", "_"))
+		if otp.Secret = os.Getenv(module + "_OTP_SECRET"); otp.Secret == "" {
+			otp.Secret = os.Getenv("OTP_SECRET")
+		}
+	}
+	if otp.Length <= 0 {
+		otp.Length = defaultOTPLength
+	}
+	if otp.MaxAttempts <= 0 {
+		otp.MaxAttempts = defaultOTPMaxAttempts
+	}
+	if otp.Expiration <= 0 {
+		otp.Expiration = defaultOTPExpiration
+	}
+	if otp.LockoutDuration <= 0 {
+		otp.LockoutDuration = defaultOTPLockoutDuration
+	}
+	if otp.ResendInterval <= 0 {
+		otp.ResendInterval = defaultOTPResendInterval
+	}
+}
+
+func (a *auth) IssueOTP(ctx context.Context, channel OTPChannel, recipient string) error {
+	if a.otpStore == nil || a.otpSender == nil {
+		return errors.Wrapf(ErrOTPDisabled, "can't issue one-time code for %v", recipient)
+	}
+	key, now := otpKey(channel, recipient), time.Now()
+	existing, err := a.otpStore.GetOTP(ctx, key)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get one-time code of %v", recipient)
+	}
+	if existing != nil {
+		if existing.LockedUntil != nil && existing.LockedUntil.After(*now.Time) {
+			return errors.Wrapf(ErrOTPLocked, "%v is locked until %v", recipient, existing.LockedUntil)
+		}
+		if existing.IssuedAt != nil && now.Sub(*existing.IssuedAt.Time) < a.cfg.WintrAuthIce.OTP.ResendInterval {
+			return errors.Wrapf(ErrOTPTooSoon, "one-time code for %v was already issued at %v", recipient, existing.IssuedAt)
+		}
+	}
+	code, err := a.generateOTPCode()
+	if err != nil {
+		return errors.Wrapf(err, "failed to generate one-time code for %v", recipient)
+	}
+	challenge := &OTPChallenge{
+		IssuedAt:  now,
+		ExpiresAt: time.New(now.Add(a.cfg.WintrAuthIce.OTP.Expiration)),
+		CodeHash:  a.hashOTPCode(key, code),
+	}
+	if existing != nil {
+		challenge.Attempts = existing.Attempts
+	}
+	if err = a.otpStore.SaveOTP(ctx, key, challenge, a.otpChallengeTTL()); err != nil {
+		return errors.Wrapf(err, "failed to save one-time code of %v", recipient)
+	}
+	otp := &OTP{ExpiresAt: challenge.ExpiresAt, Channel: channel, Recipient: recipient, Code: code}
+	if err = a.otpSender.SendOTP(ctx, otp); err != nil {
+		_, dErr := a.otpStore.DeleteOTP(ctx, key)
+
+		return errors.Wrapf(multierror.Append(err, dErr).ErrorOrNil(), "failed to send one-time code to %v", recipient)
+	}
+
+	return nil
+}
+
+func (a *auth) VerifyOTP(ctx context.Context, now *time.Time, login *OTPLogin) (refreshToken, accessToken string, err error) {
+	if a.otpStore == nil {
+		return "", "", errors.Wrapf(ErrOTPDisabled, "can't verify one-time code of %v", login.Recipient)
+	}
+	key := otpKey(login.Channel, login.Recipient)
+	challenge, err := a.otpStore.GetOTP(ctx, key)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to get one-time code of %v", login.Recipient)
+	}
+	if challenge == nil || challenge.CodeHash == "" || (challenge.ExpiresAt != nil && !challenge.ExpiresAt.After(*now.Time)) {
+		if challenge != nil && challenge.LockedUntil != nil && challenge.LockedUntil.After(*now.Time) {
+			return "", "", errors.Wrapf(ErrOTPLocked, "%v is locked until %v", login.Recipient, challenge.LockedUntil)
+		}
+
+		return "", "", errors.Wrapf(ErrInvalidOTP, "there's no pending one-time code for %v", login.Recipient)
+	}
+	attempts, err := a.otpStore.IncrementOTPAttempts(ctx, key)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to count the attempt of %v", login.Recipient)
+	}
+	if attempts == 0 {
+		return "", "", errors.Wrapf(ErrInvalidOTP, "one-time code of %v expired", login.Recipient)
+	}
+	if attempts > a.cfg.WintrAuthIce.OTP.MaxAttempts {
+		return "", "", a.lockOTP(ctx, key, now, login.Recipient)
+	}
+	if !hmac.Equal([]byte(challenge.CodeHash), []byte(a.hashOTPCode(key, login.Code))) {
+		if attempts == a.cfg.WintrAuthIce.OTP.MaxAttempts {
+			return "", "", a.lockOTP(ctx, key, now, login.Recipient)
+		}
+
+		return "", "", errors.Wrapf(ErrInvalidOTP, "invalid one-time code for %v, attempt %v", login.Recipient, attempts)
+	}
+	deleted, err := a.otpStore.DeleteOTP(ctx, key)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to delete one-time code of %v", login.Recipient)
+	}
+	if !deleted {
+		return "", "", errors.Wrapf(ErrInvalidOTP, "one-time code of %v was already used", login.Recipient)
+	}
+	mail := login.Email
+	if login.Channel == OTPChannelEmail {
+		mail = login.Recipient
+	}
+
+	return a.GenerateTokens(now, login.UserID, login.DeviceUniqueID, mail, login.HashCode, login.Seq, login.Role, login.Claims)
+}
+
+// otpChallengeTTL keeps the challenge, and so its attempts, for the whole lockout window, even after its code expires,
+// so that the attempts can't be reset just by requesting new codes.
+func (a *auth) otpChallengeTTL() stdlibtime.Duration {
+	return max(a.cfg.WintrAuthIce.OTP.Expiration, a.cfg.WintrAuthIce.OTP.LockoutDuration)
+}
+
+func (a *auth) lockOTP(ctx context.Context, key string, now *time.Time, recipient string) error {
+	lockedUntil := time.New(now.Add(a.cfg.WintrAuthIce.OTP.LockoutDuration))
+	challenge := &OTPChallenge{IssuedAt: now, LockedUntil: lockedUntil}
+	if err := a.otpStore.SaveOTP(ctx, key, challenge, a.cfg.WintrAuthIce.OTP.LockoutDuration); err != nil {
+		return errors.Wrapf(err, "failed to lock %v", recipient)
+	}
+
+	return errors.Wrapf(ErrOTPLocked, "%v is locked until %v", recipient, lockedUntil)
+}
+
+func (a *auth) generateOTPCode() (string, error) {
+	maxCode := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(a.cfg.WintrAuthIce.OTP.Length)), nil) //nolint:mnd // It's decimal.
+	code, err := rand.Int(rand.Reader, maxCode)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate random number")
+	}
+
+	return fmt.Sprintf("%0*d", a.cfg.WintrAuthIce.OTP.Length, code), nil
+}
+
+// hashOTPCode binds the code to the recipient, so that a leaked hash can't be brute forced without the secret, nor be reused for someone else.
+func (a *auth) hashOTPCode(key, code string) string {
+	mac := hmac.New(sha256.New, []byte(a.cfg.WintrAuthIce.OTP.Secret))
+	mac.Write([]byte(key + ":" + code))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func otpKey(channel OTPChannel, recipient string) string {
+	recipient = strings.TrimSpace(recipient)
+	if channel == OTPChannelEmail {
+		recipient = strings.ToLower(recipient)
+	}
+
+	return string(channel) + ":" + recipient
+}
+
+func (s OTPSenders) SendOTP(ctx context.Context, otp *OTP) error {
+	sender, found := s[otp.Channel]
+	if !found {
+		return errors.Errorf("unsupported one-time code channel `%v`", otp.Channel)
+	}
+
+	return errors.Wrapf(sender.SendOTP(ctx, otp), "failed to send one-time code via %v", otp.Channel)
+}
+
+// NewEmailOTPSender sends the codes by email. The `{{code}}` placeholder of the subject and body is replaced with the code.
+func NewEmailOTPSender(client email.Client, from email.Participant, subject, body string) OTPSender {
+	return &emailOTPSender{client: client, from: from, subject: subject, body: body}
+}
+
+func (s *emailOTPSender) SendOTP(ctx context.Context, otp *OTP) error {
+	parcel := &email.Parcel{
+		From:    s.from,
+		Subject: strings.ReplaceAll(s.subject, otpCodePlaceholder, otp.Code),
+		Body:    &email.Body{Type: email.TextPlain, Data: strings.ReplaceAll(s.body, otpCodePlaceholder, otp.Code)},
+	}
+
+	return errors.Wrapf(s.client.Send(ctx, parcel, email.Participant{Email: otp.Recipient}), "failed to send email to %v", otp.Recipient)
+}
+
+// NewSMSOTPSender sends the codes by SMS. The `{{code}}` placeholder of the message is replaced with the code.
+func NewSMSOTPSender(client sms.Client, message string) OTPSender {
+	return &smsOTPSender{client: client, message: message}
+}
+
+func (s *smsOTPSender) SendOTP(ctx context.Context, otp *OTP) error {
+	parcel := &sms.Parcel{ToNumber: otp.Recipient, Message: strings.ReplaceAll(s.message, otpCodePlaceholder, otp.Code)}
+
+	return errors.Wrapf(s.client.Send(ctx, parcel), "failed to send sms to %v", otp.Recipient)
+}
+
+// NewRedisOTPStore builds an OTPStore backed by storage/v3.
+func NewRedisOTPStore(db storage.DB) OTPStore {
+	return &redisOTPStore{db: db}
+}
+
+func (s *redisOTPStore) SaveOTP(ctx context.Context, key string, challenge *OTPChallenge, ttl stdlibtime.Duration) error {
+	fields := map[string]any{"codeHash": challenge.CodeHash, "attempts": challenge.Attempts}
+	for field, value := range map[string]*time.Time{"issuedAt": challenge.IssuedAt, "expiresAt": challenge.ExpiresAt, "lockedUntil": challenge.LockedUntil} {
+		if value != nil {
+			fields[field] = value.UnixMilli()
+		}
+	}
+	_, err := s.db.TxPipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		if err := pipeliner.Del(ctx, otpKeyPrefix+key).Err(); err != nil {
+			return err //nolint:wrapcheck // It's wrapped outside.
+		}
+		if err := pipeliner.HSet(ctx, otpKeyPrefix+key, fields).Err(); err != nil {
+			return err //nolint:wrapcheck // It's wrapped outside.
+		}
+
+		return pipeliner.PExpire(ctx, otpKeyPrefix+key, ttl).Err() //nolint:wrapcheck // It's wrapped outside.
+	})
+
+	return errors.Wrapf(err, "failed to save one-time code %v", key)
+}
+
+func (s *redisOTPStore) GetOTP(ctx context.Context, key string) (*OTPChallenge, error) {
+	fields, err := s.db.HGetAll(ctx, otpKeyPrefix+key).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get one-time code %v", key)
+	}
+	if len(fields) == 0 {
+		return nil, nil //nolint:nilnil // There's none.
+	}
+	challenge := &OTPChallenge{CodeHash: fields["codeHash"]}
+	if challenge.Attempts, err = strconv.ParseInt(fields["attempts"], 10, 64); err != nil {
+		return nil, errors.Wrapf(err, "invalid attempts `%v` for %v", fields["attempts"], key)
+	}
+	for field, value := range map[string]**time.Time{"issuedAt": &challenge.IssuedAt, "expiresAt": &challenge.ExpiresAt, "lockedUntil": &challenge.LockedUntil} {
+		if fields[field] == "" {
+			continue
+		}
+		millis, pErr := strconv.ParseInt(fields[field], 10, 64)
+		if pErr != nil {
+			return nil, errors.Wrapf(pErr, "invalid %v `%v` for %v", field, fields[field], key)
+		}
+		*value = time.New(stdlibtime.UnixMilli(millis))
+	}
+
+	return challenge, nil
+}
+
+func (s *redisOTPStore) IncrementOTPAttempts(ctx context.Context, key string) (int64, error) {
+	attempts, err := incrementOTPAttemptsScript.Run(ctx, s.db, []string{otpKeyPrefix + key}).Int64()
+
+	return attempts, errors.Wrapf(err, "failed to increment the attempts of %v", key)
+}
+
+func (s *redisOTPStore) DeleteOTP(ctx context.Context, key string) (bool, error) {
+	deleted, err := s.db.Del(ctx, otpKeyPrefix+key).Result()
+
+	return deleted == 1, errors.Wrapf(err, "failed to delete one-time code %v", key)
+}
+
+func (s *redisOTPStore) Close() error {
+	return errors.Wrap(s.db.Close(), "failed to close one-time code store storage")
+}
+
+func (a *auth) mustHaveOTPSecret() {
+	if a.otpStore != nil && a.cfg.WintrAuthIce.OTP.Secret == "" {
+		log.Panic(errors.New("one-time codes require a secret"))
+	}
+}
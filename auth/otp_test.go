@@ -0,0 +1,217 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package auth
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	stdlibtime "time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/email"
+	"github.com/ice-blockchain/wintr/time"
+)
+
+type (
+	otpTestStore struct {
+		challenges map[string]*OTPChallenge
+		mx         sync.Mutex
+	}
+	otpTestSender struct {
+		sent []*OTP
+		mx   sync.Mutex
+	}
+	otpTestEmailClient struct {
+		parcel       *email.Parcel
+		participants []email.Participant
+	}
+)
+
+func newOTPTestClient(t *testing.T) (*auth, *otpTestSender) {
+	t.Helper()
+	cl, sender := newRevocationTestClient(t), new(otpTestSender)
+	cl.cfg.WintrAuthIce.OTP.Secret = "bogus"
+	cl.cfg.setOTPDefaults(testApplicationYAMLKey)
+	cl.otpStore, cl.otpSender = &otpTestStore{challenges: make(map[string]*OTPChallenge)}, OTPSenders{OTPChannelEmail: sender, OTPChannelSMS: sender}
+
+	return cl, sender
+}
+
+func TestOTPLogin(t *testing.T) {
+	t.Parallel()
+	cl, sender := newOTPTestClient(t)
+	userID, recipient := uuid.NewString(), "Foo@Bar.com"
+
+	require.NoError(t, cl.IssueOTP(t.Context(), OTPChannelEmail, recipient))
+	require.ErrorIs(t, cl.IssueOTP(t.Context(), OTPChannelEmail, recipient), ErrOTPTooSoon)
+	otp := sender.last()
+	assert.Equal(t, recipient, otp.Recipient)
+	assert.Len(t, otp.Code, defaultOTPLength)
+	for _, challenge := range cl.otpStore.(*otpTestStore).challenges { //nolint:forcetypeassert,errcheck // We know it.
+		assert.NotContains(t, challenge.CodeHash, otp.Code)
+	}
+
+	login := &OTPLogin{Channel: OTPChannelEmail, Recipient: "foo@bar.com", Code: otp.Code, UserID: userID, DeviceUniqueID: "device1", Role: "app", Seq: 1}
+	_, accessToken, err := cl.VerifyOTP(t.Context(), time.New(time.Now().Add(-stdlibtime.Second)), login)
+	require.NoError(t, err)
+	token, err := cl.VerifyToken(t.Context(), accessToken)
+	require.NoError(t, err)
+	assert.Equal(t, userID, token.UserID)
+	assert.Equal(t, "foo@bar.com", token.Email)
+
+	_, _, err = cl.VerifyOTP(t.Context(), time.Now(), login)
+	require.ErrorIs(t, err, ErrInvalidOTP)
+
+	require.NoError(t, cl.IssueOTP(t.Context(), OTPChannelSMS, "+1234567890"))
+	smsLogin := &OTPLogin{Channel: OTPChannelSMS, Recipient: "+1234567890", Code: sender.last().Code, UserID: userID, Email: "a@b.c", DeviceUniqueID: "device2"}
+	_, accessToken, err = cl.VerifyOTP(t.Context(), time.New(time.Now().Add(-stdlibtime.Second)), smsLogin)
+	require.NoError(t, err)
+	token, err = cl.VerifyToken(t.Context(), accessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "a@b.c", token.Email)
+}
+
+func TestOTPLockout(t *testing.T) {
+	t.Parallel()
+	cl, sender := newOTPTestClient(t)
+	recipient := "foo@bar.com"
+	require.NoError(t, cl.IssueOTP(t.Context(), OTPChannelEmail, recipient))
+	code := sender.last().Code
+	wrongCode := "000000"
+	if code == wrongCode {
+		wrongCode = "111111"
+	}
+	login := &OTPLogin{Channel: OTPChannelEmail, Recipient: recipient, Code: wrongCode, UserID: "bogus", DeviceUniqueID: "device1"}
+	for range defaultOTPMaxAttempts - 1 {
+		_, _, err := cl.VerifyOTP(t.Context(), time.Now(), login)
+		require.ErrorIs(t, err, ErrInvalidOTP)
+	}
+	_, _, err := cl.VerifyOTP(t.Context(), time.Now(), login)
+	require.ErrorIs(t, err, ErrOTPLocked)
+
+	login.Code = code
+	_, _, err = cl.VerifyOTP(t.Context(), time.Now(), login)
+	require.ErrorIs(t, err, ErrOTPLocked)
+	require.ErrorIs(t, cl.IssueOTP(t.Context(), OTPChannelEmail, recipient), ErrOTPLocked)
+}
+
+func TestOTPResendKeepsAttempts(t *testing.T) {
+	t.Parallel()
+	cl, sender := newOTPTestClient(t)
+	recipient := "foo@bar.com"
+	store := cl.otpStore.(*otpTestStore) //nolint:forcetypeassert,errcheck // We know it.
+	require.NoError(t, cl.IssueOTP(t.Context(), OTPChannelEmail, recipient))
+	login := &OTPLogin{Channel: OTPChannelEmail, Recipient: recipient, Code: "wrong", UserID: "bogus", DeviceUniqueID: "device1"}
+	for range defaultOTPMaxAttempts - 1 {
+		_, _, err := cl.VerifyOTP(t.Context(), time.Now(), login)
+		require.ErrorIs(t, err, ErrInvalidOTP)
+	}
+
+	key := otpKey(OTPChannelEmail, recipient)
+	store.challenges[key].IssuedAt = time.New(time.Now().Add(-defaultOTPResendInterval))
+	require.NoError(t, cl.IssueOTP(t.Context(), OTPChannelEmail, recipient))
+	assert.Equal(t, int64(defaultOTPMaxAttempts-1), store.challenges[key].Attempts)
+	_, _, err := cl.VerifyOTP(t.Context(), time.Now(), login)
+	require.ErrorIs(t, err, ErrOTPLocked)
+	login.Code = sender.last().Code
+	_, _, err = cl.VerifyOTP(t.Context(), time.Now(), login)
+	require.ErrorIs(t, err, ErrOTPLocked)
+}
+
+func TestOTPExpired(t *testing.T) {
+	t.Parallel()
+	cl, sender := newOTPTestClient(t)
+	require.NoError(t, cl.IssueOTP(t.Context(), OTPChannelEmail, "foo@bar.com"))
+	login := &OTPLogin{Channel: OTPChannelEmail, Recipient: "foo@bar.com", Code: sender.last().Code, UserID: "bogus", DeviceUniqueID: "device1"}
+	_, _, err := cl.VerifyOTP(t.Context(), time.New(time.Now().Add(defaultOTPExpiration)), login)
+	require.ErrorIs(t, err, ErrInvalidOTP)
+
+	cl.otpStore = nil
+	require.ErrorIs(t, cl.IssueOTP(t.Context(), OTPChannelEmail, "foo@bar.com"), ErrOTPDisabled)
+}
+
+func TestEmailOTPSender(t *testing.T) {
+	t.Parallel()
+	client := new(otpTestEmailClient)
+	sender := NewEmailOTPSender(client, email.Participant{Name: "ice", Email: "no-reply@ice.io"}, "Your code is {{code}}", "Use {{code}} to log in.")
+	require.NoError(t, sender.SendOTP(t.Context(), &OTP{Channel: OTPChannelEmail, Recipient: "foo@bar.com", Code: "123456"}))
+	assert.Equal(t, "Your code is 123456", client.parcel.Subject)
+	assert.Equal(t, "Use 123456 to log in.", client.parcel.Body.Data)
+	assert.Equal(t, []email.Participant{{Email: "foo@bar.com"}}, client.participants)
+
+	err := OTPSenders{}.SendOTP(t.Context(), &OTP{Channel: OTPChannelSMS})
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "unsupported"))
+}
+
+func (s *otpTestSender) SendOTP(_ context.Context, otp *OTP) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.sent = append(s.sent, otp)
+
+	return nil
+}
+
+func (s *otpTestSender) last() *OTP {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.sent[len(s.sent)-1]
+}
+
+func (c *otpTestEmailClient) Send(_ context.Context, parcel *email.Parcel, participants ...email.Participant) error {
+	c.parcel, c.participants = parcel, participants
+
+	return nil
+}
+
+func (s *otpTestStore) SaveOTP(_ context.Context, key string, challenge *OTPChallenge, _ stdlibtime.Duration) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	stored := *challenge
+	s.challenges[key] = &stored
+
+	return nil
+}
+
+func (s *otpTestStore) GetOTP(_ context.Context, key string) (*OTPChallenge, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	challenge, found := s.challenges[key]
+	if !found {
+		return nil, nil //nolint:nilnil // There's none.
+	}
+	stored := *challenge
+
+	return &stored, nil
+}
+
+func (s *otpTestStore) IncrementOTPAttempts(_ context.Context, key string) (int64, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	challenge, found := s.challenges[key]
+	if !found {
+		return 0, nil
+	}
+	challenge.Attempts++
+
+	return challenge.Attempts, nil
+}
+
+func (s *otpTestStore) DeleteOTP(_ context.Context, key string) (bool, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	_, found := s.challenges[key]
+	delete(s.challenges, key)
+
+	return found, nil
+}
+
+func (*otpTestStore) Close() error {
+	return nil
+}
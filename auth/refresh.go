@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package auth
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/ice-blockchain/wintr/auth/internal"
+	iceauth "github.com/ice-blockchain/wintr/auth/internal/ice"
+	"github.com/ice-blockchain/wintr/time"
+)
+
+// RefreshTokens rotates the refresh token. The session of the device is the token family: it tracks the id and seq of the latest refresh token,
+// so any other refresh token of the device, that's not expired, was already used and the whole family is revoked.
+func (a *auth) RefreshTokens(
+	ctx context.Context, now *time.Time, refreshToken string, hashCode int64, role string,
+) (newRefreshToken, accessToken string, err error) {
+	claims := new(IceToken)
+	if err = a.ice.VerifyTokenFields(refreshToken, claims); err != nil {
+		return "", "", errors.Wrapf(err, "invalid refresh token:%v", refreshToken)
+	}
+	if claims.Issuer != internal.RefreshJwtIssuer {
+		return "", "", errors.Wrapf(ErrWrongTypeToken, "non-refresh token: %v", claims.Issuer)
+	}
+	if err = a.checkRevoked(ctx, refreshToken); err != nil {
+		return "", "", errors.Wrapf(err, "can't refresh token:%v", refreshToken)
+	}
+	var previousTokenID string
+	if a.revocationStore != nil {
+		current, sErr := a.currentSession(ctx, claims.Subject, claims.DeviceUniqueID)
+		if sErr != nil {
+			return "", "", errors.Wrapf(sErr, "failed to get session %v of user %v", claims.DeviceUniqueID, claims.Subject)
+		}
+		if current != nil {
+			if current.TokenID != claims.ID || current.Seq != claims.Seq {
+				return "", "", a.revokeFamily(ctx, claims)
+			}
+			previousTokenID = current.TokenID
+		}
+	}
+	newRefreshToken, accessToken, err = a.ice.GenerateTokens(now, claims.Subject, claims.DeviceUniqueID, claims.Email, hashCode, claims.Seq+1, role, claims.Claims)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "can't generate tokens for userID:%v, email:%v", claims.Subject, claims.Email)
+	}
+	if a.revocationStore == nil {
+		return newRefreshToken, accessToken, nil
+	}
+	newClaims, err := iceauth.DetectIceToken(newRefreshToken)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to parse new refresh token claims")
+	}
+	swapped, err := a.revocationStore.SwapSession(ctx, claims.Subject, previousTokenID, newSession(newClaims), a.cfg.WintrAuthIce.RefreshExpirationTime)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "can't save session for userID:%v, deviceUniqueID:%v", claims.Subject, claims.DeviceUniqueID)
+	}
+	if !swapped {
+		return "", "", a.revokeFamily(ctx, claims)
+	}
+
+	return newRefreshToken, accessToken, nil
+}
+
+func (a *auth) currentSession(ctx context.Context, userID, deviceUniqueID string) (*Session, error) {
+	sessions, err := a.revocationStore.Sessions(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get sessions of user %v", userID)
+	}
+	for _, session := range sessions {
+		if session.DeviceUniqueID == deviceUniqueID {
+			return session, nil
+		}
+	}
+
+	return nil, nil //nolint:nilnil // It's a new family, i.e. the tokens were issued before revocation was enabled.
+}
+
+func (a *auth) revokeFamily(ctx context.Context, reused *IceToken) error {
+	if err := a.RevokeDevice(ctx, reused.Subject, reused.DeviceUniqueID); err != nil {
+		return errors.Wrapf(err, "failed to revoke the token family of device %v of user %v", reused.DeviceUniqueID, reused.Subject)
+	}
+
+	return errors.Wrapf(ErrRefreshTokenReused, "refresh token %v, with seq %v, of device %v of user %v was already used",
+		reused.ID, reused.Seq, reused.DeviceUniqueID, reused.Subject)
+}
@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package auth
+
+import (
+	"testing"
+	stdlibtime "time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/time"
+)
+
+func TestRefreshTokens(t *testing.T) {
+	t.Parallel()
+	cl, userID := newRevocationTestClient(t), uuid.NewString()
+	refreshToken, accessToken, err := cl.GenerateTokens(time.New(time.Now().Add(-2*stdlibtime.Second)), userID, "device1", "a@b.c", 0, 1, "app", map[string]any{"extra": "extra"}) //nolint:lll // .
+	require.NoError(t, err)
+
+	_, _, err = cl.RefreshTokens(t.Context(), time.Now(), accessToken, 0, "app")
+	require.ErrorIs(t, err, ErrWrongTypeToken)
+
+	newRefreshToken, newAccessToken, err := cl.RefreshTokens(t.Context(), time.New(time.Now().Add(-stdlibtime.Second)), refreshToken, 1, "author")
+	require.NoError(t, err)
+	token, err := cl.VerifyToken(t.Context(), newAccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, userID, token.UserID)
+	assert.Equal(t, "author", token.Role)
+	assert.Equal(t, int64(2), token.Claims["seq"])
+	assert.Equal(t, "extra", token.Claims["extra"])
+	sessions, err := cl.Sessions(t.Context(), userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, int64(2), sessions[0].Seq)
+
+	_, _, err = cl.RefreshTokens(t.Context(), time.Now(), refreshToken, 0, "app")
+	require.ErrorIs(t, err, ErrRefreshTokenReused)
+	_, err = cl.VerifyToken(t.Context(), newAccessToken)
+	require.ErrorIs(t, err, ErrRevokedToken)
+	_, _, err = cl.RefreshTokens(t.Context(), time.Now(), newRefreshToken, 0, "app")
+	require.ErrorIs(t, err, ErrRevokedToken)
+	sessions, err = cl.Sessions(t.Context(), userID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestRefreshTokensWithoutRevocation(t *testing.T) {
+	t.Parallel()
+	cl := newRevocationTestClient(t)
+	cl.revocationStore = nil
+	refreshToken, _, err := cl.GenerateTokens(time.New(time.Now().Add(-stdlibtime.Second)), uuid.NewString(), "device1", "a@b.c", 0, 1, "app")
+	require.NoError(t, err)
+	for range 2 {
+		_, accessToken, rErr := cl.RefreshTokens(t.Context(), time.Now(), refreshToken, 0, "app")
+		require.NoError(t, rErr)
+		token, rErr := cl.VerifyToken(t.Context(), accessToken)
+		require.NoError(t, rErr)
+		assert.Equal(t, int64(2), token.Claims["seq"])
+	}
+}
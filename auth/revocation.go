@@ -0,0 +1,328 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package auth
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	stdlibtime "time"
+
+	"github.com/goccy/go-json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ice-blockchain/wintr/auth/internal"
+	iceauth "github.com/ice-blockchain/wintr/auth/internal/ice"
+	"github.com/ice-blockchain/wintr/connectors/storage/v3"
+	"github.com/ice-blockchain/wintr/time"
+)
+
+//nolint:gochecknoglobals // It's immutable.
+var swapSessionScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], ARGV[1])
+if current then
+	if cjson.decode(current)['tokenId'] ~= ARGV[2] then
+		return 0
+	end
+elseif ARGV[2] ~= '' then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return 1
+`)
+
+//nolint:gochecknoglobals // It's immutable.
+var bindOnceScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if current then
+	return current
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return ARGV[1]
+`)
+
+func (a *auth) RevokeTokenID(ctx context.Context, userID, tokenID string) error {
+	if a.revocationStore == nil {
+		return errors.Errorf("can't revoke token %v, revocation is disabled", tokenID)
+	}
+	if err := a.revocationStore.Revoke(ctx, *time.Now().Time, a.cfg.WintrAuthIce.RefreshExpirationTime, revokedTokenKey(tokenID)); err != nil {
+		return errors.Wrapf(err, "failed to revoke token %v of user %v", tokenID, userID)
+	}
+	sessions, err := a.revocationStore.Sessions(ctx, userID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get sessions of user %v", userID)
+	}
+	devices := make([]string, 0, 1)
+	for _, session := range sessions {
+		if session.TokenID == tokenID {
+			devices = append(devices, session.DeviceUniqueID)
+		}
+	}
+	if len(devices) == 0 {
+		return nil
+	}
+
+	return errors.Wrapf(a.revocationStore.DeleteSessions(ctx, userID, devices...), "failed to delete sessions %#v of user %v", devices, userID)
+}
+
+func (a *auth) RevokeDevice(ctx context.Context, userID, deviceUniqueID string) error {
+	if a.revocationStore == nil {
+		return errors.Errorf("can't revoke device %v of user %v, revocation is disabled", deviceUniqueID, userID)
+	}
+	ttl := a.cfg.WintrAuthIce.RefreshExpirationTime
+	if err := a.revocationStore.Revoke(ctx, *time.Now().Time, ttl, revokedDeviceKey(userID, deviceUniqueID)); err != nil {
+		return errors.Wrapf(err, "failed to revoke device %v of user %v", deviceUniqueID, userID)
+	}
+
+	return errors.Wrapf(a.revocationStore.DeleteSessions(ctx, userID, deviceUniqueID), "failed to delete session %v of user %v", deviceUniqueID, userID)
+}
+
+func (a *auth) RevokeUser(ctx context.Context, userID string) error {
+	if a.revocationStore == nil {
+		return errors.Errorf("can't revoke user %v, revocation is disabled", userID)
+	}
+	if err := a.revocationStore.Revoke(ctx, *time.Now().Time, a.cfg.WintrAuthIce.RefreshExpirationTime, revokedUserKey(userID)); err != nil {
+		return errors.Wrapf(err, "failed to revoke user %v", userID)
+	}
+
+	return errors.Wrapf(a.revocationStore.DeleteSessions(ctx, userID), "failed to delete sessions of user %v", userID)
+}
+
+func (a *auth) RevokeMetadata(ctx context.Context, metadataStr string) error {
+	if a.revocationStore == nil {
+		return errors.New("can't revoke metadata, revocation is disabled")
+	}
+	var metadata jwt.MapClaims
+	if err := a.ice.VerifyTokenFields(metadataStr, &metadata); err != nil {
+		return errors.Wrapf(err, "invalid metadata token:%v", metadataStr)
+	}
+	if metadata["iss"] != internal.MetadataIssuer {
+		return errors.Wrapf(ErrWrongTypeToken, "non-metadata token: %v", metadata["iss"])
+	}
+	tokenID, _ := metadata["jti"].(string) //nolint:errcheck,revive // Not needed.
+	if tokenID == "" {
+		return errors.Errorf("can't revoke metadata without id, issued at %v", metadata["iat"])
+	}
+
+	return errors.Wrapf(a.revocationStore.Revoke(ctx, *time.Now().Time, a.metadataMaxAge(), revokedMetadataKey(tokenID)),
+		"failed to revoke metadata %v", tokenID)
+}
+
+func (a *auth) Sessions(ctx context.Context, userID string) ([]*Session, error) {
+	if a.revocationStore == nil {
+		return nil, errors.Errorf("can't get sessions of user %v, revocation is disabled", userID)
+	}
+	sessions, err := a.revocationStore.Sessions(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get sessions of user %v", userID)
+	}
+	now := time.Now()
+	sessions = slices.DeleteFunc(sessions, func(session *Session) bool {
+		return session.ExpiresAt != nil && !session.ExpiresAt.After(*now.Time)
+	})
+	slices.SortFunc(sessions, func(s1, s2 *Session) int {
+		if s1.IssuedAt == nil || s2.IssuedAt == nil {
+			return 0
+		}
+
+		return s2.IssuedAt.Compare(*s1.IssuedAt.Time)
+	})
+
+	return sessions, nil
+}
+
+// checkRevoked checks if the (already verified) ice token was revoked, either by its id, or because it was issued before its device or user were revoked.
+// `iat` has a precision of one second, so tokens issued in the same second as the revocation of their device or user, are also revoked.
+func (a *auth) checkRevoked(ctx context.Context, token string) error {
+	if a.revocationStore == nil {
+		return nil
+	}
+	claims, err := iceauth.DetectIceToken(token)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse token claims")
+	}
+	keys := []string{revokedUserKey(claims.Subject), revokedDeviceKey(claims.Subject, claims.DeviceUniqueID)}
+	if claims.ID != "" {
+		keys = append(keys, revokedTokenKey(claims.ID))
+	}
+	revokedAt, err := a.revocationStore.RevokedAt(ctx, keys...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to check if token of user %v was revoked", claims.Subject)
+	}
+	for ix, revoked := range revokedAt {
+		if revoked == nil {
+			continue
+		}
+		if ix == len(keys)-1 && claims.ID != "" {
+			return errors.Wrapf(ErrRevokedToken, "token %v was revoked at %v", claims.ID, revoked)
+		}
+		if claims.IssuedAt == nil || !claims.IssuedAt.After(*revoked) {
+			return errors.Wrapf(ErrRevokedToken, "token issued at %v, before %v was revoked at %v", claims.IssuedAt, keys[ix], revoked)
+		}
+	}
+
+	return nil
+}
+
+func (a *auth) saveSession(userID string, tokens ...string) error {
+	if a.revocationStore == nil {
+		return nil
+	}
+	for _, token := range tokens {
+		claims, err := iceauth.DetectIceToken(token)
+		if err != nil {
+			return errors.Wrap(err, "failed to parse token claims")
+		}
+		if claims.Issuer != internal.RefreshJwtIssuer {
+			continue
+		}
+		session := newSession(claims)
+		ctx, cancel := context.WithTimeout(context.Background(), sessionSavingTimeout)
+		err = a.revocationStore.SaveSession(ctx, userID, session, a.cfg.WintrAuthIce.RefreshExpirationTime)
+		cancel()
+
+		return errors.Wrapf(err, "failed to save session %#v", session)
+	}
+
+	return nil
+}
+
+func newSession(refreshToken *IceToken) *Session {
+	session := &Session{DeviceUniqueID: refreshToken.DeviceUniqueID, TokenID: refreshToken.ID, Seq: refreshToken.Seq}
+	if refreshToken.IssuedAt != nil {
+		session.IssuedAt = time.New(refreshToken.IssuedAt.Time)
+	}
+	if refreshToken.ExpiresAt != nil {
+		session.ExpiresAt = time.New(refreshToken.ExpiresAt.Time)
+	}
+
+	return session
+}
+
+func revokedTokenKey(tokenID string) string {
+	return revokedTokenKeyPrefix + tokenID
+}
+
+func revokedDeviceKey(userID, deviceUniqueID string) string {
+	return revokedDeviceKeyPrefix + userID + ":" + deviceUniqueID
+}
+
+func revokedUserKey(userID string) string {
+	return revokedUserKeyPrefix + userID
+}
+
+func revokedMetadataKey(tokenID string) string {
+	return revokedMetadataKeyPrefix + tokenID
+}
+
+func metadataDeviceKey(tokenID string) string {
+	return metadataDeviceKeyPrefix + tokenID
+}
+
+// NewRedisRevocationStore builds a RevocationStore backed by storage/v3.
+func NewRedisRevocationStore(db storage.DB) RevocationStore {
+	return &redisRevocationStore{db: db}
+}
+
+func (s *redisRevocationStore) Revoke(ctx context.Context, revokedAt stdlibtime.Time, ttl stdlibtime.Duration, keys ...string) error {
+	_, err := s.db.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		for _, key := range keys {
+			if err := pipeliner.Set(ctx, key, revokedAt.UnixMilli(), ttl).Err(); err != nil {
+				return err //nolint:wrapcheck // It's wrapped outside.
+			}
+		}
+
+		return nil
+	})
+
+	return errors.Wrapf(err, "failed to revoke %#v", keys)
+}
+
+func (s *redisRevocationStore) RevokedAt(ctx context.Context, keys ...string) ([]*stdlibtime.Time, error) {
+	values, err := s.db.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get %#v", keys)
+	}
+	revokedAt := make([]*stdlibtime.Time, len(values))
+	for ix, value := range values {
+		val, isString := value.(string)
+		if !isString {
+			continue
+		}
+		millis, pErr := strconv.ParseInt(val, 10, 64)
+		if pErr != nil {
+			return nil, errors.Wrapf(pErr, "invalid value `%v` for %v", val, keys[ix])
+		}
+		revoked := stdlibtime.UnixMilli(millis)
+		revokedAt[ix] = &revoked
+	}
+
+	return revokedAt, nil
+}
+
+func (s *redisRevocationStore) SaveSession(ctx context.Context, userID string, session *Session, ttl stdlibtime.Duration) error {
+	val, err := json.MarshalContext(ctx, session)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode %#v", session)
+	}
+	_, err = s.db.TxPipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		if hErr := pipeliner.HSet(ctx, sessionsKeyPrefix+userID, session.DeviceUniqueID, val).Err(); hErr != nil {
+			return hErr //nolint:wrapcheck // It's wrapped outside.
+		}
+
+		return pipeliner.Expire(ctx, sessionsKeyPrefix+userID, ttl).Err() //nolint:wrapcheck // It's wrapped outside.
+	})
+
+	return errors.Wrapf(err, "failed to save session of user %v", userID)
+}
+
+func (s *redisRevocationStore) SwapSession(
+	ctx context.Context, userID, previousTokenID string, session *Session, ttl stdlibtime.Duration,
+) (bool, error) {
+	val, err := json.MarshalContext(ctx, session)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to encode %#v", session)
+	}
+	args := []any{session.DeviceUniqueID, previousTokenID, val, int64(ttl / stdlibtime.Millisecond)}
+	swapped, err := swapSessionScript.Run(ctx, s.db, []string{sessionsKeyPrefix + userID}, args...).Int()
+
+	return swapped == 1, errors.Wrapf(err, "failed to swap session %v of user %v", session.DeviceUniqueID, userID)
+}
+
+func (s *redisRevocationStore) BindOnce(ctx context.Context, key, value string, ttl stdlibtime.Duration) (string, error) {
+	boundTo, err := bindOnceScript.Run(ctx, s.db, []string{key}, value, int64(ttl/stdlibtime.Millisecond)).Text()
+
+	return boundTo, errors.Wrapf(err, "failed to bind %v to %v", key, value)
+}
+
+func (s *redisRevocationStore) DeleteSessions(ctx context.Context, userID string, deviceUniqueIDs ...string) error {
+	if len(deviceUniqueIDs) == 0 {
+		return errors.Wrapf(s.db.Del(ctx, sessionsKeyPrefix+userID).Err(), "failed to delete sessions of user %v", userID)
+	}
+
+	return errors.Wrapf(s.db.HDel(ctx, sessionsKeyPrefix+userID, deviceUniqueIDs...).Err(), "failed to delete sessions %#v of user %v", deviceUniqueIDs, userID)
+}
+
+func (s *redisRevocationStore) Sessions(ctx context.Context, userID string) ([]*Session, error) {
+	values, err := s.db.HGetAll(ctx, sessionsKeyPrefix+userID).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get sessions of user %v", userID)
+	}
+	sessions := make([]*Session, 0, len(values))
+	for device, val := range values {
+		session := new(Session)
+		if err = json.UnmarshalContext(ctx, []byte(val), session); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode session %v of user %v", device, userID)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+func (s *redisRevocationStore) Close() error {
+	return errors.Wrap(s.db.Close(), "failed to close revocation store storage")
+}
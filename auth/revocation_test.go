@@ -0,0 +1,298 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package auth
+
+import (
+	"context"
+	"sync"
+	"testing"
+	stdlibtime "time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/auth/internal"
+	iceauth "github.com/ice-blockchain/wintr/auth/internal/ice"
+	appcfg "github.com/ice-blockchain/wintr/config"
+	"github.com/ice-blockchain/wintr/time"
+)
+
+type (
+	revocationTestStore struct {
+		revoked  map[string]stdlibtime.Time
+		sessions map[string]map[string]*Session
+		bound    map[string]string
+		mx       sync.Mutex
+	}
+)
+
+func newRevocationTestClient(t *testing.T) *auth {
+	t.Helper()
+	var cfg config
+	appcfg.MustLoadFromKey(testApplicationYAMLKey, &cfg)
+
+	return &auth{
+		ice: iceauth.New(testApplicationYAMLKey),
+		cfg: &cfg,
+		revocationStore: &revocationTestStore{
+			revoked:  make(map[string]stdlibtime.Time),
+			sessions: make(map[string]map[string]*Session),
+			bound:    make(map[string]string),
+		},
+	}
+}
+
+func TestRevokeTokenID(t *testing.T) {
+	t.Parallel()
+	cl, userID := newRevocationTestClient(t), uuid.NewString()
+	refreshToken, accessToken, err := cl.GenerateTokens(time.New(time.Now().Add(-stdlibtime.Second)), userID, "device1", "a@b.c", 0, 1, "app")
+	require.NoError(t, err)
+	_, otherAccessToken, err := cl.GenerateTokens(time.New(time.Now().Add(-stdlibtime.Second)), userID, "device2", "a@b.c", 0, 1, "app")
+	require.NoError(t, err)
+	_, err = cl.VerifyToken(t.Context(), accessToken)
+	require.NoError(t, err)
+
+	refresh, err := cl.ParseToken(refreshToken, true)
+	require.NoError(t, err)
+	require.NotEmpty(t, refresh.ID)
+	access, err := cl.ParseToken(accessToken, true)
+	require.NoError(t, err)
+	assert.Equal(t, refresh.ID, access.ID)
+
+	require.NoError(t, cl.RevokeTokenID(t.Context(), userID, refresh.ID))
+	_, err = cl.VerifyToken(t.Context(), accessToken)
+	require.ErrorIs(t, err, ErrRevokedToken)
+	_, err = cl.VerifyToken(t.Context(), otherAccessToken)
+	require.NoError(t, err)
+
+	sessions, err := cl.Sessions(t.Context(), userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "device2", sessions[0].DeviceUniqueID)
+}
+
+func TestRevokeDevice(t *testing.T) {
+	t.Parallel()
+	cl, userID := newRevocationTestClient(t), uuid.NewString()
+	_, accessToken, err := cl.GenerateTokens(time.New(time.Now().Add(-stdlibtime.Second)), userID, "device1", "a@b.c", 0, 1, "app")
+	require.NoError(t, err)
+	_, otherAccessToken, err := cl.GenerateTokens(time.New(time.Now().Add(-stdlibtime.Second)), userID, "device2", "a@b.c", 0, 1, "app")
+	require.NoError(t, err)
+
+	require.NoError(t, cl.RevokeDevice(t.Context(), userID, "device1"))
+	_, err = cl.VerifyToken(t.Context(), accessToken)
+	require.ErrorIs(t, err, ErrRevokedToken)
+	_, err = cl.VerifyToken(t.Context(), otherAccessToken)
+	require.NoError(t, err)
+
+	store := cl.revocationStore.(*revocationTestStore) //nolint:forcetypeassert,errcheck // We know it.
+	store.revoked[revokedDeviceKey(userID, "device1")] = store.revoked[revokedDeviceKey(userID, "device1")].Add(-2 * stdlibtime.Second)
+	_, newAccessToken, err := cl.GenerateTokens(time.Now(), userID, "device1", "a@b.c", 0, 2, "app")
+	require.NoError(t, err)
+	_, err = cl.VerifyToken(t.Context(), newAccessToken)
+	require.NoError(t, err)
+
+	sessions, err := cl.Sessions(t.Context(), userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "device1", sessions[0].DeviceUniqueID)
+	assert.Equal(t, int64(2), sessions[0].Seq)
+	assert.Equal(t, "device2", sessions[1].DeviceUniqueID)
+}
+
+func TestRevokeUser(t *testing.T) {
+	t.Parallel()
+	cl, userID := newRevocationTestClient(t), uuid.NewString()
+	_, accessToken, err := cl.GenerateTokens(time.New(time.Now().Add(-stdlibtime.Second)), userID, "device1", "a@b.c", 0, 1, "app")
+	require.NoError(t, err)
+	_, otherAccessToken, err := cl.GenerateTokens(time.New(time.Now().Add(-stdlibtime.Second)), userID, "device2", "a@b.c", 0, 1, "app")
+	require.NoError(t, err)
+	_, otherUserAccessToken, err := cl.GenerateTokens(time.New(time.Now().Add(-stdlibtime.Second)), uuid.NewString(), "device1", "a@b.c", 0, 1, "app")
+	require.NoError(t, err)
+
+	require.NoError(t, cl.RevokeUser(t.Context(), userID))
+	for _, token := range []string{accessToken, otherAccessToken} {
+		_, err = cl.VerifyToken(t.Context(), token)
+		require.ErrorIs(t, err, ErrRevokedToken)
+	}
+	_, err = cl.VerifyToken(t.Context(), otherUserAccessToken)
+	require.NoError(t, err)
+	sessions, err := cl.Sessions(t.Context(), userID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestRevocationDisabled(t *testing.T) {
+	t.Parallel()
+	cl := newRevocationTestClient(t)
+	cl.revocationStore = nil
+	_, accessToken, err := cl.GenerateTokens(time.Now(), uuid.NewString(), "device1", "a@b.c", 0, 1, "app")
+	require.NoError(t, err)
+	_, err = cl.VerifyToken(t.Context(), accessToken)
+	require.NoError(t, err)
+	require.Error(t, cl.RevokeUser(t.Context(), "bogus"))
+}
+
+func TestMetadataReplay(t *testing.T) {
+	t.Parallel()
+	cl := newRevocationTestClient(t)
+	userID, now := uuid.NewString(), time.Now()
+	device1 := &Token{UserID: userID, Provider: ProviderIce, Claims: map[string]any{"deviceUniqueID": "device1"}}
+	device2 := &Token{UserID: userID, Provider: ProviderIce, Claims: map[string]any{"deviceUniqueID": "device2"}}
+
+	bound, err := cl.GenerateMetadata(now, userID, map[string]any{}, "device1")
+	require.NoError(t, err)
+	_, err = cl.ModifyTokenWithMetadataContext(t.Context(), device1, bound)
+	require.NoError(t, err)
+	_, err = cl.ModifyTokenWithMetadataContext(t.Context(), device2, bound)
+	require.ErrorIs(t, err, ErrMetadataReplayed)
+
+	unbound, err := cl.GenerateMetadata(now, userID, map[string]any{})
+	require.NoError(t, err)
+	_, err = cl.ModifyTokenWithMetadataContext(t.Context(), device2, unbound)
+	require.NoError(t, err)
+	_, err = cl.ModifyTokenWithMetadataContext(t.Context(), device2, unbound)
+	require.NoError(t, err)
+	_, err = cl.ModifyTokenWithMetadataContext(t.Context(), device1, unbound)
+	require.ErrorIs(t, err, ErrMetadataReplayed)
+
+	require.NoError(t, cl.RevokeMetadata(t.Context(), bound))
+	_, err = cl.ModifyTokenWithMetadataContext(t.Context(), device1, bound)
+	require.ErrorIs(t, err, ErrRevokedToken)
+
+	old, err := cl.GenerateMetadata(time.New(now.Add(-cl.metadataMaxAge()-stdlibtime.Minute)), userID, map[string]any{}, "device1")
+	require.NoError(t, err)
+	_, err = cl.ModifyTokenWithMetadataContext(t.Context(), device1, old)
+	require.ErrorIs(t, err, ErrExpiredToken)
+
+	fresh, err := cl.GenerateMetadata(time.New(now.Add(-stdlibtime.Second)), userID, map[string]any{}, "device1")
+	require.NoError(t, err)
+	require.NoError(t, cl.RevokeUser(t.Context(), userID))
+	_, err = cl.ModifyTokenWithMetadataContext(t.Context(), device1, fresh)
+	require.ErrorIs(t, err, ErrRevokedToken)
+}
+
+func TestMetadataWithoutID(t *testing.T) {
+	t.Parallel()
+	cl := newRevocationTestClient(t)
+	userID := uuid.NewString()
+	device1 := &Token{UserID: userID, Provider: ProviderIce, Claims: map[string]any{"deviceUniqueID": "device1"}}
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": userID, "iss": internal.MetadataIssuer, "iat": jwt.NewNumericDate(*time.Now().Time),
+	}).SignedString([]byte("bogus"))
+	require.NoError(t, err)
+	_, err = cl.ModifyTokenWithMetadataContext(t.Context(), device1, legacy)
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	cl.revocationStore = nil
+	_, err = cl.ModifyTokenWithMetadataContext(t.Context(), device1, legacy)
+	require.NoError(t, err)
+	assert.Equal(t, stdlibtime.Hour, cl.metadataMaxAge(), "it shouldn't outlive the refresh tokens")
+}
+
+func TestMetadataWithNonIceTokens(t *testing.T) {
+	t.Parallel()
+	cl := newRevocationTestClient(t)
+	userID := uuid.NewString()
+	firebase := &Token{UserID: userID, Provider: ProviderFirebase}
+	bound, err := cl.GenerateMetadata(time.Now(), userID, map[string]any{}, "device1")
+	require.NoError(t, err)
+	_, err = cl.ModifyTokenWithMetadataContext(t.Context(), firebase, bound)
+	require.NoError(t, err)
+	_, err = cl.ModifyTokenWithMetadataContext(t.Context(), &Token{UserID: userID, Provider: "oidc"}, bound)
+	require.NoError(t, err)
+
+	require.NoError(t, cl.RevokeMetadata(t.Context(), bound))
+	_, err = cl.ModifyTokenWithMetadataContext(t.Context(), firebase, bound)
+	require.ErrorIs(t, err, ErrRevokedToken)
+}
+
+func (s *revocationTestStore) Revoke(_ context.Context, revokedAt stdlibtime.Time, _ stdlibtime.Duration, keys ...string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for _, key := range keys {
+		s.revoked[key] = revokedAt
+	}
+
+	return nil
+}
+
+func (s *revocationTestStore) RevokedAt(_ context.Context, keys ...string) ([]*stdlibtime.Time, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	revokedAt := make([]*stdlibtime.Time, len(keys))
+	for ix, key := range keys {
+		if revoked, found := s.revoked[key]; found {
+			revokedAt[ix] = &revoked
+		}
+	}
+
+	return revokedAt, nil
+}
+
+func (s *revocationTestStore) SaveSession(_ context.Context, userID string, session *Session, _ stdlibtime.Duration) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.sessions[userID] == nil {
+		s.sessions[userID] = make(map[string]*Session)
+	}
+	s.sessions[userID][session.DeviceUniqueID] = session
+
+	return nil
+}
+
+func (s *revocationTestStore) SwapSession(_ context.Context, userID, previousTokenID string, session *Session, _ stdlibtime.Duration) (bool, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	current, found := s.sessions[userID][session.DeviceUniqueID]
+	if (found && current.TokenID != previousTokenID) || (!found && previousTokenID != "") {
+		return false, nil
+	}
+	if s.sessions[userID] == nil {
+		s.sessions[userID] = make(map[string]*Session)
+	}
+	s.sessions[userID][session.DeviceUniqueID] = session
+
+	return true, nil
+}
+
+func (s *revocationTestStore) BindOnce(_ context.Context, key, value string, _ stdlibtime.Duration) (string, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if current, found := s.bound[key]; found {
+		return current, nil
+	}
+	s.bound[key] = value
+
+	return value, nil
+}
+
+func (s *revocationTestStore) DeleteSessions(_ context.Context, userID string, deviceUniqueIDs ...string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if len(deviceUniqueIDs) == 0 {
+		delete(s.sessions, userID)
+	}
+	for _, device := range deviceUniqueIDs {
+		delete(s.sessions[userID], device)
+	}
+
+	return nil
+}
+
+func (s *revocationTestStore) Sessions(_ context.Context, userID string) ([]*Session, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	sessions := make([]*Session, 0, len(s.sessions[userID]))
+	for _, session := range s.sessions[userID] {
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+func (*revocationTestStore) Close() error {
+	return nil
+}
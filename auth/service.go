@@ -0,0 +1,204 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	stdlibtime "time"
+
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+
+	"github.com/ice-blockchain/wintr/time"
+)
+
+func (cfg *config) setServiceDefaults(applicationYAMLKey string) {
+	services := &cfg.WintrAuthIce.Services
+	if services.ExpirationTime <= 0 {
+		services.ExpirationTime = defaultServiceTokenExpiration
+	}
+	module := strings.ToUpper(strings.ReplaceAll(strings.ReplaceAll(applicationYAMLKey, "-", "_"), "/", "_"))
+	for _, client := range services.Clients {
+		if client.Secret == "" {
+			clientID := strings.ToUpper(strings.ReplaceAll(strings.ReplaceAll(client.ID, "-", "_"), "/", "_"))
+			client.Secret = os.Getenv(module + "_" + clientID + "_SERVICE_SECRET")
+		}
+	}
+}
+
+func (a *auth) IssueServiceToken(now *time.Time, credentials *ServiceCredentials, scopes ...string) (*ServiceToken, error) {
+	clientID, granted, err := a.authenticateService(credentials)
+	if err != nil {
+		return nil, err
+	}
+	if len(scopes) == 0 {
+		scopes = granted
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			return nil, errors.Wrapf(ErrInvalidScope, "scope `%v` is not granted to %v", scope, clientID)
+		}
+	}
+	ttl := a.cfg.WintrAuthIce.Services.ExpirationTime
+	token, err := a.ice.GenerateServiceToken(now, clientID, scopes, ttl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't generate service token for %v", clientID)
+	}
+
+	return &ServiceToken{AccessToken: token, TokenType: serviceTokenType, Scope: strings.Join(scopes, " "), ExpiresIn: int64(ttl / stdlibtime.Second)}, nil
+}
+
+func (a *auth) IssuesServiceTokens() bool {
+	return len(a.cfg.WintrAuthIce.Services.Clients) != 0
+}
+
+// authenticateService returns the client id and the scopes of the service, based on its secret or, if it doesn't provide one, on its certificate.
+func (a *auth) authenticateService(credentials *ServiceCredentials) (clientID string, scopes []string, err error) {
+	for _, client := range a.cfg.WintrAuthIce.Services.Clients {
+		switch {
+		case credentials.ClientSecret != "":
+			if client.ID == credentials.ClientID && client.Secret != "" && secretsEqual(client.Secret, credentials.ClientSecret) {
+				return client.ID, client.Scopes, nil
+			}
+		case credentials.Certificate != nil && client.Identity != "":
+			if (credentials.ClientID == "" || client.ID == credentials.ClientID) && certificateHasIdentity(credentials.Certificate, client.Identity) {
+				return client.ID, client.Scopes, nil
+			}
+		}
+	}
+
+	return "", nil, errors.Wrapf(ErrInvalidClient, "can't authenticate service `%v`", credentials.ClientID)
+}
+
+// secretsEqual compares the hashes of the secrets, so that the time it takes doesn't depend on their length either.
+func secretsEqual(expected, actual string) bool {
+	expectedHash, actualHash := sha256.Sum256([]byte(expected)), sha256.Sum256([]byte(actual))
+
+	return subtle.ConstantTimeCompare(expectedHash[:], actualHash[:]) == 1
+}
+
+func certificateHasIdentity(cert *x509.Certificate, identity string) bool {
+	if cert.Subject.CommonName == identity {
+		return true
+	}
+
+	return slices.ContainsFunc(cert.URIs, func(uri *url.URL) bool { return uri.String() == identity })
+}
+
+// ServiceScopes returns the scopes of the (verified) service token, or nil if it's not a service token.
+func ServiceScopes(token *Token) []string {
+	if token == nil || token.Provider != ProviderService {
+		return nil
+	}
+	scope, _ := token.Claims["scope"].(string) //nolint:errcheck,revive // Not needed.
+
+	return strings.Fields(scope)
+}
+
+// RequireScopes fails with ErrMissingScope unless the (verified) token is a service token, with all the scopes.
+func RequireScopes(token *Token, scopes ...string) error {
+	if token == nil || token.Provider != ProviderService {
+		return errors.Wrap(ErrMissingScope, "not a service token")
+	}
+	granted := ServiceScopes(token)
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			return errors.Wrapf(ErrMissingScope, "service %v has no `%v` scope", token.Claims["clientId"], scope)
+		}
+	}
+
+	return nil
+}
+
+// NewServiceTokenSource builds a source of service tokens, got from the tokenURL of the issuing service, via the client credentials grant.
+// If the service uses mTLS, the client certificate has to be configured in the transport of the httpClient and clientSecret can be empty.
+func NewServiceTokenSource(httpClient *http.Client, tokenURL, clientID, clientSecret string, scopes ...string) *ServiceTokenSource {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: serviceTokenFetchTimeout}
+	}
+
+	return &ServiceTokenSource{client: httpClient, tokenURL: tokenURL, clientID: clientID, clientSecret: clientSecret, scopes: scopes}
+}
+
+// Token returns the cached service token or, if it's about to expire, gets a new one.
+func (s *ServiceTokenSource) Token(ctx context.Context) (string, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	now := stdlibtime.Now()
+	if s.token != "" && now.Before(s.expiresAt) {
+		return s.token, nil
+	}
+	resp, err := s.fetch(ctx)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get service token for %v", s.clientID)
+	}
+	lifetime := stdlibtime.Duration(resp.ExpiresIn) * stdlibtime.Second
+	s.token, s.expiresAt = resp.AccessToken, now.Add(lifetime-min(serviceTokenRefreshBefore, lifetime/2)) //nolint:mnd // It's the half.
+
+	return s.token, nil
+}
+
+func (s *ServiceTokenSource) fetch(ctx context.Context) (*ServiceToken, error) {
+	form := url.Values{"grant_type": {"client_credentials"}, "client_id": {s.clientID}}
+	if s.clientSecret != "" {
+		form.Set("client_secret", s.clientSecret)
+	}
+	if len(s.scopes) != 0 {
+		form.Set("scope", strings.Join(s.scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to build request for %v", s.tokenURL)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "request to %v failed", s.tokenURL)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxServiceTokenResponseSizeInBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read response from %v", s.tokenURL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %v from %v: %s", resp.StatusCode, s.tokenURL, body)
+	}
+	token := new(ServiceToken)
+	if err = json.UnmarshalContext(ctx, body, token); err != nil {
+		return nil, errors.Wrapf(err, "invalid response from %v", s.tokenURL)
+	}
+	if token.AccessToken == "" || token.ExpiresIn <= 0 {
+		return nil, errors.Errorf("no token in the response from %v", s.tokenURL)
+	}
+
+	return token, nil
+}
+
+// Transport authenticates the requests sent via the base transport (or http.DefaultTransport, if it's nil) with the service tokens of the source.
+func (s *ServiceTokenSource) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &serviceTokenTransport{base: base, source: s}
+}
+
+func (t *serviceTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.source.Token(req.Context())
+	if err != nil {
+		return nil, errors.Wrap(err, "can't authenticate request")
+	}
+	authenticated := req.Clone(req.Context())
+	authenticated.Header.Set("Authorization", serviceTokenType+" "+token)
+
+	return t.base.RoundTrip(authenticated) //nolint:wrapcheck // It's a proxy.
+}
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/time"
+)
+
+func newServiceTestClient(t *testing.T) *auth {
+	t.Helper()
+	cl := newRevocationTestClient(t)
+	cl.cfg.WintrAuthIce.Services.Clients = []*struct {
+		ID       string   `yaml:"id" mapstructure:"id"`
+		Secret   string   `yaml:"secret" mapstructure:"secret"`
+		Identity string   `yaml:"identity" mapstructure:"identity"`
+		Scopes   []string `yaml:"scopes" mapstructure:"scopes"`
+	}{
+		{ID: "eskimo", Secret: "bogus", Scopes: []string{"users:read", "users:write"}},
+		{ID: "santa", Identity: "spiffe://ice.io/santa", Scopes: []string{"users:read"}},
+	}
+	cl.cfg.setServiceDefaults(testApplicationYAMLKey)
+
+	return cl
+}
+
+func TestIssueServiceToken(t *testing.T) {
+	t.Parallel()
+	cl := newServiceTestClient(t)
+
+	token, err := cl.IssueServiceToken(time.Now(), &ServiceCredentials{ClientID: "eskimo", ClientSecret: "bogus"})
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", token.TokenType)
+	assert.Equal(t, "users:read users:write", token.Scope)
+	assert.Equal(t, int64(defaultServiceTokenExpiration.Seconds()), token.ExpiresIn)
+	verified, err := cl.VerifyToken(t.Context(), token.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, ProviderService, verified.Provider)
+	assert.Empty(t, verified.UserID)
+	assert.Equal(t, "eskimo", verified.Claims["clientId"])
+	require.NoError(t, RequireScopes(verified, "users:write"))
+	require.ErrorIs(t, RequireScopes(verified, "users:delete"), ErrMissingScope)
+
+	token, err = cl.IssueServiceToken(time.Now(), &ServiceCredentials{ClientID: "eskimo", ClientSecret: "bogus"}, "users:read")
+	require.NoError(t, err)
+	verified, err = cl.VerifyToken(t.Context(), token.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users:read"}, ServiceScopes(verified))
+	_, err = cl.IssueServiceToken(time.Now(), &ServiceCredentials{ClientID: "eskimo", ClientSecret: "bogus"}, "users:delete")
+	require.ErrorIs(t, err, ErrInvalidScope)
+
+	for _, credentials := range []*ServiceCredentials{
+		{ClientID: "eskimo", ClientSecret: "wrong"},
+		{ClientID: "santa", ClientSecret: "bogus"},
+		{ClientID: "eskimo"},
+		{ClientID: "eskimo", Certificate: &x509.Certificate{Subject: pkix.Name{CommonName: "eskimo"}}},
+	} {
+		_, err = cl.IssueServiceToken(time.Now(), credentials)
+		require.ErrorIs(t, err, ErrInvalidClient, credentials.ClientID)
+	}
+
+	spiffeID, err := url.Parse("spiffe://ice.io/santa")
+	require.NoError(t, err)
+	token, err = cl.IssueServiceToken(time.Now(), &ServiceCredentials{Certificate: &x509.Certificate{URIs: []*url.URL{spiffeID}}})
+	require.NoError(t, err)
+	verified, err = cl.VerifyToken(t.Context(), token.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "santa", verified.Claims["clientId"])
+
+	_, accessToken, err := cl.GenerateTokens(time.Now(), "user", "device1", "a@b.c", 0, 1, "app")
+	require.NoError(t, err)
+	_, err = cl.ice.VerifyServiceToken(accessToken)
+	require.ErrorIs(t, err, ErrWrongTypeToken)
+	userToken, err := cl.VerifyToken(t.Context(), accessToken)
+	require.NoError(t, err)
+	require.ErrorIs(t, RequireScopes(userToken), ErrMissingScope)
+}
+
+func TestServiceTokenSource(t *testing.T) {
+	t.Parallel()
+	cl := newServiceTestClient(t)
+	var fetches atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/oauth/token" {
+			token, err := cl.VerifyToken(req.Context(), req.Header.Get("Authorization")[len("Bearer "):])
+			if err != nil || RequireScopes(token, "users:read") != nil {
+				writer.WriteHeader(http.StatusUnauthorized)
+			}
+
+			return
+		}
+		fetches.Add(1)
+		if req.PostFormValue("grant_type") != "client_credentials" {
+			writer.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+		token, err := cl.IssueServiceToken(time.Now(), &ServiceCredentials{ClientID: req.PostFormValue("client_id"), ClientSecret: req.PostFormValue("client_secret")},
+			req.PostFormValue("scope"))
+		if err != nil {
+			writer.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+		raw, err := json.Marshal(token)
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+		_, _ = writer.Write(raw) //nolint:errcheck // .
+	}))
+	defer server.Close()
+
+	source := NewServiceTokenSource(nil, server.URL+"/oauth/token", "eskimo", "bogus", "users:read")
+	first, err := source.Token(t.Context())
+	require.NoError(t, err)
+	second, err := source.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, int64(1), fetches.Load())
+
+	client := &http.Client{Transport: source.Transport(nil)}
+	for range 3 {
+		req, rErr := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL+"/users", http.NoBody)
+		require.NoError(t, rErr)
+		resp, rErr := client.Do(req)
+		require.NoError(t, rErr)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.Equal(t, int64(1), fetches.Load())
+
+	source.expiresAt = source.expiresAt.Add(-defaultServiceTokenExpiration)
+	_, err = source.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), fetches.Load())
+
+	_, err = NewServiceTokenSource(nil, server.URL+"/oauth/token", "eskimo", "wrong").Token(t.Context())
+	require.Error(t, err)
+}
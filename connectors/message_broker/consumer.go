@@ -9,8 +9,10 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/ice-blockchain/wintr/log"
+	"github.com/ice-blockchain/wintr/tracing"
 )
 
 func (mb *messageBroker) startConsuming(ctx context.Context, cancel context.CancelFunc) {
@@ -338,7 +340,14 @@ func (pc *partitionConsumer) processRecord(record *kgo.Record) {
 		PartitionCount: pc.partitionCount,
 		Topic:          pc.topic,
 	}
-	log.Error(errors.Wrap(pc.Process(pCtx, msg), "could not process new message"),
+	pCtx, span := tracing.Start(tracing.Extract(pCtx, msg.Headers), "messagebroker.process "+msg.Topic, tracing.SpanKindConsumer,
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.destination.name", msg.Topic),
+		attribute.Int("messaging.destination.partition.id", int(msg.Partition)),
+	)
+	err := pc.Process(pCtx, msg)
+	tracing.End(span, err)
+	log.Error(errors.Wrap(err, "could not process new message"),
 		"key", msg.Key,
 		"value", string(msg.Value),
 		"Timestamp", record.Timestamp,
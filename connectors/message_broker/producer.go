@@ -7,17 +7,28 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/ice-blockchain/wintr/log"
+	"github.com/ice-blockchain/wintr/tracing"
 )
 
 func (mb *messageBroker) SendMessage(ctx context.Context, msg *Message, responder chan<- error) {
-	headers := make([]kgo.RecordHeader, 0, len(msg.Headers))
-	if msg.Headers != nil {
-		for k, v := range msg.Headers {
+	ctx, span := tracing.Start(ctx, "messagebroker.send "+msg.Topic, tracing.SpanKindProducer,
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.destination.name", msg.Topic),
+	)
+	traceHeaders := make(map[string]string, 1)
+	tracing.Inject(ctx, traceHeaders)
+	headers := make([]kgo.RecordHeader, 0, len(msg.Headers)+len(traceHeaders))
+	for k, v := range msg.Headers {
+		if _, injected := traceHeaders[k]; !injected {
 			headers = append(headers, kgo.RecordHeader{Key: k, Value: []byte(v)})
 		}
 	}
+	for k, v := range traceHeaders {
+		headers = append(headers, kgo.RecordHeader{Key: k, Value: []byte(v)})
+	}
 	record := &kgo.Record{
 		Key:     []byte(msg.Key),
 		Value:   msg.Value,
@@ -30,6 +41,7 @@ func (mb *messageBroker) SendMessage(ctx context.Context, msg *Message, responde
 		} else {
 			log.Debug("record produced", "record.value", string(record.Value), "record", record)
 		}
+		tracing.End(span, err)
 		if responder != nil {
 			responder <- err
 		}
@@ -70,13 +70,17 @@ func DoInTransaction(ctx context.Context, db *DB, fn func(conn QueryExecer) erro
 }
 
 func Get[T any](ctx context.Context, db Querier, sql string, args ...any) (*T, error) {
-	return retry[*T](ctx, func(_ error) (*T, error) {
+	ctx, span := startSpan(ctx, "Get", sql)
+	resp, err := retry[*T](ctx, func(_ error) (*T, error) {
 		if resp, err := get[T](ctx, db, sql, args...); err != nil && IsUnexpected(err) {
 			return nil, err
 		} else { //nolint:revive // Nope.
 			return resp, backoff.Permanent(err)
 		}
 	})
+	endSpan(span, err)
+
+	return resp, err
 }
 
 func get[T any](ctx context.Context, db Querier, sql string, args ...any) (*T, error) { //nolint:revive // Nope.
@@ -92,13 +96,17 @@ func get[T any](ctx context.Context, db Querier, sql string, args ...any) (*T, e
 }
 
 func Select[T any](ctx context.Context, db Querier, sql string, args ...any) ([]*T, error) {
-	return retry[[]*T](ctx, func(_ error) ([]*T, error) {
+	ctx, span := startSpan(ctx, "Select", sql)
+	resp, err := retry[[]*T](ctx, func(_ error) ([]*T, error) {
 		if resp, err := selectInternal[T](ctx, db, sql, args...); err != nil && IsUnexpected(err) {
 			return nil, err
 		} else { //nolint:revive // Nope.
 			return resp, backoff.Permanent(err)
 		}
 	})
+	endSpan(span, err)
+
+	return resp, err
 }
 
 func selectInternal[T any](ctx context.Context, db Querier, sql string, args ...any) ([]*T, error) {
@@ -114,7 +122,8 @@ func selectInternal[T any](ctx context.Context, db Querier, sql string, args ...
 }
 
 func Exec(ctx context.Context, db Execer, sql string, args ...any) (uint64, error) {
-	return retry[uint64](ctx, func(prevErr error) (uint64, error) {
+	ctx, span := startSpan(ctx, "Exec", sql)
+	resp, err := retry[uint64](ctx, func(prevErr error) (uint64, error) {
 		primary := db
 		if pool, ok := db.(*DB); ok {
 			if pool.fallbackMasters != nil && len(pool.fallbackMasters.replicas) > 0 && needRetryOnFallbackMaster(prevErr) {
@@ -131,6 +140,9 @@ func Exec(ctx context.Context, db Execer, sql string, args ...any) (uint64, erro
 			return resp, backoff.Permanent(err)
 		}
 	})
+	endSpan(span, err)
+
+	return resp, err
 }
 
 func exec(ctx context.Context, db Execer, sql string, args ...any) (uint64, error) { //nolint:revive // Nope.
@@ -144,7 +156,8 @@ func exec(ctx context.Context, db Execer, sql string, args ...any) (uint64, erro
 
 //nolint:varnamelen // .
 func ExecOne[T any](ctx context.Context, db Querier, sql string, args ...any) (*T, error) {
-	return retry[*T](ctx, func(prevErr error) (*T, error) {
+	ctx, span := startSpan(ctx, "ExecOne", sql)
+	resp, err := retry[*T](ctx, func(prevErr error) (*T, error) {
 		primary := db
 		if pool, ok := db.(*DB); ok {
 			if pool.fallbackMasters != nil && len(pool.fallbackMasters.replicas) > 0 && needRetryOnFallbackMaster(prevErr) {
@@ -161,6 +174,9 @@ func ExecOne[T any](ctx context.Context, db Querier, sql string, args ...any) (*
 			return resp, backoff.Permanent(err)
 		}
 	})
+	endSpan(span, err)
+
+	return resp, err
 }
 
 func execOne[T any](ctx context.Context, db Querier, sql string, args ...any) (*T, error) { //nolint:revive // Nope.
@@ -174,7 +190,8 @@ func execOne[T any](ctx context.Context, db Querier, sql string, args ...any) (*
 
 //nolint:varnamelen // .
 func ExecMany[T any](ctx context.Context, db Querier, sql string, args ...any) ([]*T, error) {
-	return retry[[]*T](ctx, func(prevErr error) ([]*T, error) {
+	ctx, span := startSpan(ctx, "ExecMany", sql)
+	resp, err := retry[[]*T](ctx, func(prevErr error) ([]*T, error) {
 		primary := db
 		if pool, ok := db.(*DB); ok {
 			if pool.fallbackMasters != nil && len(pool.fallbackMasters.replicas) > 0 && needRetryOnFallbackMaster(prevErr) {
@@ -191,6 +208,9 @@ func ExecMany[T any](ctx context.Context, db Querier, sql string, args ...any) (
 			return resp, backoff.Permanent(err)
 		}
 	})
+	endSpan(span, err)
+
+	return resp, err
 }
 
 func execMany[T any](ctx context.Context, db Querier, sql string, args ...any) ([]*T, error) { //nolint:revive // Nope.
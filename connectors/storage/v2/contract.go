@@ -26,6 +26,7 @@ var (
 	ErrExclusionViolation   = errors.New("exclusion violation")
 	ErrMutexNotLocked       = errors.New("not locked")
 	ErrReadOnly             = errors.New("read only")
+	ErrInvalidCursor        = errors.New("invalid cursor")
 )
 
 type (
@@ -47,6 +48,13 @@ type (
 		EnsureLocked(ctx context.Context) error
 	}
 	PingOption func(*pingOptions)
+	// KeysetPagination describes how the rows of SelectPage are ordered. All Columns are ordered in the same direction.
+	KeysetPagination[T any] struct {
+		// Key returns pointers to the fields of the row that hold the Columns, in the same order.
+		Key        func(row *T) []any
+		Columns    []string
+		Descending bool
+	}
 
 	Listener struct {
 		db         *DB
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+// SelectPage runs a keyset paginated SELECT, returning at most limit rows, which must be positive, after the ones of the cursor, and the cursor of the next page.
+// The next cursor is empty if there are no more rows.
+// The sql must not be ordered or limited and it must select all the pagination.Columns, because it's wrapped, i.e.
+//
+//	SELECT * FROM (<sql>) AS page WHERE (<columns>) > (<cursor>) ORDER BY <columns> LIMIT <limit + 1>
+//
+// The pagination.Columns must be a unique key, ideally indexed, i.e. (created_at, id).
+func SelectPage[T any](
+	ctx context.Context, db Querier, pagination *KeysetPagination[T], cursor string, limit uint64, sql string, args ...any,
+) (rows []*T, nextCursor string, err error) {
+	pageSQL, pageArgs, err := pagination.sql(cursor, limit, sql, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	if rows, err = Select[T](ctx, db, pageSQL, pageArgs...); err != nil {
+		return nil, "", errors.Wrapf(err, "failed to select page after cursor %v", cursor)
+	}
+	if uint64(len(rows)) <= limit {
+		return rows, "", nil
+	}
+	rows = rows[:limit]
+	if nextCursor, err = pagination.EncodeCursor(rows[len(rows)-1]); err != nil {
+		return nil, "", err
+	}
+
+	return rows, nextCursor, nil
+}
+
+// EncodeCursor builds the opaque cursor that points right after the row.
+func (p *KeysetPagination[T]) EncodeCursor(row *T) (string, error) {
+	key := p.Key(row)
+	if len(key) != len(p.Columns) {
+		return "", errors.Errorf("key has %v values, expected %v", len(key), len(p.Columns))
+	}
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to encode cursor %#v", key)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor returns the values of the columns of the row the cursor points to. If it's invalid, ErrInvalidCursor is returned.
+func (p *KeysetPagination[T]) DecodeCursor(cursor string) ([]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidCursor, "failed to decode %v: %v", cursor, err)
+	}
+	var rawValues []json.RawMessage
+	if err = json.Unmarshal(data, &rawValues); err != nil || len(rawValues) != len(p.Columns) {
+		return nil, errors.Wrapf(ErrInvalidCursor, "failed to decode %v", cursor)
+	}
+	key := p.Key(new(T))
+	values := make([]any, 0, len(key))
+	for ix, ptr := range key {
+		if err = json.Unmarshal(rawValues[ix], ptr); err != nil {
+			return nil, errors.Wrapf(ErrInvalidCursor, "failed to decode %v of %v: %v", p.Columns[ix], cursor, err)
+		}
+		values = append(values, reflect.ValueOf(ptr).Elem().Interface())
+	}
+
+	return values, nil
+}
+
+func (p *KeysetPagination[T]) sql(cursor string, limit uint64, sql string, args ...any) (string, []any, error) {
+	if len(p.Columns) == 0 {
+		return "", nil, errors.New("keyset pagination requires at least one column")
+	}
+	if limit == 0 {
+		return "", nil, errors.New("keyset pagination requires a positive limit")
+	}
+	direction, comparison := "ASC", ">"
+	if p.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	orderBy := make([]string, 0, len(p.Columns))
+	for _, column := range p.Columns {
+		orderBy = append(orderBy, column+" "+direction)
+	}
+	var where string
+	if cursor != "" {
+		values, err := p.DecodeCursor(cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		placeholders := make([]string, 0, len(values))
+		for _, value := range values {
+			args = append(args, value)
+			placeholders = append(placeholders, fmt.Sprintf("$%v", len(args)))
+		}
+		where = fmt.Sprintf(" WHERE (%v) %v (%v)", strings.Join(p.Columns, ", "), comparison, strings.Join(placeholders, ", "))
+	}
+	args = append(args, limit+1)
+
+	return fmt.Sprintf("SELECT * FROM (%v) AS page%v ORDER BY %v LIMIT $%v", sql, where, strings.Join(orderBy, ", "), len(args)), args, nil
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package storage
+
+import (
+	"testing"
+	stdlibtime "time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	paginatedRow struct {
+		CreatedAt stdlibtime.Time
+		ID        string
+		Name      string
+	}
+)
+
+func paginatedRows(descending bool) *KeysetPagination[paginatedRow] {
+	return &KeysetPagination[paginatedRow]{
+		Key:        func(row *paginatedRow) []any { return []any{&row.CreatedAt, &row.ID} },
+		Columns:    []string{"created_at", "id"},
+		Descending: descending,
+	}
+}
+
+func TestKeysetPaginationCursor(t *testing.T) {
+	t.Parallel()
+	row := &paginatedRow{CreatedAt: stdlibtime.Date(2024, 1, 2, 3, 4, 5, 6, stdlibtime.UTC), ID: "a", Name: "bogus"}
+	cursor, err := paginatedRows(false).EncodeCursor(row)
+	require.NoError(t, err)
+	assert.NotContains(t, cursor, "=")
+
+	values, err := paginatedRows(false).DecodeCursor(cursor)
+	require.NoError(t, err)
+	assert.Equal(t, []any{row.CreatedAt, "a"}, values)
+
+	for _, invalid := range []string{"%%%", "bm90LWpzb24", "WyJhIl0", "WzEsMl0"} {
+		_, err = paginatedRows(false).DecodeCursor(invalid)
+		require.ErrorIs(t, err, ErrInvalidCursor, invalid)
+	}
+}
+
+func TestKeysetPaginationSQL(t *testing.T) {
+	t.Parallel()
+	sql, args, err := paginatedRows(false).sql("", 10, "SELECT * FROM users WHERE name = $1", "bogus")
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM (SELECT * FROM users WHERE name = $1) AS page ORDER BY created_at ASC, id ASC LIMIT $2", sql)
+	assert.Equal(t, []any{"bogus", uint64(11)}, args)
+
+	row := &paginatedRow{CreatedAt: stdlibtime.Date(2024, 1, 2, 3, 4, 5, 6, stdlibtime.UTC), ID: "a"}
+	cursor, err := paginatedRows(true).EncodeCursor(row)
+	require.NoError(t, err)
+	sql, args, err = paginatedRows(true).sql(cursor, 10, "SELECT * FROM users WHERE name = $1", "bogus")
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM (SELECT * FROM users WHERE name = $1) AS page WHERE (created_at, id) < ($2, $3) ORDER BY created_at DESC, id DESC LIMIT $4", sql) //nolint:lll // .
+	assert.Equal(t, []any{"bogus", row.CreatedAt, "a", uint64(11)}, args)
+
+	_, _, err = paginatedRows(true).sql("%%%", 10, "SELECT * FROM users")
+	require.ErrorIs(t, err, ErrInvalidCursor)
+	_, _, err = paginatedRows(false).sql("", 0, "SELECT * FROM users")
+	require.Error(t, err)
+}
@@ -0,0 +1,27 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package storage
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/ice-blockchain/wintr/tracing"
+)
+
+func startSpan(ctx context.Context, operation, sql string) (context.Context, tracing.Span) {
+	return tracing.Start(ctx, "storage/v2."+operation, tracing.SpanKindClient,
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation.name", operation),
+		attribute.String("db.query.text", sql),
+	)
+}
+
+func endSpan(span tracing.Span, err error) {
+	if errors.Is(err, ErrNotFound) {
+		err = nil
+	}
+	tracing.End(span, err)
+}
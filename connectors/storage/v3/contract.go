@@ -22,8 +22,13 @@ type (
 
 // Private API.
 
+var (
+	_ redis.Hook = tracingHook{}
+)
+
 type (
-	lb struct {
+	tracingHook struct{}
+	lb          struct {
 		urls         []string
 		instances    []*redis.Client
 		currentIndex uint64
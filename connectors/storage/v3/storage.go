@@ -86,6 +86,7 @@ func MustConnect(ctx context.Context, applicationYAMLKey string, overriddenPoolS
 		}
 
 		client := redis.NewClient(opts)
+		client.AddHook(tracingHook{})
 		result, err := client.Ping(ctx).Result()
 		log.Panic(err)
 		if result != "PONG" {
@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package storage
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/ice-blockchain/wintr/tracing"
+)
+
+func (tracingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (tracingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := tracing.Start(ctx, "storage/v3."+cmd.Name(), tracing.SpanKindClient,
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation.name", cmd.FullName()),
+		)
+		err := next(ctx, cmd)
+		tracing.End(span, ignoreNil(err))
+
+		return err
+	}
+}
+
+func (tracingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := tracing.Start(ctx, "storage/v3.pipeline", tracing.SpanKindClient,
+			attribute.String("db.system", "redis"),
+			attribute.Int("db.operation.batch.size", len(cmds)),
+		)
+		err := next(ctx, cmds)
+		tracing.End(span, ignoreNil(err))
+
+		return err
+	}
+}
+
+func ignoreNil(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,20 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Public API.
+
+type (
+	Collector = prometheus.Collector
+)
+
+// Private API.
+
+//nolint:gochecknoglobals // It's the registry shared by all the packages of the same process.
+var (
+	registry = prometheus.NewRegistry()
+)
@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ice-blockchain/wintr/log"
+)
+
+//nolint:gochecknoinits // Because we want to set it up globally.
+func init() {
+	MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// Registry is the process wide registry, every package should register its collectors into, so that they're exposed together.
+func Registry() *prometheus.Registry {
+	return registry
+}
+
+// MustRegister registers the collectors, skipping the ones that are registered already.
+// It panics if a different collector is registered with the same descriptor, because it would never be exported.
+func MustRegister(cs ...Collector) {
+	for _, c := range cs {
+		if err := registry.Register(c); err != nil {
+			if are, alreadyRegistered := err.(prometheus.AlreadyRegisteredError); alreadyRegistered && are.ExistingCollector == c { //nolint:errorlint // It's not wrapped.
+				continue
+			}
+			log.Panic(err)
+		}
+	}
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMustRegister(t *testing.T) {
+	t.Parallel()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "metrics_test_total", Help: "bogus"})
+	MustRegister(counter)
+	MustRegister(counter)
+	assert.Panics(t, func() {
+		MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "metrics_test_total", Help: "bogus"}))
+	})
+	assert.Panics(t, func() {
+		MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "metrics_test_total", Help: "other"}))
+	})
+	counter.Inc()
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "metrics_test_total 1")
+	assert.Contains(t, recorder.Body.String(), "go_goroutines")
+}
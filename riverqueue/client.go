@@ -16,6 +16,7 @@ import (
 	"github.com/riverqueue/river"
 	"github.com/riverqueue/river/riverdriver/riverpgxv5"
 	"github.com/riverqueue/river/rivermigrate"
+	"github.com/riverqueue/river/rivertype"
 
 	appcfg "github.com/ice-blockchain/wintr/config"
 	"github.com/ice-blockchain/wintr/log"
@@ -182,6 +183,7 @@ func (q *riverq) initRiverClient(ctx context.Context, pool *pgxpool.Pool) error
 			Workers:    q.WorkerRegister,
 			JobTimeout: q.Cfg.JobMaxTimeout,
 			ID:         q.Cfg.ID,
+			Middleware: []rivertype.Middleware{new(tracingMiddleware)},
 		},
 	)
 	if err != nil {
@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package riverqueue
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/goccy/go-json"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/ice-blockchain/wintr/tracing"
+)
+
+const tracingMetadataKey = "tracing"
+
+type (
+	// tracingMiddleware propagates the span context of the pusher into the job metadata and starts a span around every job execution.
+	tracingMiddleware struct {
+		river.MiddlewareDefaults
+	}
+)
+
+func (*tracingMiddleware) InsertMany(
+	ctx context.Context, manyParams []*rivertype.JobInsertParams, doInner func(context.Context) ([]*rivertype.JobInsertResult, error),
+) ([]*rivertype.JobInsertResult, error) {
+	carrier := make(map[string]string, 1)
+	tracing.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return doInner(ctx)
+	}
+	for _, params := range manyParams {
+		metadata := make(map[string]any, 1)
+		if len(params.Metadata) != 0 {
+			if err := json.Unmarshal(params.Metadata, &metadata); err != nil {
+				return nil, fmt.Errorf("failed to decode metadata of job kind %s: %w", params.Kind, err)
+			}
+		}
+		metadata[tracingMetadataKey] = carrier
+		encoded, err := json.Marshal(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode metadata of job kind %s: %w", params.Kind, err)
+		}
+		params.Metadata = encoded
+	}
+
+	return doInner(ctx)
+}
+
+func (*tracingMiddleware) Work(ctx context.Context, job *rivertype.JobRow, doInner func(context.Context) error) error {
+	var metadata struct {
+		Tracing map[string]string `json:"tracing"`
+	}
+	if len(job.Metadata) != 0 {
+		_ = json.Unmarshal(job.Metadata, &metadata) //nolint:errcheck // Not having the span context is not a reason to fail the job.
+	}
+	ctx, span := tracing.Start(tracing.Extract(ctx, metadata.Tracing), "riverqueue.work "+job.Kind, tracing.SpanKindConsumer,
+		attribute.String("job.kind", job.Kind),
+		attribute.String("job.queue", job.Queue),
+		attribute.Int64("job.id", job.ID),
+		attribute.Int("job.attempt", job.Attempt),
+	)
+	err := doInner(ctx)
+	tracing.End(span, err)
+
+	return err
+}
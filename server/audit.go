@@ -0,0 +1,328 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	gojson "github.com/goccy/go-json"
+	"github.com/pkg/errors"
+
+	messagebroker "github.com/ice-blockchain/wintr/connectors/message_broker"
+	storagev2 "github.com/ice-blockchain/wintr/connectors/storage/v2"
+	"github.com/ice-blockchain/wintr/log"
+)
+
+// WithAudit records an AuditEntry for every request of the route, if auditing is enabled. See Config.Audit.
+func WithAudit() HandlerOption {
+	return func(options *handlerOptions) {
+		options.audit = true
+	}
+}
+
+func newAuditor(ctx context.Context, state State, applicationYAMLKey string) *auditor {
+	var sink AuditSink
+	if auditState, ok := state.(AuditState); ok {
+		if sink = auditState.AuditSink(); sink == nil {
+			log.Panic(errors.Errorf("%T returned a nil AuditSink", state))
+		}
+	} else {
+		switch cfg.Audit.Sink {
+		case "":
+			return nil
+		case auditSinkLog:
+			sink = NewLogAuditSink()
+		case auditSinkStorageV2:
+			sink = NewPostgresAuditSink(storagev2.MustConnect(ctx, applicationYAMLKey, storagev2.NewStringDDL(AuditLogDDL)))
+		case auditSinkMessageBroker:
+			if cfg.Audit.Topic == "" {
+				log.Panic(errors.New("audit topic is required for the message broker sink"))
+			}
+			sink = NewMessageBrokerAuditSink(messagebroker.MustConnect(ctx, applicationYAMLKey), cfg.Audit.Topic)
+		default:
+			log.Panic(errors.Errorf("invalid audit sink `%v`, expected one of `%v`, `%v`, `%v`",
+				cfg.Audit.Sink, auditSinkLog, auditSinkStorageV2, auditSinkMessageBroker))
+		}
+	}
+	bufferSize := cfg.Audit.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultAuditBufferSize
+	}
+	a := &auditor{sink: sink, entries: make(chan *AuditEntry, bufferSize), done: make(chan struct{})}
+	go a.ship()
+
+	return a
+}
+
+func (req *Request[REQ, RESP]) audit(ctx context.Context, options *handlerOptions, startedAt time.Time) {
+	if !options.audit {
+		return
+	}
+	a, ok := ctx.Value(auditorCtxValueKey).(*auditor)
+	if !ok || a == nil {
+		return
+	}
+	a.record(&AuditEntry{
+		Timestamp: startedAt.UTC(),
+		Payload:   redact(reflect.ValueOf(req.Data)),
+		UserID:    req.AuthenticatedUser.UserID,
+		ClientIP:  req.ClientIP.String(),
+		Method:    req.ginCtx.Request.Method,
+		Route:     req.ginCtx.FullPath(),
+		Code:      req.ginCtx.Writer.Status(),
+		Latency:   time.Since(startedAt),
+	})
+}
+
+// record queues the entry to be shipped, without blocking. It's dropped if the buffer is full or if the auditor was closed already,
+// which can happen for requests that outlived the shutdown.
+func (a *auditor) record(entry *AuditEntry) {
+	a.mx.RLock()
+	defer a.mx.RUnlock()
+	if a.closed {
+		auditEntriesDropped.Inc()
+		log.Error(errors.New("auditor is closed, dropping entry"), "entry", entry)
+
+		return
+	}
+	select {
+	case a.entries <- entry:
+	default:
+		auditEntriesDropped.Inc()
+		log.Error(errors.New("audit buffer is full, dropping entry"), "entry", entry)
+	}
+}
+
+func (a *auditor) ship() {
+	defer close(a.done)
+	for entry := range a.entries {
+		ctx, cancel := context.WithTimeout(context.Background(), auditSinkRequestTimeout)
+		if err := a.sink.Record(ctx, entry); err != nil {
+			auditEntriesDropped.Inc()
+			log.Error(errors.Wrap(err, "failed to record audit entry"), "entry", entry)
+		}
+		cancel()
+	}
+}
+
+// close stops accepting entries, ships the remaining ones, for up to auditCloseTimeout, and closes the sink.
+func (a *auditor) close() error {
+	a.mx.Lock()
+	if a.closed {
+		a.mx.Unlock()
+
+		return nil
+	}
+	a.closed = true
+	close(a.entries)
+	a.mx.Unlock()
+	timer := time.NewTimer(auditCloseTimeout)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return errors.Errorf("%v audit entries were not shipped in %v", len(a.entries), auditCloseTimeout)
+	case <-a.done:
+	}
+
+	return errors.Wrap(a.sink.Close(), "failed to close audit sink")
+}
+
+// redact converts the payload to plain values, keyed by their json names, with privacy.Sensitive and privacy.DBSensitive ones,
+// and the ones of fields tagged with `redact:"true"`, redacted. Like with json, `json:"-"` fields are skipped, embedded structs are flattened
+// and the values that marshal themselves, i.e. coin amounts, are recorded as they're marshaled.
+//
+//nolint:exhaustive,revive // Everything else is used as is.
+func redact(val reflect.Value) any {
+	for val.Kind() == reflect.Pointer || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	if val.Type() == reflect.TypeFor[time.Time]() {
+		return val.Interface()
+	}
+	if isSensitive(val.Type()) {
+		return redactValue(val)
+	}
+	if marshaled, ok := redactMarshaler(val); ok {
+		return marshaled
+	}
+	switch val.Kind() {
+	case reflect.Struct:
+		fields := make(map[string]any, val.NumField())
+		redactFields(val, fields)
+
+		return fields
+	case reflect.Slice, reflect.Array:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("%v bytes", val.Len())
+		}
+		items := make([]any, 0, val.Len())
+		for i := range val.Len() {
+			items = append(items, redact(val.Index(i)))
+		}
+
+		return items
+	case reflect.Map:
+		items := make(map[string]any, val.Len())
+		for iter := val.MapRange(); iter.Next(); {
+			items[fmt.Sprint(iter.Key().Interface())] = redact(iter.Value())
+		}
+
+		return items
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return nil
+	default:
+		return val.Interface()
+	}
+}
+
+func redactFields(val reflect.Value, fields map[string]any) {
+	for i := range val.NumField() {
+		field := val.Type().Field(i)
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch {
+		case jsonName == "-", !field.IsExported():
+		case field.Anonymous && jsonName == "" && isEmbeddedStruct(val.Field(i)):
+			embedded := val.Field(i)
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			redactFields(embedded, fields)
+		case field.Tag.Get(redactTag) == "true":
+			fields[fieldName(field)] = redactValue(val.Field(i))
+		default:
+			fields[fieldName(field)] = redact(val.Field(i))
+		}
+	}
+}
+
+// isEmbeddedStruct reports if the embedded field is a (non nil) struct, that isn't marshaled or redacted as a whole.
+func isEmbeddedStruct(val reflect.Value) bool {
+	for val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return false
+		}
+		val = val.Elem()
+	}
+
+	return val.Kind() == reflect.Struct && !isSensitive(val.Type()) && !isMarshaler(reflect.PointerTo(val.Type()))
+}
+
+func isMarshaler(typ reflect.Type) bool {
+	return typ.Implements(reflect.TypeFor[gojson.MarshalerContext]()) || typ.Implements(reflect.TypeFor[gojson.Marshaler]()) ||
+		typ.Implements(reflect.TypeFor[encoding.TextMarshaler]())
+}
+
+// redactMarshaler returns the value as it's marshaled to json, if it marshals itself.
+func redactMarshaler(val reflect.Value) (any, bool) {
+	if !isMarshaler(reflect.PointerTo(val.Type())) {
+		return nil, false
+	}
+	ptr := reflect.New(val.Type())
+	ptr.Elem().Set(val)
+	data, err := gojson.Marshal(ptr.Interface())
+	if err != nil {
+		log.Error(errors.Wrapf(err, "failed to marshal %v for the audit trail", val.Type()))
+
+		return nil, true
+	}
+	decoder := gojson.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var marshaled any
+	if err = decoder.Decode(&marshaled); err != nil {
+		log.Error(errors.Wrapf(err, "failed to decode %v for the audit trail", val.Type()))
+
+		return nil, true
+	}
+
+	return marshaled, true
+}
+
+// isSensitive matches the privacy package types by name, because importing it requires its secret to be configured.
+func isSensitive(typ reflect.Type) bool {
+	return typ.PkgPath() == privacyPackagePath && (typ.Name() == "Sensitive" || typ.Name() == "DBSensitive")
+}
+
+func redactValue(val reflect.Value) any {
+	for val.Kind() == reflect.Pointer || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	if val.IsZero() {
+		return val.Interface()
+	}
+
+	return redactedValue
+}
+
+// NewLogAuditSink builds an AuditSink that logs every entry.
+func NewLogAuditSink() AuditSink {
+	return new(logAuditSink)
+}
+
+func (*logAuditSink) Record(_ context.Context, entry *AuditEntry) error {
+	log.Info(fmt.Sprintf("audit: %v %v %v", entry.Method, entry.Route, entry.Code),
+		"userId", entry.UserID, "clientIp", entry.ClientIP, "payload", entry.Payload, "latency", entry.Latency.String())
+
+	return nil
+}
+
+func (*logAuditSink) Close() error {
+	return nil
+}
+
+// NewPostgresAuditSink builds an AuditSink backed by storage/v2. It requires the AuditLogDDL schema.
+func NewPostgresAuditSink(db *storagev2.DB) AuditSink {
+	return &postgresAuditSink{db: db}
+}
+
+func (s *postgresAuditSink) Record(ctx context.Context, entry *AuditEntry) error {
+	payload, err := gojson.MarshalContext(ctx, entry.Payload)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode audit payload %#v", entry.Payload)
+	}
+	sql := `INSERT INTO audit_log (created_at, latency, code, user_id, client_ip, method, route, payload)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8::jsonb)`
+	_, err = storagev2.Exec(ctx, s.db, sql,
+		entry.Timestamp, entry.Latency.Nanoseconds(), entry.Code, entry.UserID, entry.ClientIP, entry.Method, entry.Route, string(payload))
+
+	return errors.Wrapf(err, "failed to insert audit entry %#v", entry)
+}
+
+func (s *postgresAuditSink) Close() error {
+	return errors.Wrap(s.db.Close(), "failed to close audit sink storage")
+}
+
+// NewMessageBrokerAuditSink builds an AuditSink that sends every entry, JSON encoded, to the topic, keyed by user id.
+func NewMessageBrokerAuditSink(client messagebroker.Client, topic string) AuditSink {
+	return &messageBrokerAuditSink{client: client, topic: topic}
+}
+
+func (s *messageBrokerAuditSink) Record(ctx context.Context, entry *AuditEntry) error {
+	value, err := gojson.MarshalContext(ctx, entry)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode audit entry %#v", entry)
+	}
+	responder := make(chan error, 1)
+	s.client.SendMessage(ctx, &messagebroker.Message{Key: entry.UserID, Topic: s.topic, Value: value}, responder)
+	select {
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "sending audit entry timed out")
+	case err = <-responder:
+		return errors.Wrapf(err, "failed to send audit entry to %v", s.topic)
+	}
+}
+
+func (s *messageBrokerAuditSink) Close() error {
+	return errors.Wrap(s.client.Close(), "failed to close audit sink message broker")
+}
@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/auth"
+	"github.com/ice-blockchain/wintr/coin"
+	wintrtime "github.com/ice-blockchain/wintr/time"
+)
+
+type (
+	auditTestSink struct {
+		entries []*AuditEntry
+		mx      sync.Mutex
+		closed  bool
+	}
+	AuditTestLocation struct {
+		Country string `json:"country"`
+	}
+	auditTestRequest struct {
+		*AuditTestLocation
+		Amount    *coin.ICEFlake  `json:"amount"`
+		CreatedAt *wintrtime.Time `json:"createdAt"`
+		Phone     *string         `json:"phone" redact:"true"`
+		Tags      map[string]int  `json:"tags"`
+		UserID    string          `uri:"userId" json:"-" allowUnauthorized:"true"`
+		Email     string          `json:"email" redact:"true"`
+		Name      string          `json:"name"`
+		Avatar    []byte          `json:"avatar"`
+		Empty     string          `json:"empty" redact:"true"`
+		Password  string          `json:"-"`
+		internal  string
+	}
+	auditTestState struct {
+		State
+	}
+)
+
+func (*auditTestState) AuditSink() AuditSink {
+	return nil
+}
+
+func (s *auditTestSink) Record(_ context.Context, entry *AuditEntry) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.entries = append(s.entries, entry)
+
+	return nil
+}
+
+func (s *auditTestSink) Close() error {
+	s.closed = true
+
+	return nil
+}
+
+func TestRedact(t *testing.T) {
+	t.Parallel()
+	phone := "+40700000000"
+	payload := &auditTestRequest{
+		AuditTestLocation: &AuditTestLocation{Country: "RO"},
+		Amount:            coin.UnsafeParseAmount("123456789012345678901234567890"),
+		CreatedAt:         wintrtime.New(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)),
+		Phone:             &phone,
+		Tags:              map[string]int{"a": 1},
+		UserID:            "bogus",
+		Email:             "foo@bar.com",
+		Name:              "foo",
+		Avatar:            []byte("png"),
+		Password:          "secret",
+		internal:          "x",
+	}
+	assert.Equal(t, map[string]any{
+		"country":   "RO",
+		"amount":    "123456789012345678901234567890",
+		"createdAt": "2024-01-02T03:04:05Z",
+		"phone":     redactedValue,
+		"tags":      map[string]any{"a": 1},
+		"email":     redactedValue,
+		"name":      "foo",
+		"avatar":    "3 bytes",
+		"empty":     "",
+	}, redact(reflect.ValueOf(payload)))
+	assert.Nil(t, redact(reflect.ValueOf((*auditTestRequest)(nil))))
+	assert.False(t, isSensitive(reflect.TypeFor[auditTestRequest]()))
+}
+
+func TestAudit(t *testing.T) {
+	t.Parallel()
+	sink := new(auditTestSink)
+	a := &auditor{sink: sink, entries: make(chan *AuditEntry, 1), done: make(chan struct{})}
+	go a.ship()
+	router := gin.New()
+	handler := func(_ context.Context, req *Request[auditTestRequest, auditTestRequest]) (*Response[auditTestRequest], *Response[ErrorResponse]) {
+		time.Sleep(time.Millisecond)
+
+		return Created(req.Data), nil
+	}
+	router.POST("/v1/users/:userId", RootHandler(handler, WithAudit()))
+	router.POST("/v1/unaudited/:userId", RootHandler(handler))
+	ctx := context.WithValue(t.Context(), auditorCtxValueKey, a)                             //nolint:staticcheck,revive // .
+	ctx = context.WithValue(ctx, authClientCtxValueKey, auth.Client(new(webSocketTestAuth))) //nolint:staticcheck,revive // .
+
+	for _, path := range []string{"/v1/users/bogus", "/v1/unaudited/bogus"} {
+		req := httptest.NewRequestWithContext(ctx, http.MethodPost, path, strings.NewReader(`{"email":"foo@bar.com","name":"foo"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer valid")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	}
+	require.NoError(t, a.close())
+	assert.True(t, sink.closed)
+	require.Len(t, sink.entries, 1)
+	entry := sink.entries[0]
+	assert.Equal(t, http.MethodPost, entry.Method)
+	assert.Equal(t, "/v1/users/:userId", entry.Route)
+	assert.Equal(t, http.StatusCreated, entry.Code)
+	assert.Equal(t, "192.0.2.1", entry.ClientIP)
+	assert.Equal(t, "bogus", entry.UserID)
+	assert.Positive(t, entry.Latency)
+	assert.NotContains(t, entry.Payload, "userId")
+	assert.Equal(t, redactedValue, entry.Payload.(map[string]any)["email"]) //nolint:forcetypeassert // We know for sure.
+
+	a = &auditor{sink: sink, entries: make(chan *AuditEntry, 1), done: make(chan struct{})}
+	a.record(new(AuditEntry))
+	a.record(new(AuditEntry))
+	assert.Len(t, a.entries, 1)
+}
+
+func TestAuditorClose(t *testing.T) {
+	t.Parallel()
+	sink := new(auditTestSink)
+	a := &auditor{sink: sink, entries: make(chan *AuditEntry, 1), done: make(chan struct{})}
+	go a.ship()
+	a.record(&AuditEntry{Route: "before"})
+	require.NoError(t, a.close())
+	assert.True(t, sink.closed)
+	assert.NotPanics(t, func() { a.record(&AuditEntry{Route: "after"}) })
+	require.NoError(t, a.close())
+	require.Len(t, sink.entries, 1)
+	assert.Equal(t, "before", sink.entries[0].Route)
+}
+
+func TestNewAuditorWithNilSink(t *testing.T) {
+	t.Parallel()
+	assert.Panics(t, func() { newAuditor(t.Context(), new(auditTestState), "self") })
+}
@@ -3,15 +3,32 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"hash"
+	"io"
+	"iter"
 	"net"
 	"net/http"
 	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
 
 	"github.com/ice-blockchain/wintr/auth"
+	messagebroker "github.com/ice-blockchain/wintr/connectors/message_broker"
+	storagev2 "github.com/ice-blockchain/wintr/connectors/storage/v2"
+	"github.com/ice-blockchain/wintr/connectors/storage/v3"
+	"github.com/ice-blockchain/wintr/tracing"
 )
 
 // Public API.
@@ -34,6 +51,64 @@ type (
 		RegisterRoutes(r *Router)
 		CheckHealth(ctx context.Context) error
 	}
+	// GRPCServer is the optional gRPC server, that shares the lifecycle, the authentication and the error codes of the http one.
+	GRPCServer = grpc.Server
+	// GRPCState is implemented by States that expose gRPC services. They're registered after State.Init, if Config.GRPCServer.Port is set.
+	GRPCState interface {
+		RegisterGRPCServices(server *GRPCServer)
+	}
+	// AuditState is implemented by States that ship audit entries to their own sink, instead of the one in Config.Audit.Sink.
+	AuditState interface {
+		AuditSink() AuditSink
+	}
+	// AuditSink persists the audit entries. Entries are recorded one at a time, asynchronously, after the response is sent.
+	AuditSink interface {
+		io.Closer
+		Record(ctx context.Context, entry *AuditEntry) error
+	}
+	// AuditEntry is a request, to a route built WithAudit, as recorded in the audit trail.
+	AuditEntry struct {
+		Timestamp time.Time     `json:"timestamp"`
+		Payload   any           `json:"payload,omitempty"` // The request data, with privacy.Sensitive values redacted.
+		UserID    string        `json:"userId,omitempty"`
+		ClientIP  string        `json:"clientIp,omitempty"`
+		Method    string        `json:"method"`
+		Route     string        `json:"route"`
+		Code      int           `json:"code"`
+		Latency   time.Duration `json:"latency"`
+	}
+	// HandlerOption customizes the behaviour of a single route built with RootHandler.
+	HandlerOption func(*handlerOptions)
+	// RateLimit allows at most Requests per Per window, with bursts of up to Requests.
+	RateLimit struct {
+		Requests int
+		Per      time.Duration
+	}
+	// RateLimitKeyFunc builds the key, unique per route, that requests are counted against.
+	RateLimitKeyFunc func(ginCtx *gin.Context, user *AuthenticatedUser) string
+	// RateLimiter decides if another request is allowed for the specified key. If not, it returns how long to wait for the next one.
+	RateLimiter interface {
+		io.Closer
+		Allow(ctx context.Context, key string, limit *RateLimit) (retryAfter time.Duration, err error)
+	}
+	// Policy is a programmatic authorization check, evaluated after authentication. Any error makes the request fail with 403 Forbidden.
+	Policy func(ctx context.Context, ginCtx *gin.Context, user *AuthenticatedUser) error
+	// IdempotencyStore persists the first response of every request sent with an `Idempotency-Key` header, so that it can be replayed on retries.
+	IdempotencyStore interface {
+		io.Closer
+		// Begin reserves the key, along with the fingerprint of the request, for lockTTL. If the key was already completed, its stored response is returned.
+		// If the key is still reserved by another request, ErrIdempotentRequestInProgress is returned.
+		// If the key was used for a request with a different fingerprint, ErrIdempotencyKeyReused is returned.
+		Begin(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*IdempotentResponse, error)
+		Complete(ctx context.Context, key string, resp *IdempotentResponse, ttl time.Duration) error
+		Abort(ctx context.Context, key string) error
+	}
+	IdempotentResponse struct {
+		Headers     map[string]string `json:"headers,omitempty"`
+		Fingerprint string            `json:"fingerprint,omitempty"` // The hash of the method, path and body of the request.
+		Body        []byte            `json:"body,omitempty"`
+		Code        int               `json:"code"`
+	}
 	Request[REQ any, RESP any] struct {
 		Data                         *REQ                        `json:"data,omitempty"`
 		ginCtx                       *gin.Context                //nolint:structcheck // Wrong.
@@ -41,6 +116,14 @@ type (
 		ClientIP                     net.IP                      `json:"clientIp,omitempty"`
 		bindings                     map[requestBinding]struct{} //nolint:structcheck // Wrong.
 		requiredFields               []string                    //nolint:structcheck // Wrong.
+		rateLimit                    *RateLimit                  //nolint:structcheck // Wrong.
+		rateLimitKey                 RateLimitKeyFunc            //nolint:structcheck // Wrong.
+		requiredClaims               map[string]string           //nolint:structcheck // Wrong.
+		roles                        []string                    //nolint:structcheck // Wrong.
+		scopes                       []string                    //nolint:structcheck // Wrong.
+		policies                     []Policy                    //nolint:structcheck // Wrong.
+		fingerprint                  hash.Hash                   //nolint:structcheck // Wrong.
+		mfaMaxAge                    time.Duration               //nolint:structcheck // Wrong.
 		allowUnauthorized            bool                        //nolint:structcheck // Wrong.
 		allowForbiddenGet            bool                        //nolint:structcheck // Wrong.
 		allowForbiddenWriteOperation bool                        //nolint:structcheck // Wrong.
@@ -50,6 +133,60 @@ type (
 		Headers map[string]string
 		Code    int
 	}
+	// File is a RESP that is sent as a raw body, as a download (or inline, if Inline is set), instead of JSON.
+	// Content is closed after it's sent, if it implements io.Closer.
+	File struct {
+		Content     io.Reader
+		Name        string
+		ContentType string // Defaults to `application/octet-stream`.
+		Size        int64  // Optional, zero if unknown.
+		Inline      bool
+	}
+	// CSV is a RESP that is sent as a `text/csv` download. Records are written as they are yielded, so they can be streamed.
+	CSV struct {
+		Records iter.Seq[[]string]
+		Name    string
+		Header  []string
+	}
+	// EventStream is a RESP that is sent as a `text/event-stream` (Server-Sent Events).
+	// The stream ends when Events is closed, the client disconnects or the endpoint times out.
+	EventStream struct {
+		Events <-chan *Event
+	}
+	// Event is a single Server-Sent Event. Data is sent as is if it's a string, otherwise it's JSON encoded.
+	Event struct {
+		Data  any
+		ID    string
+		Name  string
+		Retry time.Duration
+	}
+	// WebSocket is an authenticated websocket connection, kept alive with pings, that is closed when its handler returns or the server shuts down.
+	WebSocket interface {
+		// Send JSON encodes the message and queues it to be written. It blocks while the send buffer is full, until ctx is done.
+		Send(ctx context.Context, message any) error
+		// Receive waits for the next message and JSON decodes it into the provided one.
+		Receive(ctx context.Context, message any) error
+		Close() error
+	}
+	// Pagination is embedded in the REQs of list endpoints, to bind the standard `limit`, `offset` and `cursor` query parameters.
+	// Limit defaults to Config.DefaultPagination.Limit and can't exceed Config.DefaultPagination.MaxLimit. Cursor and Offset are exclusive.
+	Pagination struct {
+		Cursor string `form:"cursor" json:"-" example:"WyIyMDI0LTAxLTAxVDAwOjAwOjAwWiIsIjEiXQ"`
+		Limit  uint64 `form:"limit" json:"-" example:"20"`
+		Offset uint64 `form:"offset" json:"-" example:"0"`
+	}
+	// Page is the RESP of list endpoints. NextCursor is empty on the last page, or if the endpoint uses offset based pagination.
+	Page[T any] struct {
+		Items      []*T   `json:"items"`
+		NextCursor string `json:"nextCursor,omitempty" example:"WyIyMDI0LTAxLTAxVDAwOjAwOjAwWiIsIjEiXQ"`
+	}
+	// ErrorCode is an entry of the error code catalogue. See RegisterErrorCode.
+	ErrorCode struct {
+		Code           string `json:"code" example:"USER_NOT_FOUND"`
+		Message        string `json:"message" example:"user not found"`
+		TranslationKey string `json:"translationKey,omitempty" example:"errors.user_not_found"`
+		Status         int    `json:"status" example:"404"`
+	}
 	// ErrorResponse is the struct that is eventually serialized as a negative response back to the user.
 	ErrorResponse struct {
 		error `json:"-" swaggerignore:"true"`
@@ -61,12 +198,118 @@ type (
 		HTTPServer struct {
 			CertPath string `yaml:"certPath"`
 			KeyPath  string `yaml:"keyPath"`
-			Port     uint16 `yaml:"port"`
+			// ClientCAPath enables mTLS: the client certificates, if any, must be signed by one of these CAs. Services can use them to get tokens.
+			ClientCAPath string `yaml:"clientCAPath"` //nolint:tagliatelle // Nope.
+			Port         uint16 `yaml:"port"`
+			// HTTP3 enables an additional HTTP/3 (QUIC) listener, on the same port, over UDP, advertised via the Alt-Svc header.
+			HTTP3 bool `yaml:"http3"`
 		} `yaml:"httpServer"`
+		GRPCServer struct {
+			// AllowUnauthorizedMethods are the full gRPC method names, i.e. `/package.Service/Method`, that can be called without a token.
+			AllowUnauthorizedMethods []string `yaml:"allowUnauthorizedMethods"`
+			// MethodScopes are the scopes required to call the full gRPC method names, like the `scopes` tag does for http endpoints.
+			// Service tokens can call only these methods.
+			MethodScopes map[string][]string `yaml:"methodScopes"`
+			// Port is where gRPC is served. It's disabled if not set. If it's the same as HTTPServer.Port, it's served by the http server, over HTTP/2.
+			Port uint16 `yaml:"port"`
+		} `yaml:"grpcServer"`
+		RateLimiter struct {
+			// ServiceTokens limits the requests for service tokens, per client IP and per client id, i.e. `10/1m`, which is the default.
+			ServiceTokens string `yaml:"serviceTokens"`
+			Distributed   bool   `yaml:"distributed"`
+		} `yaml:"rateLimiter"`
+		Idempotency struct {
+			// Storage is either `v2` (postgres) or `v3` (redis). `Idempotency-Key` headers are ignored if it's not set.
+			Storage string        `yaml:"storage"`
+			TTL     time.Duration `yaml:"ttl"`
+		} `yaml:"idempotency"`
+		CORS struct {
+			AllowedOrigins   []string      `yaml:"allowedOrigins"` // `*` allows any origin, without credentials. CORS is disabled if empty.
+			AllowedMethods   []string      `yaml:"allowedMethods"`
+			AllowedHeaders   []string      `yaml:"allowedHeaders"`
+			ExposedHeaders   []string      `yaml:"exposedHeaders"`
+			MaxAge           time.Duration `yaml:"maxAge"`
+			AllowCredentials bool          `yaml:"allowCredentials"`
+		} `yaml:"cors"`
+		SecurityHeaders struct {
+			ContentSecurityPolicy string        `yaml:"contentSecurityPolicy"`
+			HSTSMaxAge            time.Duration `yaml:"hstsMaxAge"` // Defaults to 1 year.
+			Disabled              bool          `yaml:"disabled"`
+		} `yaml:"securityHeaders"`
+		Host                   string        `yaml:"host"`
+		Version                string        `yaml:"version"`
 		DefaultEndpointTimeout time.Duration `yaml:"defaultEndpointTimeout"`
+		// EndpointTimeouts overrides DefaultEndpointTimeout for specific routes, keyed by `METHOD /full/path`, i.e. `GET /v1/users/:userId`.
+		EndpointTimeouts map[string]time.Duration `yaml:"endpointTimeouts"`
+		// MaxRequestBodySize is the maximum size, in bytes, of request bodies. Bigger ones are rejected with 413. There's no limit if it's not set.
+		MaxRequestBodySize int64 `yaml:"maxRequestBodySize"`
+		WebSockets         struct {
+			PingInterval   time.Duration `yaml:"pingInterval"`   // Defaults to 30s.
+			PongTimeout    time.Duration `yaml:"pongTimeout"`    // Defaults to 60s.
+			WriteTimeout   time.Duration `yaml:"writeTimeout"`   // Defaults to 10s.
+			MaxMessageSize int64         `yaml:"maxMessageSize"` // Defaults to 64KB.
+			SendBufferSize int           `yaml:"sendBufferSize"` // Defaults to 64 messages.
+		} `yaml:"webSockets"`
+		// DrainPeriod is how long the server keeps serving, while reporting itself as not ready, after receiving SIGTERM/SIGINT.
+		// It gives load balancers the time to stop routing new requests to it, before it actually shuts down.
+		DrainPeriod       time.Duration `yaml:"drainPeriod"`
+		DefaultPagination struct {
+			Limit    uint64 `yaml:"limit"`    // Defaults to 20.
+			MaxLimit uint64 `yaml:"maxLimit"` // Defaults to 1000.
+		} `yaml:"defaultPagination"`
+		Audit struct {
+			// Sink is either `log`, `v2` (postgres) or `messageBroker`. Auditing is disabled if it's not set, unless the State is an AuditState.
+			Sink       string `yaml:"sink"`
+			Topic      string `yaml:"topic"`      // Required for the `messageBroker` sink.
+			BufferSize int    `yaml:"bufferSize"` // Defaults to 1024 entries. New entries are dropped while it's full.
+		} `yaml:"audit"`
+		Metrics struct {
+			// ListenAddress, i.e. `:9090`, is where `/metrics` is served, over plain http. Metrics aren't exposed if it's not set.
+			ListenAddress string `yaml:"listenAddress"`
+		} `yaml:"metrics"`
+		// LocalizeErrors translates the messages of registered error codes in the X-Language of the request.
+		// It requires the `wintr/translations` config, under the same key.
+		LocalizeErrors bool `yaml:"localizeErrors"`
 	}
 )
 
+// IdempotencyStoreDDL is the schema required by the storage/v2 (postgres) IdempotencyStore.
+const IdempotencyStoreDDL = `
+create table if not exists idempotent_responses
+(
+    expires_at  timestamp not null,
+    code        integer,
+    completed   boolean not null default false,
+    key         text not null primary key,
+    fingerprint text not null,
+    headers     jsonb,
+    body        bytea
+);
+----
+create index if not exists idempotent_responses_expires_at_ix on idempotent_responses (expires_at);`
+
+// AuditLogDDL is the schema required by the storage/v2 (postgres) AuditSink.
+const AuditLogDDL = `
+create table if not exists audit_log
+(
+    created_at  timestamp not null,
+    latency     bigint not null,
+    code        integer not null,
+    user_id     text,
+    client_ip   text,
+    method      text not null,
+    route       text not null,
+    payload     jsonb
+);
+----
+create index if not exists audit_log_user_id_created_at_ix on audit_log (user_id, created_at);`
+
+var (
+	ErrIdempotentRequestInProgress = errors.New("idempotent request in progress")
+	ErrIdempotencyKeyReused        = errors.New("idempotency key reused for a different request")
+	ErrWebSocketClosed             = errors.New("websocket closed")
+)
+
 // Private API.
 
 const (
@@ -77,11 +320,102 @@ const (
 	formMultipart
 )
 
+const (
+	// | validateTag holds go-playground/validator rules, i.e. `validate:"min=3,max=10"`, `validate:"oneof=a b"`, `validate:"regexp=^[a-z]+$"`.
+	// | Because `,` and `|` separate the rules, `regexp` patterns can't contain them. The patterns are compiled when the handler is built.
+	validateTag         = "validate"
+	missingPropertyCode = "MISSING"
+	// | rolesTag holds the comma separated roles allowed to call the endpoint, i.e. `roles:"admin,moderator"`.
+	rolesTag = "roles"
+	// | requiredClaimsTag holds the comma separated custom claims that must be set, optionally to a specific value, i.e. `requiredClaims:"kycPassed=true,tenant"`.
+	requiredClaimsTag = "requiredClaims"
+	// | mfaTag requires the user to have passed a second factor (see auth.StepUpTOTP) in the specified duration, i.e. `mfa:"5m"`.
+	mfaTag = "mfa"
+	// | scopesTag holds the comma separated scopes that the service token (see auth.IssueServiceToken) must have, i.e. `scopes:"users:read"`. End-users can't call the endpoint.
+	scopesTag = "scopes"
+	// | redactTag hides the value of the field from the audit trail, i.e. `redact:"true"`. privacy.Sensitive values are always redacted.
+	redactTag = "redact"
+)
+
+const (
+	openAPIVersion    = "3.1.0"
+	openAPIBearerAuth = "BearerAuth"
+)
+
+const (
+	contentTypeJSON     = "application/json"
+	contentTypeMsgPack  = "application/msgpack"
+	contentTypeXMsgPack = "application/x-msgpack"
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeOctet    = "application/octet-stream"
+	contentTypeCSV      = "text/csv; charset=utf-8"
+	contentTypeSSE      = "text/event-stream"
+)
+
 const (
 	languageHeader              = "X-Language"
 	requestingUserIDCtxValueKey = "requestingUserIDCtxValueKey"
 
-	authClientCtxValueKey = "authClientCtxValueKey"
+	authClientCtxValueKey  = "authClientCtxValueKey"
+	rateLimiterCtxValueKey = "rateLimiterCtxValueKey"
+
+	rateLimitCleanupInterval = 1 * time.Minute
+	inFlightPollInterval     = 50 * time.Millisecond
+	shutDownCloseTimeout     = 10 * time.Second
+	defaultHSTSMaxAge        = 365 * 24 * time.Hour
+
+	authenticatedUserCtxValueKey = "authenticatedUserCtxValueKey"
+	grpcContentType              = "application/grpc"
+	altSvcMaxAge                 = 24 * time.Hour
+	grpcErrorDomain              = "ice.io"
+
+	webSocketsCtxValueKey          = "webSocketsCtxValueKey"
+	defaultWebSocketPingInterval   = 30 * time.Second
+	defaultWebSocketPongTimeout    = 60 * time.Second
+	defaultWebSocketWriteTimeout   = 10 * time.Second
+	defaultWebSocketMaxMessageSize = 64 * 1024
+	defaultWebSocketSendBufferSize = 64
+	webSocketReceiveBufferSize     = 16
+
+	etagHeader        = "ETag"
+	ifMatchHeader     = "If-Match"
+	ifNoneMatchHeader = "If-None-Match"
+	etagSize          = 16
+
+	defaultPaginationLimit    = 20
+	defaultPaginationMaxLimit = 1000
+
+	auditorCtxValueKey      = "auditorCtxValueKey"
+	auditSinkLog            = "log"
+	auditSinkStorageV2      = "v2"
+	auditSinkMessageBroker  = "messageBroker"
+	redactedValue           = "[REDACTED]"
+	privacyPackagePath      = "github.com/ice-blockchain/wintr/privacy"
+	defaultAuditBufferSize  = 1024
+	auditSinkRequestTimeout = 5 * time.Second
+	auditCloseTimeout       = 10 * time.Second
+
+	translationsCtxValueKey   = "translationsCtxValueKey"
+	errorTranslationKeyPrefix = "errors."
+	defaultErrorLanguage      = "en"
+
+	idempotencyHeader              = "Idempotency-Key"
+	idempotencyReplayedHeader      = "Idempotent-Replayed"
+	idempotencyStoreCtxValueKey    = "idempotencyStoreCtxValueKey"
+	idempotencyStorageV2           = "v2"
+	idempotencyStorageV3           = "v3"
+	idempotencyInFlightMarker      = "in-flight:"
+	idempotencyLockTTLMargin       = 5 * time.Second
+	defaultIdempotencyTTL          = 24 * time.Hour
+	idempotencyCleanupInterval     = 1 * time.Hour
+	idempotencyStoreRequestTimeout = 5 * time.Second
+
+	jwksCacheControl = "public, max-age=300"
+
+	serviceTokenPath             = "oauth/token"
+	defaultServiceTokenRateLimit = "10/1m"
+
+	metricsPath = "/metrics"
 )
 
 var (
@@ -95,12 +429,163 @@ type (
 	healthCheck struct {
 		_ struct{} `allowUnauthorized:"true"` //nolint:revive // It's processed by the router.
 	}
-	requestBinding uint8
+	requestBinding   uint8
+	paginatedRequest interface {
+		pagination() *Pagination
+	}
+	handlerOptions struct {
+		rateLimit      *RateLimit
+		rateLimitKey   RateLimitKeyFunc
+		requiredClaims map[string]string
+		roles          []string
+		scopes         []string
+		policies       []Policy
+		timeout        time.Duration
+		route          string
+		mfaMaxAge      time.Duration
+		audit          bool
+	}
+	auditor struct {
+		sink    AuditSink
+		entries chan *AuditEntry
+		done    chan struct{}
+		mx      sync.RWMutex
+		closed  bool
+	}
+	logAuditSink      struct{}
+	postgresAuditSink struct {
+		db *storagev2.DB
+	}
+	messageBrokerAuditSink struct {
+		client messagebroker.Client
+		topic  string
+	}
+	inMemoryRateLimiter struct {
+		limiters *sync.Map // Is a map[string]*inMemoryRateLimit.
+	}
+	inMemoryRateLimit struct {
+		*rate.Limiter
+		lastSeenAt atomic.Int64
+		per        time.Duration
+	}
+	distributedRateLimiter struct {
+		db storage.DB
+	}
+	redisIdempotencyStore struct {
+		db storage.DB
+	}
+	postgresIdempotencyStore struct {
+		db *storagev2.DB
+	}
+	idempotentRequest struct {
+		store       IdempotencyStore
+		stored      *IdempotentResponse
+		recorder    *responseRecorder
+		key         string
+		fingerprint string
+	}
+	fingerprintedBody struct {
+		io.Reader
+		io.Closer
+	}
+	errorCodeRegistry struct {
+		codes map[string]*ErrorCode
+		mx    sync.RWMutex
+	}
+	responseRecorder struct {
+		gin.ResponseWriter
+		body *bytes.Buffer
+	}
+	openAPISchema             = map[string]any
+	openAPIOperationDescriber func(*openAPIBuilder) *openAPIOperation
+	openAPIBuilder            struct {
+		schemas map[string]openAPISchema
+		names   map[reflect.Type]string
+	}
+	openAPIDocument struct {
+		Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+		Info       openAPIInfo                             `json:"info"`
+		OpenAPI    string                                  `json:"openapi"`
+		Servers    []openAPIServer                         `json:"servers,omitempty"`
+		Components struct {
+			Schemas         map[string]openAPISchema `json:"schemas,omitempty"`
+			SecuritySchemes map[string]openAPISchema `json:"securitySchemes,omitempty"`
+		} `json:"components"`
+	}
+	openAPIInfo struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	}
+	openAPIServer struct {
+		URL string `json:"url"`
+	}
+	openAPIOperation struct {
+		RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+		Responses   map[string]*openAPIResponse `json:"responses"`
+		OperationID string                      `json:"operationId"`
+		Tags        []string                    `json:"tags,omitempty"`
+		Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+		Security    []map[string][]string       `json:"security,omitempty"`
+		XRoles      []string                    `json:"x-roles,omitempty"`
+	}
+	openAPIParameter struct {
+		Schema   openAPISchema `json:"schema"`
+		Name     string        `json:"name"`
+		In       string        `json:"in"`
+		Required bool          `json:"required,omitempty"`
+	}
+	openAPIRequestBody struct {
+		Content  map[string]openAPIMediaType `json:"content"`
+		Required bool                        `json:"required,omitempty"`
+	}
+	openAPIResponse struct {
+		Content     map[string]openAPIMediaType `json:"content,omitempty"`
+		Description string                      `json:"description"`
+	}
+	openAPIMediaType struct {
+		Schema openAPISchema `json:"schema"`
+	}
+	webSocket struct {
+		conn      *websocket.Conn
+		send      chan []byte
+		received  chan []byte
+		closed    chan struct{}
+		done      chan struct{}
+		closeOnce sync.Once
+		closeCode int
+	}
+	webSockets struct {
+		sockets map[*webSocket]struct{}
+		wg      sync.WaitGroup
+		mx      sync.Mutex
+		closing bool
+	}
+	// | valuesContext is a context that falls back to another context's values, while keeping its own cancellation.
+	valuesContext struct {
+		context.Context //nolint:containedctx // It's the only way to merge them.
+		values          context.Context
+	}
+	grpcServerStream struct {
+		grpc.ServerStream
+		ctx context.Context //nolint:containedctx // It's the only way to override it.
+	}
 	// | srv is the internal representation of everything needed to bootstrap the http server.
 	srv struct {
 		State
 		server             *http.Server
+		metricsServer      *http.Server
+		http3Server        *http3.Server
 		router             *Router
+		authClient         auth.Client
+		rateLimiter        RateLimiter
+		idempotencyStore   IdempotencyStore
+		auditor            *auditor
+		shutdownTracing    tracing.Shutdown
+		inFlight           atomic.Int64
+		ready              atomic.Bool
+		webSockets         *webSockets
+		grpcServer         *grpc.Server
+		grpcHealth         *health.Server
 		quit               chan<- os.Signal
 		swaggerRoot        string
 		nginxPrefix        string
@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/ice-blockchain/wintr/log"
+	"github.com/ice-blockchain/wintr/translations"
+)
+
+//nolint:gochecknoglobals // It's a process wide catalogue, populated when packages are initialized.
+var errorCodes = &errorCodeRegistry{codes: make(map[string]*ErrorCode)}
+
+//nolint:gochecknoinits // The codes used by this package are part of every catalogue.
+func init() {
+	for code, cfg := range map[string]struct {
+		message string
+		status  int
+	}{
+		"MISSING_PROPERTIES":          {message: "some properties are missing", status: http.StatusUnprocessableEntity},
+		"INVALID_PROPERTIES":          {message: "some properties are invalid", status: http.StatusUnprocessableEntity},
+		"STRUCTURE_VALIDATION_FAILED": {message: "the request is malformed", status: http.StatusUnprocessableEntity},
+		"INVALID_TOKEN":               {message: "the token is invalid", status: http.StatusUnauthorized},
+		"OPERATION_NOT_ALLOWED":       {message: "operation not allowed", status: http.StatusForbidden},
+		"ROLE_NOT_ALLOWED":            {message: "your role is not allowed to do this", status: http.StatusForbidden},
+		"MISSING_REQUIRED_CLAIM":      {message: "you're not allowed to do this yet", status: http.StatusForbidden},
+		"MFA_REQUIRED":                {message: "confirm it's you with your second factor", status: http.StatusForbidden},
+		"MISSING_SCOPE":               {message: "the service is not allowed to do this", status: http.StatusForbidden},
+		"SERVICE_TOKEN_NOT_ALLOWED":   {message: "services are not allowed to do this", status: http.StatusForbidden},
+		"PRECONDITION_FAILED":         {message: "the resource was changed in the meantime", status: http.StatusPreconditionFailed},
+		"REQUEST_IN_PROGRESS":         {message: "the request is already in progress", status: http.StatusConflict},
+		"IDEMPOTENCY_KEY_REUSED":      {message: "the idempotency key was used for a different request", status: http.StatusUnprocessableEntity},
+		"REQUEST_BODY_TOO_LARGE":      {message: "the request is too large", status: http.StatusRequestEntityTooLarge},
+		"RATE_LIMIT_EXCEEDED":         {message: "too many requests, try again later", status: http.StatusTooManyRequests},
+		"NOT_READY":                   {message: "the service is not ready", status: http.StatusServiceUnavailable},
+	} {
+		RegisterErrorCode(code, cfg.status, cfg.message, errorTranslationKeyPrefix+strings.ToLower(code))
+	}
+}
+
+// RegisterErrorCode adds a code to the catalogue. It's meant to be called when packages are initialized, i.e.
+//
+//	var ErrUserNotFound = server.RegisterErrorCode("USER_NOT_FOUND", http.StatusNotFound, "user not found", "errors.user_not_found")
+//
+// translationKey is optional. If set, and Config.LocalizeErrors is enabled, the message is translated in the user's language.
+// Registering the same code twice, with a different definition, panics.
+func RegisterErrorCode(code string, status int, message, translationKey string) *ErrorCode {
+	errCode := &ErrorCode{Code: code, Message: message, TranslationKey: translationKey, Status: status}
+	errorCodes.mx.Lock()
+	defer errorCodes.mx.Unlock()
+	if existing, found := errorCodes.codes[code]; found {
+		if *existing != *errCode {
+			log.Panic(errors.Errorf("error code %v is already registered as %#v", code, existing))
+		}
+
+		return existing
+	}
+	errorCodes.codes[code] = errCode
+
+	return errCode
+}
+
+// ErrorCodes returns the whole catalogue, sorted by code. It's also served, as JSON, at `/error-codes`.
+func ErrorCodes() []*ErrorCode {
+	errorCodes.mx.RLock()
+	defer errorCodes.mx.RUnlock()
+	codes := make([]*ErrorCode, 0, len(errorCodes.codes))
+	for _, code := range errorCodes.codes {
+		codes = append(codes, code)
+	}
+	slices.SortFunc(codes, func(a, b *ErrorCode) int { return cmp.Compare(a.Code, b.Code) })
+
+	return codes
+}
+
+// Fail builds the error response for this code, with its status and default message. err is only logged, it's never sent to the client.
+// The data is sent as is and, if the message is localized, its values can be used as `{{key}}` placeholders in the translation.
+func (e *ErrorCode) Fail(err error, dataArg ...map[string]any) *Response[ErrorResponse] {
+	var data map[string]any
+	if len(dataArg) == 1 {
+		data = dataArg[0]
+	}
+	if err == nil {
+		err = errors.New(e.Message)
+	}
+
+	return &Response[ErrorResponse]{
+		Data: &ErrorResponse{
+			error: err,
+			Error: e.Message,
+			Code:  e.Code,
+			Data:  data,
+		},
+		Code: e.Status,
+	}
+}
+
+func lookupErrorCode(code string) (*ErrorCode, bool) {
+	errorCodes.mx.RLock()
+	defer errorCodes.mx.RUnlock()
+	errCode, found := errorCodes.codes[code]
+
+	return errCode, found
+}
+
+// localize replaces the message of registered codes with its translation in the specified language, if translations are enabled.
+// The response is left as is, if anything goes wrong.
+func localize(ctx context.Context, language string, resp *ErrorResponse) *ErrorResponse {
+	translator, ok := ctx.Value(translationsCtxValueKey).(translations.Client)
+	if !ok || resp == nil || resp.Code == "" {
+		return resp
+	}
+	errCode, found := lookupErrorCode(resp.Code)
+	if !found || errCode.TranslationKey == "" {
+		return resp
+	}
+	if language == "" {
+		language = defaultErrorLanguage
+	}
+	args := make(translations.TranslationArgs, len(resp.Data))
+	for k, v := range resp.Data {
+		args[k] = fmt.Sprint(v)
+	}
+	message, err := translator.Translate(ctx, language, errCode.TranslationKey, args)
+	if err != nil {
+		log.Error(errors.Wrapf(err, "failed to translate error code %v to %v", resp.Code, language))
+
+		return resp
+	}
+	localized := *resp
+	localized.Error = message
+
+	return &localized
+}
+
+func (s *srv) setupErrorCodesRoutes() {
+	s.router.GET("error-codes", func(ginCtx *gin.Context) {
+		ctx, language := ginCtx.Request.Context(), ginCtx.GetHeader(languageHeader)
+		codes := ErrorCodes()
+		for ix, code := range codes {
+			if localized := localize(ctx, language, code.Fail(nil).Data); localized.Error != code.Message {
+				codes[ix] = &ErrorCode{Code: code.Code, Message: localized.Error, TranslationKey: code.TranslationKey, Status: code.Status}
+			}
+		}
+		ginCtx.JSON(http.StatusOK, codes)
+	})
+}
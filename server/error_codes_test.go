@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	gojson "github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/translations"
+)
+
+type (
+	errorCodesTestTranslations struct {
+		translations.Client
+	}
+)
+
+func (errorCodesTestTranslations) Translate(
+	_ context.Context, lang translations.Language, key translations.TranslationKey, args ...translations.TranslationArgs,
+) (translations.TranslationValue, error) {
+	if lang != "ro" {
+		return "", errors.Errorf("language %v not supported", lang)
+	}
+	value := lang + ":" + key
+	for _, arg := range args {
+		for k, v := range arg {
+			value += ":" + k + "=" + v
+		}
+	}
+
+	return value, nil
+}
+
+func TestRegisterErrorCode(t *testing.T) {
+	t.Parallel()
+	code := RegisterErrorCode("TEST_REGISTER_ERROR_CODE", http.StatusNotFound, "not found", "errors.test")
+	assert.Same(t, code, RegisterErrorCode("TEST_REGISTER_ERROR_CODE", http.StatusNotFound, "not found", "errors.test"))
+	assert.Panics(t, func() { RegisterErrorCode("TEST_REGISTER_ERROR_CODE", http.StatusConflict, "not found", "errors.test") })
+	codes := ErrorCodes()
+	assert.Contains(t, codes, code)
+	for ix := 1; ix < len(codes); ix++ {
+		assert.Less(t, codes[ix-1].Code, codes[ix].Code)
+	}
+
+	resp := code.Fail(errors.New("internal details"), map[string]any{"userId": "bogus"})
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "TEST_REGISTER_ERROR_CODE", resp.Data.Code)
+	assert.Equal(t, "not found", resp.Data.Error)
+	assert.EqualError(t, resp.Data.InternalErr(), "internal details")
+	assert.EqualError(t, code.Fail(nil).Data.InternalErr(), "not found")
+}
+
+func TestLocalize(t *testing.T) {
+	t.Parallel()
+	code := RegisterErrorCode("TEST_LOCALIZE", http.StatusBadRequest, "bad", "errors.test_localize")
+	untranslated := RegisterErrorCode("TEST_LOCALIZE_UNTRANSLATED", http.StatusBadRequest, "bad", "")
+	ctx := context.WithValue(t.Context(), translationsCtxValueKey, errorCodesTestTranslations{}) //nolint:staticcheck,revive // .
+
+	assert.Equal(t, "ro:errors.test_localize:field=name", localize(ctx, "ro", code.Fail(nil, map[string]any{"field": "name"}).Data).Error)
+	assert.Equal(t, "bad", localize(ctx, "en", code.Fail(nil).Data).Error)
+	assert.Equal(t, "bad", localize(ctx, "ro", untranslated.Fail(nil).Data).Error)
+	assert.Equal(t, "bad", localize(t.Context(), "ro", code.Fail(nil).Data).Error)
+	assert.Equal(t, "unknown", localize(ctx, "ro", BadRequest(errors.New("unknown"), "TEST_LOCALIZE_UNKNOWN").Data).Error)
+
+	resp := code.Fail(nil)
+	localize(ctx, "ro", resp.Data)
+	assert.Equal(t, "bad", resp.Data.Error)
+}
+
+func TestErrorCodesRoute(t *testing.T) {
+	t.Parallel()
+	RegisterErrorCode("TEST_ERROR_CODES_ROUTE", http.StatusConflict, "conflict", "errors.test_error_codes_route")
+	s := &srv{router: gin.New()}
+	s.setupErrorCodesRoutes()
+	ctx := context.WithValue(t.Context(), translationsCtxValueKey, errorCodesTestTranslations{}) //nolint:staticcheck,revive // .
+
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/error-codes", http.NoBody)
+	req.Header.Set(languageHeader, "ro")
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var codes []*ErrorCode
+	require.NoError(t, gojson.Unmarshal(recorder.Body.Bytes(), &codes))
+	found := false
+	for _, code := range codes {
+		if code.Code == "TEST_ERROR_CODES_ROUTE" {
+			found = true
+			assert.Equal(t, &ErrorCode{
+				Code:           "TEST_ERROR_CODES_ROUTE",
+				Message:        "ro:errors.test_error_codes_route",
+				TranslationKey: "errors.test_error_codes_route",
+				Status:         http.StatusConflict,
+			}, code)
+		}
+	}
+	assert.True(t, found)
+	registered, _ := lookupErrorCode("TEST_ERROR_CODES_ROUTE")
+	assert.Equal(t, "conflict", registered.Message)
+}
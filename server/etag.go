@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	ginjson "github.com/gin-gonic/gin/codec/json"
+	"github.com/pkg/errors"
+
+	"github.com/ice-blockchain/wintr/log"
+)
+
+// ETag computes the strong ETag of the JSON representation of the value. It's the same one that GET endpoints respond with,
+// unless they set their own `ETag` header, so it can be used to check the `If-Match` header of writes, via Request.CheckIfMatch.
+func ETag(value any) (string, error) {
+	body, err := ginjson.API.Marshal(value)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to encode %T", value)
+	}
+
+	return etag(body), nil
+}
+
+// CheckIfMatch fails with 412 Precondition Failed if the request has an `If-Match` header that doesn't match the current ETag of the resource,
+// meaning that the client would overwrite changes it hasn't seen.
+func (req *Request[REQ, RESP]) CheckIfMatch(currentETag string) *Response[ErrorResponse] {
+	ifMatch := req.ginCtx.GetHeader(ifMatchHeader)
+	if ifMatch == "" || etagMatches(ifMatch, currentETag, false) {
+		return nil
+	}
+
+	return PreconditionFailed(errors.Errorf("%v `%v` doesn't match the current ETag `%v`", ifMatchHeader, ifMatch, currentETag), "PRECONDITION_FAILED")
+}
+
+// renderJSON writes the JSON response with an ETag, for successful GETs, and responds with 304 Not Modified if it matches `If-None-Match`.
+// If the handler already set the `ETag` header, it's used as is, and the response isn't even encoded, if it's not needed.
+func renderJSON(ginCtx *gin.Context, code int, data any) {
+	if code != http.StatusOK || (ginCtx.Request.Method != http.MethodGet && ginCtx.Request.Method != http.MethodHead) {
+		ginCtx.JSON(code, data)
+
+		return
+	}
+	var body []byte
+	tag := ginCtx.Writer.Header().Get(etagHeader)
+	if tag == "" {
+		var err error
+		if body, err = ginjson.API.Marshal(data); err != nil {
+			log.Error(errors.Wrapf(err, "failed to encode %T as json", data))
+			ginCtx.Status(http.StatusInternalServerError)
+
+			return
+		}
+		tag = etag(body)
+		ginCtx.Header(etagHeader, tag)
+	}
+	if etagMatches(ginCtx.GetHeader(ifNoneMatchHeader), tag, true) {
+		ginCtx.Status(http.StatusNotModified)
+
+		return
+	}
+	if body == nil {
+		ginCtx.JSON(code, data)
+
+		return
+	}
+	ginCtx.Data(code, "application/json; charset=utf-8", body)
+}
+
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:etagSize]) + `"`
+}
+
+// etagMatches checks if any of the comma separated tags of the header matches the ETag. Weak comparison ignores the `W/` prefix.
+func etagMatches(header, tag string, weak bool) bool {
+	if header == "" || tag == "" {
+		return false
+	}
+	if weak {
+		tag = strings.TrimPrefix(tag, "W/")
+	} else if strings.HasPrefix(tag, "W/") {
+		return false
+	}
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/auth"
+)
+
+type (
+	etagTestRequest struct {
+		Name string `json:"name"`
+	}
+	etagTestProfile struct {
+		Name string `json:"name"`
+	}
+)
+
+func TestETagMatches(t *testing.T) {
+	t.Parallel()
+	assert.True(t, etagMatches(`"a"`, `"a"`, false))
+	assert.True(t, etagMatches(`"b", "a"`, `"a"`, false))
+	assert.True(t, etagMatches(`*`, `"a"`, false))
+	assert.True(t, etagMatches(`W/"a"`, `"a"`, true))
+	assert.False(t, etagMatches(`W/"a"`, `"a"`, false))
+	assert.False(t, etagMatches(`"a"`, `W/"a"`, false))
+	assert.False(t, etagMatches(`"b"`, `"a"`, true))
+	assert.False(t, etagMatches(``, `"a"`, true))
+}
+
+func TestConditionalRequests(t *testing.T) {
+	t.Parallel()
+	profile := &etagTestProfile{Name: "bogus"}
+	currentETag, err := ETag(profile)
+	require.NoError(t, err)
+	router := gin.New()
+	router.GET("/profile", RootHandler(func(_ context.Context, _ *Request[etagTestRequest, etagTestProfile]) (*Response[etagTestProfile], *Response[ErrorResponse]) { //nolint:lll // .
+		return OK(profile), nil
+	}))
+	router.GET("/versioned", RootHandler(func(_ context.Context, _ *Request[etagTestRequest, etagTestProfile]) (*Response[etagTestProfile], *Response[ErrorResponse]) { //nolint:lll // .
+		resp := OK(profile)
+		resp.Headers = map[string]string{"ETag": `W/"v1"`}
+
+		return resp, nil
+	}))
+	router.PUT("/profile", RootHandler(func(_ context.Context, req *Request[etagTestRequest, etagTestProfile]) (*Response[etagTestProfile], *Response[ErrorResponse]) { //nolint:lll // .
+		if errResp := req.CheckIfMatch(currentETag); errResp != nil {
+			return nil, errResp
+		}
+
+		return OK(&etagTestProfile{Name: req.Data.Name}), nil
+	}))
+	call := func(method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		ctx := context.WithValue(t.Context(), authClientCtxValueKey, auth.Client(new(webSocketTestAuth))) //nolint:staticcheck,revive // .
+		req := httptest.NewRequestWithContext(ctx, method, path, strings.NewReader(`{"name":"foo"}`))
+		req.Header.Set("Authorization", "Bearer valid")
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := call(http.MethodGet, "/profile", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, currentETag, recorder.Header().Get("ETag"))
+	assert.JSONEq(t, `{"name":"bogus"}`, recorder.Body.String())
+
+	recorder = call(http.MethodGet, "/profile", map[string]string{"If-None-Match": `"other", ` + currentETag})
+	require.Equal(t, http.StatusNotModified, recorder.Code)
+	assert.Equal(t, currentETag, recorder.Header().Get("ETag"))
+	assert.Empty(t, recorder.Body.String())
+
+	recorder = call(http.MethodGet, "/profile", map[string]string{"If-None-Match": `"other"`})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = call(http.MethodGet, "/versioned", map[string]string{"If-None-Match": `"v1"`})
+	require.Equal(t, http.StatusNotModified, recorder.Code)
+	assert.Equal(t, `W/"v1"`, recorder.Header().Get("ETag"))
+
+	recorder = call(http.MethodPut, "/profile", map[string]string{"If-Match": `"stale"`})
+	require.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "PRECONDITION_FAILED")
+
+	recorder = call(http.MethodPut, "/profile", map[string]string{"If-Match": currentETag})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("ETag"))
+	assert.JSONEq(t, `{"name":"foo"}`, recorder.Body.String())
+
+	recorder = call(http.MethodPut, "/profile", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,250 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/ice-blockchain/wintr/auth"
+	"github.com/ice-blockchain/wintr/log"
+)
+
+// GRPCStatus converts the ErrorResponse to a gRPC status error, so that gRPC services can fail with the same codes as http endpoints.
+// The ErrorResponse code is sent as the reason of an ErrorInfo detail.
+func GRPCStatus(resp *Response[ErrorResponse]) error {
+	st := status.New(grpcCode(resp.Code), resp.Data.Error)
+	if resp.Data.Code == "" {
+		return st.Err() //nolint:wrapcheck // It's a status.
+	}
+	info := &errdetails.ErrorInfo{Reason: resp.Data.Code, Domain: grpcErrorDomain, Metadata: make(map[string]string, len(resp.Data.Data))}
+	for k, v := range resp.Data.Data {
+		info.Metadata[k] = fmt.Sprint(v)
+	}
+	if withDetails, err := st.WithDetails(info); err == nil {
+		st = withDetails
+	}
+
+	return st.Err() //nolint:wrapcheck // It's a status.
+}
+
+// AuthenticatedUserFromContext returns the user authenticated by the gRPC interceptors, if any.
+func AuthenticatedUserFromContext(ctx context.Context) *AuthenticatedUser {
+	user, _ := ctx.Value(authenticatedUserCtxValueKey).(*AuthenticatedUser) //nolint:errcheck // It's nil if not found.
+
+	return user
+}
+
+//nolint:gocyclo,revive,cyclop // It's a mapping.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	default:
+		return codes.Internal
+	}
+}
+
+func (s *srv) setupGRPCServer(ctx context.Context) {
+	grpcState, ok := s.State.(GRPCState)
+	if cfg.GRPCServer.Port == 0 || !ok {
+		return
+	}
+	authClient := Auth(ctx)
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(unaryInterceptor(authClient)),
+		grpc.ChainStreamInterceptor(streamInterceptor(authClient)),
+	}
+	if cfg.GRPCServer.Port != cfg.HTTPServer.Port {
+		creds, err := credentials.NewServerTLSFromFile(cfg.HTTPServer.CertPath, cfg.HTTPServer.KeyPath)
+		log.Panic(errors.Wrap(err, "failed to load grpc server tls credentials")) //nolint:revive // That's intended.
+		opts = append(opts, grpc.Creds(creds))
+	}
+	s.grpcServer = grpc.NewServer(opts...)
+	s.grpcHealth = health.NewServer()
+	healthpb.RegisterHealthServer(s.grpcServer, s.grpcHealth)
+	grpcState.RegisterGRPCServices(s.grpcServer)
+}
+
+// handler serves gRPC requests sent to the http server, if they share the same port.
+func (s *srv) handler() http.Handler {
+	if s.grpcServer == nil || cfg.GRPCServer.Port != cfg.HTTPServer.Port {
+		return s.router
+	}
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor == 2 && strings.HasPrefix(req.Header.Get("Content-Type"), grpcContentType) {
+			s.grpcServer.ServeHTTP(writer, req)
+		} else {
+			s.router.ServeHTTP(writer, req)
+		}
+	})
+}
+
+func (s *srv) startGRPCServer() {
+	if s.grpcServer == nil || cfg.GRPCServer.Port == cfg.HTTPServer.Port {
+		return
+	}
+	defer log.Info("grpc server stopped listening")
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%v", cfg.GRPCServer.Port))
+	if err != nil {
+		s.quit <- syscall.SIGTERM
+		log.Error(errors.Wrap(err, "grpc server failed to listen"))
+
+		return
+	}
+	log.Info(fmt.Sprintf("grpc server started listening on %v...", cfg.GRPCServer.Port))
+	if err = s.grpcServer.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		s.quit <- syscall.SIGTERM
+		log.Error(errors.Wrap(err, "grpcServer.Serve failed"))
+	}
+}
+
+func (s *srv) stopGRPCServer(ctx context.Context) {
+	if s.grpcServer == nil {
+		return
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		s.grpcServer.GracefulStop()
+	}()
+	select {
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		log.Error(errors.Wrap(ctx.Err(), "grpc server graceful stop timed out"))
+	case <-stopped:
+		log.Info("grpc server shutdown succeeded")
+	}
+}
+
+func unaryInterceptor(authClient auth.Client) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer logGRPCCall(info.FullMethod, time.Now(), &err)
+		if ctx, err = authenticateGRPCCall(ctx, authClient, info.FullMethod); err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(ctx, cfg.DefaultEndpointTimeout)
+		defer cancel()
+		resp, err = handler(ctx, req)
+
+		return resp, grpcError(ctx, err)
+	}
+}
+
+func streamInterceptor(authClient auth.Client) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer logGRPCCall(info.FullMethod, time.Now(), &err)
+		ctx, err := authenticateGRPCCall(stream.Context(), authClient, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return grpcError(ctx, handler(srv, &grpcServerStream{ServerStream: stream, ctx: ctx}))
+	}
+}
+
+// authenticateGRPCCall does, for gRPC metadata, what Request.authorize and Request.checkPolicies do for http headers.
+// Service tokens are accepted only for the methods in Config.GRPCServer.MethodScopes, if they have all their scopes.
+func authenticateGRPCCall(ctx context.Context, authClient auth.Client, fullMethod string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	firstValue := func(key string) string {
+		if values := md.Get(key); len(values) != 0 {
+			return values[0]
+		}
+
+		return ""
+	}
+	user := &AuthenticatedUser{Language: firstValue(strings.ToLower(languageHeader))}
+	allowUnauthorized := strings.HasPrefix(fullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") ||
+		slices.Contains(cfg.GRPCServer.AllowUnauthorizedMethods, fullMethod)
+	if authorization := firstValue("authorization"); !allowUnauthorized || authorization != "" {
+		token, errResp := verifyToken(ctx, authClient, authorization, firstValue("x-account-metadata"))
+		if errResp != nil && !allowUnauthorized {
+			return ctx, GRPCStatus(errResp)
+		}
+		if errResp == nil {
+			user.Token = *token
+		}
+	}
+	scopes := cfg.GRPCServer.MethodScopes[fullMethod]
+	if user.Provider == auth.ProviderService && len(scopes) == 0 {
+		return ctx, GRPCStatus(ForbiddenWithCode(errors.Errorf("service %v can't call methods without scopes", user.Claims["clientId"]), "SERVICE_TOKEN_NOT_ALLOWED"))
+	}
+	if len(scopes) != 0 {
+		if err := auth.RequireScopes(&user.Token, scopes...); err != nil {
+			return ctx, GRPCStatus(ForbiddenWithCode(errors.Wrap(err, "scopes required"), "MISSING_SCOPE", map[string]any{"scopes": scopes}))
+		}
+	}
+	ctx = context.WithValue(ctx, authClientCtxValueKey, authClient)        //nolint:staticcheck,revive // .
+	ctx = context.WithValue(ctx, authenticatedUserCtxValueKey, user)       //nolint:staticcheck,revive // .
+	ctx = context.WithValue(ctx, requestingUserIDCtxValueKey, user.UserID) //nolint:staticcheck,revive // .
+
+	return ctx, nil
+}
+
+// grpcError hides unexpected errors from the client, like processErrorResponse does for http.
+func grpcError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, isStatus := status.FromError(err); isStatus {
+		return err
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "request timed out") //nolint:wrapcheck // It's a status.
+	case errors.Is(err, context.Canceled) && errors.Is(ctx.Err(), context.Canceled):
+		return status.Error(codes.Canceled, "request canceled") //nolint:wrapcheck // It's a status.
+	default:
+		log.Error(errors.Wrap(err, "unexpected grpc error"))
+
+		return status.Error(codes.Internal, "oops, something went wrong") //nolint:wrapcheck // It's a status.
+	}
+}
+
+func logGRPCCall(fullMethod string, startedAt time.Time, err *error) {
+	if *err == nil {
+		return
+	}
+	st, _ := status.FromError(*err)
+	log.Error(errors.Wrapf(*err, "grpc endpoint %v failed", fullMethod), "code", st.Code().String(), "latency", time.Since(startedAt).String())
+}
+
+func (s *grpcServerStream) Context() context.Context {
+	return s.ctx
+}
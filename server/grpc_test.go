@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCStatus(t *testing.T) {
+	t.Parallel()
+	st, ok := status.FromError(GRPCStatus(NotFound(errors.New("user not found"), "USER_NOT_FOUND", map[string]any{"userId": 1})))
+	require.True(t, ok)
+	assert.Equal(t, codes.NotFound, st.Code())
+	assert.Equal(t, "user not found", st.Message())
+	require.Len(t, st.Details(), 1)
+	info := st.Details()[0].(*errdetails.ErrorInfo) //nolint:forcetypeassert // We know for sure.
+	assert.Equal(t, "USER_NOT_FOUND", info.GetReason())
+	assert.Equal(t, map[string]string{"userId": "1"}, info.GetMetadata())
+
+	st, _ = status.FromError(GRPCStatus(TooManyRequests(errors.New("slow down"), time.Second)))
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	st, _ = status.FromError(GRPCStatus(Unexpected(errors.New("oops"))))
+	assert.Equal(t, codes.Internal, st.Code())
+}
+
+//nolint:paralleltest // It changes the global config.
+func TestUnaryInterceptor(t *testing.T) {
+	previous := cfg
+	t.Cleanup(func() { cfg = previous })
+	cfg.DefaultEndpointTimeout = time.Second
+	cfg.GRPCServer.AllowUnauthorizedMethods = []string{"/test.Service/Public"}
+	interceptor := unaryInterceptor(new(webSocketTestAuth))
+	call := func(method, authorization string, handler grpc.UnaryHandler) (any, error) {
+		ctx := metadata.NewIncomingContext(t.Context(), metadata.Pairs("authorization", authorization, "x-language", "en"))
+
+		return interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	}
+	whoAmI := func(ctx context.Context, _ any) (any, error) {
+		user := AuthenticatedUserFromContext(ctx)
+
+		return user.UserID + ":" + user.Language, nil
+	}
+
+	resp, err := call("/test.Service/Private", "Bearer valid", whoAmI)
+	require.NoError(t, err)
+	assert.Equal(t, "bogus:en", resp)
+	_, err = call("/test.Service/Private", "Bearer invalid", whoAmI)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	resp, err = call("/test.Service/Public", "Bearer invalid", whoAmI)
+	require.NoError(t, err)
+	assert.Equal(t, ":en", resp)
+
+	_, err = call("/test.Service/Private", "Bearer valid", func(context.Context, any) (any, error) {
+		return nil, GRPCStatus(Forbidden(errors.New("nope")))
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = call("/test.Service/Private", "Bearer valid", func(context.Context, any) (any, error) {
+		return nil, errors.New("internal details")
+	})
+	assert.Equal(t, status.Error(codes.Internal, "oops, something went wrong"), err)
+	_, err = call("/test.Service/Private", "Bearer valid", func(ctx context.Context, _ any) (any, error) {
+		<-ctx.Done()
+
+		return nil, ctx.Err()
+	})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+//nolint:paralleltest // It changes the global config.
+func TestUnaryInterceptorServiceTokens(t *testing.T) {
+	previous := cfg
+	t.Cleanup(func() { cfg = previous })
+	cfg.DefaultEndpointTimeout = time.Second
+	cfg.GRPCServer.MethodScopes = map[string][]string{"/test.Service/Read": {"users:read"}, "/test.Service/Write": {"users:write"}}
+	interceptor := unaryInterceptor(new(serviceTokenTestAuth))
+	call := func(method, authorization string) error {
+		ctx := metadata.NewIncomingContext(t.Context(), metadata.Pairs("authorization", authorization))
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(context.Context, any) (any, error) { return "ok", nil })
+
+		return err
+	}
+
+	require.NoError(t, call("/test.Service/Read", "Bearer service"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call("/test.Service/Write", "Bearer service")))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call("/test.Service/Other", "Bearer service")))
+	require.NoError(t, call("/test.Service/Other", "Bearer user"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call("/test.Service/Read", "Bearer user")))
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/ice-blockchain/wintr/log"
+)
+
+func (s *srv) setupHTTP3Server(ctx context.Context, handler http.Handler) {
+	if !cfg.HTTPServer.HTTP3 {
+		return
+	}
+	s.http3Server = &http3.Server{
+		Addr:    fmt.Sprintf(":%v", cfg.HTTPServer.Port),
+		Handler: handler,
+		ConnContext: func(connCtx context.Context, _ *quic.Conn) context.Context {
+			return &valuesContext{Context: connCtx, values: ctx}
+		},
+	}
+}
+
+// advertiseHTTP3 lets clients know, via the Alt-Svc header, that they can switch to HTTP/3.
+func (s *srv) advertiseHTTP3(next http.Handler) http.Handler {
+	if s.http3Server == nil {
+		return next
+	}
+	altSvc := fmt.Sprintf(`h3=":%v"; ma=%v`, cfg.HTTPServer.Port, int64(altSvcMaxAge.Seconds()))
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor < 3 { //nolint:mnd,gomnd // It's the HTTP/3 version.
+			writer.Header().Set("Alt-Svc", altSvc)
+		}
+		next.ServeHTTP(writer, req)
+	})
+}
+
+func (s *srv) startHTTP3Server() {
+	if s.http3Server == nil {
+		return
+	}
+	defer log.Info("http3 server stopped listening")
+	log.Info(fmt.Sprintf("http3 server started listening on %v/udp...", cfg.HTTPServer.Port))
+	if err := s.http3Server.ListenAndServeTLS(cfg.HTTPServer.CertPath, cfg.HTTPServer.KeyPath); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error(errors.Wrap(err, "http3Server.ListenAndServeTLS failed"))
+	}
+}
+
+func (s *srv) shutDownHTTP3Server(ctx context.Context) {
+	if s.http3Server == nil {
+		return
+	}
+	if err := s.http3Server.Shutdown(ctx); err != nil {
+		log.Error(errors.Wrap(err, "http3 server shutdown failed"))
+		log.Error(errors.Wrap(s.http3Server.Close(), "http3 server close failed"))
+	} else {
+		log.Info("http3 server shutdown succeeded")
+	}
+}
+
+func (c *valuesContext) Value(key any) any {
+	if val := c.Context.Value(key); val != nil {
+		return val
+	}
+
+	return c.values.Value(key)
+}
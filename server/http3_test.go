@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//nolint:paralleltest // It changes the global config.
+func TestAdvertiseHTTP3(t *testing.T) {
+	previous := cfg
+	t.Cleanup(func() { cfg = previous })
+	cfg.HTTPServer.Port = 443
+	cfg.HTTPServer.HTTP3 = true
+	s := new(srv)
+	next := http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) { writer.WriteHeader(http.StatusOK) })
+	assert.Equal(t, "", serve(s.advertiseHTTP3(next), 2).Header().Get("Alt-Svc"))
+
+	s.setupHTTP3Server(t.Context(), next)
+	assert.Equal(t, `h3=":443"; ma=86400`, serve(s.advertiseHTTP3(next), 2).Header().Get("Alt-Svc"))
+	assert.Equal(t, "", serve(s.advertiseHTTP3(next), 3).Header().Get("Alt-Svc"))
+}
+
+func TestValuesContext(t *testing.T) {
+	t.Parallel()
+	values := context.WithValue(t.Context(), authClientCtxValueKey, "auth")                     //nolint:staticcheck,revive // .
+	connCtx, cancel := context.WithCancel(context.WithValue(t.Context(), languageHeader, "en")) //nolint:staticcheck,revive // .
+	ctx := &valuesContext{Context: connCtx, values: values}
+	assert.Equal(t, "auth", ctx.Value(authClientCtxValueKey))
+	assert.Equal(t, "en", ctx.Value(languageHeader))
+	cancel()
+	assert.Error(t, ctx.Err())
+	assert.NoError(t, values.Err())
+}
+
+func serve(handler http.Handler, protoMajor int) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.ProtoMajor = protoMajor
+	handler.ServeHTTP(recorder, req)
+
+	return recorder
+}
@@ -3,7 +3,10 @@
 package server
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -137,6 +140,65 @@ func ForbiddenWithCode(err error, code string, dataArg ...map[string]any) *Respo
 	}
 }
 
+func TooManyRequests(err error, retryAfter time.Duration) *Response[ErrorResponse] {
+	return &Response[ErrorResponse]{
+		Code: http.StatusTooManyRequests,
+		Data: &ErrorResponse{
+			error: err,
+			Error: err.Error(),
+			Code:  "RATE_LIMIT_EXCEEDED",
+			Data:  map[string]any{"retryAfter": retryAfter.String()},
+		},
+		Headers: map[string]string{"Retry-After": strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10)},
+	}
+}
+
+func RequestEntityTooLarge(err error, limit int64) *Response[ErrorResponse] {
+	return &Response[ErrorResponse]{
+		Code: http.StatusRequestEntityTooLarge,
+		Data: &ErrorResponse{
+			error: err,
+			Error: err.Error(),
+			Code:  "REQUEST_BODY_TOO_LARGE",
+			Data:  map[string]any{"maxBytes": limit},
+		},
+	}
+}
+
+func ServiceUnavailable(err error, code string, dataArg ...map[string]any) *Response[ErrorResponse] {
+	var data map[string]any
+	if len(dataArg) == 1 {
+		data = dataArg[0]
+	}
+
+	return &Response[ErrorResponse]{
+		Code: http.StatusServiceUnavailable,
+		Data: &ErrorResponse{
+			error: err,
+			Error: err.Error(),
+			Code:  code,
+			Data:  data,
+		},
+	}
+}
+
+func PreconditionFailed(err error, code string, dataArg ...map[string]any) *Response[ErrorResponse] {
+	var data map[string]any
+	if len(dataArg) == 1 {
+		data = dataArg[0]
+	}
+
+	return &Response[ErrorResponse]{
+		Code: http.StatusPreconditionFailed,
+		Data: &ErrorResponse{
+			error: err,
+			Error: err.Error(),
+			Code:  code,
+			Data:  data,
+		},
+	}
+}
+
 func NoContent() *Response[any] {
 	return &Response[any]{Code: http.StatusNoContent}
 }
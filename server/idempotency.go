@@ -0,0 +1,288 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gojson "github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+
+	storagev2 "github.com/ice-blockchain/wintr/connectors/storage/v2"
+	"github.com/ice-blockchain/wintr/connectors/storage/v3"
+	"github.com/ice-blockchain/wintr/log"
+)
+
+func newIdempotencyStore(ctx context.Context, applicationYAMLKey string) IdempotencyStore {
+	switch cfg.Idempotency.Storage {
+	case "":
+		return nil
+	case idempotencyStorageV2:
+		return NewPostgresIdempotencyStore(ctx, storagev2.MustConnect(ctx, applicationYAMLKey, storagev2.NewStringDDL(IdempotencyStoreDDL)))
+	case idempotencyStorageV3:
+		return NewRedisIdempotencyStore(storage.MustConnect(ctx, applicationYAMLKey))
+	default:
+		log.Panic(errors.Errorf("invalid idempotency storage `%v`, expected one of `%v`, `%v`", cfg.Idempotency.Storage, idempotencyStorageV2, idempotencyStorageV3))
+
+		return nil
+	}
+}
+
+// fingerprintRequest starts hashing the method, path and body of the write requests sent with an `Idempotency-Key` header,
+// while the body is read by the bindings, so that the key can't be reused for a different request.
+func (req *Request[REQ, RESP]) fingerprintRequest() {
+	if req.ginCtx.GetHeader(idempotencyHeader) == "" || !isIdempotentMethod(req.ginCtx.Request.Method) {
+		return
+	}
+	req.fingerprint = sha256.New()
+	req.fingerprint.Write([]byte(req.ginCtx.Request.Method + " " + req.ginCtx.Request.URL.RequestURI() + "\n"))
+	if body := req.ginCtx.Request.Body; body != nil {
+		req.ginCtx.Request.Body = &fingerprintedBody{Reader: io.TeeReader(body, req.fingerprint), Closer: body}
+	}
+}
+
+func isIdempotentMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch
+}
+
+func (req *Request[REQ, RESP]) beginIdempotentRequest(ctx context.Context, options *handlerOptions) (*idempotentRequest, *Response[ErrorResponse]) {
+	idempotencyKey := req.ginCtx.GetHeader(idempotencyHeader)
+	store, ok := ctx.Value(idempotencyStoreCtxValueKey).(IdempotencyStore)
+	if idempotencyKey == "" || !ok || store == nil || req.fingerprint == nil {
+		return nil, nil //nolint:nilnil // Nothing to do.
+	}
+	owner := req.AuthenticatedUser.UserID
+	if owner == "" {
+		owner = req.ClientIP.String()
+	}
+	key := fmt.Sprintf("%v:%v:%v:%v", owner, req.ginCtx.Request.Method, req.ginCtx.FullPath(), idempotencyKey)
+	if _, err := io.Copy(io.Discard, req.ginCtx.Request.Body); err != nil {
+		log.Error(errors.Wrapf(err, "failed to fingerprint idempotent request for %v, ignoring %v", key, idempotencyHeader))
+
+		return nil, nil //nolint:nilnil // We don't want to fail the request because of it.
+	}
+	fingerprint := hex.EncodeToString(req.fingerprint.Sum(nil))
+	// The key has to stay reserved for as long as the handler can run, otherwise a retry could run it again.
+	stored, err := store.Begin(ctx, key, fingerprint, endpointTimeout(req.ginCtx, options)+idempotencyLockTTLMargin)
+	if err != nil {
+		if errors.Is(err, ErrIdempotentRequestInProgress) {
+			return nil, Conflict(errors.Wrapf(err, "request with %v `%v` is still in progress", idempotencyHeader, idempotencyKey), "REQUEST_IN_PROGRESS")
+		}
+		if errors.Is(err, ErrIdempotencyKeyReused) {
+			return nil, UnprocessableEntity(errors.Wrapf(err, "%v `%v` was used for a different request", idempotencyHeader, idempotencyKey), "IDEMPOTENCY_KEY_REUSED")
+		}
+		log.Error(errors.Wrapf(err, "failed to begin idempotent request for %v, ignoring %v", key, idempotencyHeader))
+
+		return nil, nil //nolint:nilnil // We don't want to fail the request because of it.
+	}
+	idempotent := &idempotentRequest{store: store, stored: stored, key: key, fingerprint: fingerprint}
+	if stored == nil {
+		idempotent.recorder = &responseRecorder{ResponseWriter: req.ginCtx.Writer, body: new(bytes.Buffer)}
+		req.ginCtx.Writer = idempotent.recorder
+	}
+
+	return idempotent, nil
+}
+
+// replayed writes the stored response, if the request was already handled before.
+func (ir *idempotentRequest) replayed(ginCtx *gin.Context) bool {
+	if ir == nil || ir.stored == nil {
+		return false
+	}
+	for k, v := range ir.stored.Headers {
+		ginCtx.Header(k, v)
+	}
+	ginCtx.Header(idempotencyReplayedHeader, "true")
+	ginCtx.Status(ir.stored.Code)
+	if len(ir.stored.Body) != 0 {
+		if _, err := ginCtx.Writer.Write(ir.stored.Body); err != nil {
+			log.Error(errors.Wrapf(err, "failed to replay idempotent response for %v", ir.key))
+		}
+	}
+
+	return true
+}
+
+// end stores the response, if it should be replayed, or releases the key, so that the request can be retried.
+func (ir *idempotentRequest) end(ctx context.Context, ginCtx *gin.Context) {
+	if ir == nil || ir.recorder == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), idempotencyStoreRequestTimeout)
+	defer cancel()
+	if !ir.recorder.Written() || ir.recorder.Status() >= http.StatusInternalServerError {
+		log.Error(errors.Wrapf(ir.store.Abort(ctx, ir.key), "failed to abort idempotent request for %v", ir.key))
+
+		return
+	}
+	resp := &IdempotentResponse{
+		Code:        ir.recorder.Status(),
+		Headers:     make(map[string]string, len(ginCtx.Writer.Header())),
+		Body:        ir.recorder.body.Bytes(),
+		Fingerprint: ir.fingerprint,
+	}
+	for k := range ir.recorder.Header() {
+		if k != "Date" && k != "Content-Length" {
+			resp.Headers[k] = ir.recorder.Header().Get(k)
+		}
+	}
+	ttl := cfg.Idempotency.TTL
+	if ttl == 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	log.Error(errors.Wrapf(ir.store.Complete(ctx, ir.key, resp, ttl), "failed to complete idempotent request for %v", ir.key))
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+
+	return r.ResponseWriter.Write(data) //nolint:wrapcheck // It's a proxy.
+}
+
+func (r *responseRecorder) WriteString(data string) (int, error) {
+	r.body.WriteString(data)
+
+	return r.ResponseWriter.WriteString(data) //nolint:wrapcheck // It's a proxy.
+}
+
+// NewRedisIdempotencyStore builds an IdempotencyStore backed by storage/v3.
+func NewRedisIdempotencyStore(db storage.DB) IdempotencyStore {
+	return &redisIdempotencyStore{db: db}
+}
+
+func (s *redisIdempotencyStore) Begin(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*IdempotentResponse, error) {
+	return s.begin(ctx, "idempotency:"+key, fingerprint, lockTTL)
+}
+
+func (s *redisIdempotencyStore) begin(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*IdempotentResponse, error) {
+	reserved, err := s.db.SetNX(ctx, key, idempotencyInFlightMarker+fingerprint, lockTTL).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to reserve %v", key)
+	}
+	if reserved {
+		return nil, nil //nolint:nilnil // It's a new request.
+	}
+	val, err := s.db.Get(ctx, key).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return s.begin(ctx, key, fingerprint, lockTTL)
+		}
+
+		return nil, errors.Wrapf(err, "failed to get %v", key)
+	}
+	if inFlightFingerprint, inFlight := strings.CutPrefix(val, idempotencyInFlightMarker); inFlight {
+		if inFlightFingerprint != fingerprint {
+			return nil, ErrIdempotencyKeyReused
+		}
+
+		return nil, ErrIdempotentRequestInProgress
+	}
+	resp := new(IdempotentResponse)
+	if err = gojson.UnmarshalContext(ctx, []byte(val), resp); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode stored response for %v", key)
+	}
+	if resp.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	return resp, nil
+}
+
+func (s *redisIdempotencyStore) Complete(ctx context.Context, key string, resp *IdempotentResponse, ttl time.Duration) error {
+	val, err := gojson.MarshalContext(ctx, resp)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode response for %v", key)
+	}
+
+	return errors.Wrapf(s.db.Set(ctx, "idempotency:"+key, val, ttl).Err(), "failed to store response for %v", key)
+}
+
+func (s *redisIdempotencyStore) Abort(ctx context.Context, key string) error {
+	return errors.Wrapf(s.db.Del(ctx, "idempotency:"+key).Err(), "failed to delete %v", key)
+}
+
+func (s *redisIdempotencyStore) Close() error {
+	return errors.Wrap(s.db.Close(), "failed to close idempotency store storage")
+}
+
+// NewPostgresIdempotencyStore builds an IdempotencyStore backed by storage/v2. It requires the IdempotencyStoreDDL schema.
+func NewPostgresIdempotencyStore(ctx context.Context, db *storagev2.DB) IdempotencyStore {
+	s := &postgresIdempotencyStore{db: db}
+	go s.startCleanup(ctx)
+
+	return s
+}
+
+func (s *postgresIdempotencyStore) Begin(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*IdempotentResponse, error) {
+	sql := `INSERT INTO idempotent_responses (key, fingerprint, expires_at) VALUES ($1, $2, $3)
+			ON CONFLICT (key) DO UPDATE
+				SET fingerprint = EXCLUDED.fingerprint, expires_at = EXCLUDED.expires_at, completed = FALSE, code = NULL, headers = NULL, body = NULL
+				WHERE idempotent_responses.expires_at < $4`
+	now := time.Now().UTC()
+	if reserved, err := storagev2.Exec(ctx, s.db, sql, key, fingerprint, now.Add(lockTTL), now); err != nil || reserved == 1 {
+		return nil, errors.Wrapf(err, "failed to reserve %v", key)
+	}
+	stored, err := storagev2.Get[struct {
+		Headers     map[string]string
+		Code        *int
+		Fingerprint string
+		Body        []byte
+		Completed   bool
+	}](ctx, s.db, `SELECT headers, body, code, fingerprint, completed FROM idempotent_responses WHERE key = $1`, key)
+	if err != nil {
+		if storagev2.IsErr(err, storagev2.ErrNotFound) {
+			return s.Begin(ctx, key, fingerprint, lockTTL)
+		}
+
+		return nil, errors.Wrapf(err, "failed to get %v", key)
+	}
+	if stored.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !stored.Completed || stored.Code == nil {
+		return nil, ErrIdempotentRequestInProgress
+	}
+
+	return &IdempotentResponse{Headers: stored.Headers, Body: stored.Body, Code: *stored.Code, Fingerprint: stored.Fingerprint}, nil
+}
+
+func (s *postgresIdempotencyStore) Complete(ctx context.Context, key string, resp *IdempotentResponse, ttl time.Duration) error {
+	sql := `UPDATE idempotent_responses SET completed = TRUE, code = $2, headers = $3, body = $4, expires_at = $5 WHERE key = $1`
+	_, err := storagev2.Exec(ctx, s.db, sql, key, resp.Code, resp.Headers, resp.Body, time.Now().UTC().Add(ttl))
+
+	return errors.Wrapf(err, "failed to store response for %v", key)
+}
+
+func (s *postgresIdempotencyStore) Abort(ctx context.Context, key string) error {
+	_, err := storagev2.Exec(ctx, s.db, `DELETE FROM idempotent_responses WHERE key = $1 AND completed = FALSE`, key)
+
+	return errors.Wrapf(err, "failed to delete %v", key)
+}
+
+func (s *postgresIdempotencyStore) startCleanup(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			_, err := storagev2.Exec(ctx, s.db, `DELETE FROM idempotent_responses WHERE expires_at < $1`, now.UTC())
+			log.Error(errors.Wrap(err, "failed to delete expired idempotent responses"))
+		}
+	}
+}
+
+func (s *postgresIdempotencyStore) Close() error {
+	return errors.Wrap(s.db.Close(), "failed to close idempotency store storage")
+}
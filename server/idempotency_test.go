@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+
+	"github.com/ice-blockchain/wintr/auth"
+	storagev2 "github.com/ice-blockchain/wintr/connectors/storage/v2"
+	"github.com/ice-blockchain/wintr/connectors/storage/v2/fixture"
+)
+
+func TestIdempotentRequestReplayed(t *testing.T) {
+	t.Parallel()
+	recorder := httptest.NewRecorder()
+	ginCtx, _ := gin.CreateTestContext(recorder)
+	assert.False(t, (*idempotentRequest)(nil).replayed(ginCtx))
+	assert.False(t, new(idempotentRequest).replayed(ginCtx))
+
+	stored := &IdempotentResponse{Code: http.StatusCreated, Headers: map[string]string{"Content-Type": "application/json"}, Body: []byte(`{"a":1}`)}
+	require.True(t, (&idempotentRequest{stored: stored}).replayed(ginCtx))
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "true", recorder.Header().Get(idempotencyReplayedHeader))
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, `{"a":1}`, recorder.Body.String())
+}
+
+func TestResponseRecorder(t *testing.T) {
+	t.Parallel()
+	ginCtx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	rec := &responseRecorder{ResponseWriter: ginCtx.Writer, body: new(bytes.Buffer)}
+	_, err := rec.Write([]byte("a"))
+	require.NoError(t, err)
+	_, err = rec.WriteString("b")
+	require.NoError(t, err)
+	assert.Equal(t, "ab", rec.body.String())
+}
+
+type (
+	idempotencyTestDB struct {
+		*redis.Client
+	}
+	idempotencyTestRequest struct {
+		Name string `json:"name"`
+	}
+)
+
+func (*idempotencyTestDB) IsRW(context.Context) bool {
+	return true
+}
+
+func newRedisIdempotencyTestStore(t *testing.T) (*miniredis.Miniredis, IdempotencyStore) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+
+	return mr, NewRedisIdempotencyStore(&idempotencyTestDB{Client: redis.NewClient(&redis.Options{Addr: mr.Addr()})})
+}
+
+func TestRedisIdempotencyStore(t *testing.T) {
+	t.Parallel()
+	mr, store := newRedisIdempotencyTestStore(t)
+	defer func() { require.NoError(t, store.Close()) }()
+	testIdempotencyStore(t, store, mr.FastForward)
+}
+
+func TestPostgresIdempotencyStore(t *testing.T) {
+	t.Parallel()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	container := fixture.New(t.Context())
+	defer func() { require.NoError(t, container.Close(context.WithoutCancel(t.Context()))) }()
+	connString, release := container.MustTempDB(t.Context())
+	defer release()
+	db := storagev2.MustConnectWithCfg(t.Context(), &storagev2.Cfg{PrimaryURL: connString, ReplicaURLs: []string{connString}, RunDDL: true}, storagev2.NewStringDDL(IdempotencyStoreDDL)) //nolint:lll // .
+	store := NewPostgresIdempotencyStore(t.Context(), db)
+	defer func() { require.NoError(t, store.Close()) }()
+	testIdempotencyStore(t, store, func(ttl time.Duration) {
+		_, err := storagev2.Exec(t.Context(), db, `UPDATE idempotent_responses SET expires_at = expires_at - make_interval(secs => $1)`, ttl.Seconds())
+		require.NoError(t, err)
+	})
+}
+
+func testIdempotencyStore(t *testing.T, store IdempotencyStore, fastForward func(time.Duration)) {
+	t.Helper()
+	ctx := t.Context()
+	stored, err := store.Begin(ctx, "a", "fingerprint", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+	_, err = store.Begin(ctx, "a", "fingerprint", time.Minute)
+	require.ErrorIs(t, err, ErrIdempotentRequestInProgress)
+	_, err = store.Begin(ctx, "a", "other", time.Minute)
+	require.ErrorIs(t, err, ErrIdempotencyKeyReused)
+
+	resp := &IdempotentResponse{Code: http.StatusCreated, Headers: map[string]string{"Content-Type": "application/json"}, Body: []byte(`{}`), Fingerprint: "fingerprint"}
+	require.NoError(t, store.Complete(ctx, "a", resp, time.Hour))
+	stored, err = store.Begin(ctx, "a", "fingerprint", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, resp, stored)
+	_, err = store.Begin(ctx, "a", "other", time.Minute)
+	require.ErrorIs(t, err, ErrIdempotencyKeyReused)
+
+	stored, err = store.Begin(ctx, "b", "fingerprint", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+	require.NoError(t, store.Abort(ctx, "b"))
+	stored, err = store.Begin(ctx, "b", "other", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	fastForward(2 * time.Hour)
+	stored, err = store.Begin(ctx, "a", "other", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+	stored, err = store.Begin(ctx, "b", "fingerprint", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+}
+
+func TestIdempotentRequests(t *testing.T) {
+	t.Parallel()
+	mr, store := newRedisIdempotencyTestStore(t)
+	var calls atomic.Int64
+	router := gin.New()
+	router.POST("/items", RootHandler(func(_ context.Context, req *Request[idempotencyTestRequest, idempotencyTestRequest]) (*Response[idempotencyTestRequest], *Response[ErrorResponse]) { //nolint:lll // .
+		calls.Add(1)
+
+		return Created(req.Data), nil
+	}, WithTimeout(time.Hour)))
+	call := func(body string) *httptest.ResponseRecorder {
+		ctx := context.WithValue(t.Context(), authClientCtxValueKey, auth.Client(new(webSocketTestAuth))) //nolint:staticcheck,revive // .
+		ctx = context.WithValue(ctx, idempotencyStoreCtxValueKey, store)                                  //nolint:staticcheck,revive // .
+		req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/items", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer valid")
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotencyHeader, "bogus")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := call(`{"name":"a"}`)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	assert.JSONEq(t, `{"name":"a"}`, recorder.Body.String())
+	recorder = call(`{"name":"a"}`)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "true", recorder.Header().Get(idempotencyReplayedHeader))
+	assert.JSONEq(t, `{"name":"a"}`, recorder.Body.String())
+	recorder = call(`{"name":"b"}`)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "IDEMPOTENCY_KEY_REUSED")
+	assert.EqualValues(t, 1, calls.Load())
+
+	lockTTLRequest := &Request[idempotencyTestRequest, idempotencyTestRequest]{AuthenticatedUser: AuthenticatedUser{Token: auth.Token{UserID: "bogus"}}}
+	ginCtx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ginCtx.Request = httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{}`))
+	ginCtx.Request.Header.Set(idempotencyHeader, "other")
+	lockTTLRequest.init(ginCtx)
+	ctx := context.WithValue(t.Context(), idempotencyStoreCtxValueKey, store) //nolint:staticcheck,revive // .
+	idempotent, errResp := lockTTLRequest.beginIdempotentRequest(ctx, &handlerOptions{timeout: time.Hour})
+	require.Nil(t, errResp)
+	require.NotNil(t, idempotent)
+	assert.Equal(t, time.Hour+idempotencyLockTTLMargin, mr.TTL("idempotency:bogus:POST::other"))
+}
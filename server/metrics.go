@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ice-blockchain/wintr/log"
+	"github.com/ice-blockchain/wintr/metrics"
+)
+
+//nolint:gochecknoglobals // They're registered once, for the whole runtime.
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of handled http requests.",
+	}, []string{"route", "method", "request", "code"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of handled http requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "request"})
+	requestSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_size_bytes",
+		Help:    "Size of the bodies of handled http requests.",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 6), //nolint:mnd,gomnd // From 100B to 10MB.
+	}, []string{"route", "method", "request"})
+	responseSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_response_size_bytes",
+		Help:    "Size of the bodies of http responses.",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 6), //nolint:mnd,gomnd // From 100B to 10MB.
+	}, []string{"route", "method", "request"})
+	requestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of http requests currently being handled.",
+	})
+	webSocketConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "websocket_connections",
+		Help: "Number of open websocket connections.",
+	})
+	auditEntriesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "audit_entries_dropped_total",
+		Help: "Number of audit entries that could not be recorded.",
+	})
+)
+
+//nolint:gochecknoinits // Because we want to set it up globally.
+func init() {
+	metrics.MustRegister(requestsTotal, requestDuration, requestSize, responseSize, requestsInFlight, webSocketConnections, auditEntriesDropped)
+}
+
+// setupMetricsServer serves `/metrics` on its own plain http listener, at Config.Metrics.ListenAddress, so that it's not public.
+func (s *srv) setupMetricsServer() {
+	if cfg.Metrics.ListenAddress == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, metrics.Handler())
+	s.metricsServer = &http.Server{ //nolint:gosec // Not an issue, it's an internal listener.
+		Addr:    cfg.Metrics.ListenAddress,
+		Handler: mux,
+	}
+}
+
+func (s *srv) startMetricsServer() {
+	if s.metricsServer == nil {
+		return
+	}
+	defer log.Info("metrics server stopped listening")
+	log.Info(fmt.Sprintf("metrics server started listening on %v...", cfg.Metrics.ListenAddress))
+	if err := s.metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error(errors.Wrap(err, "metricsServer.ListenAndServe failed"))
+	}
+}
+
+func (s *srv) shutDownMetricsServer(ctx context.Context) {
+	if s.metricsServer == nil {
+		return
+	}
+	if err := s.metricsServer.Shutdown(ctx); err != nil {
+		log.Error(errors.Wrap(err, "metrics server shutdown failed"))
+	} else {
+		log.Info("metrics server shutdown succeeded")
+	}
+}
+
+func observeRequest(ginCtx *gin.Context, requestType string, startedAt time.Time) {
+	route, method := ginCtx.FullPath(), ginCtx.Request.Method
+	requestsTotal.WithLabelValues(route, method, requestType, strconv.Itoa(ginCtx.Writer.Status())).Inc()
+	requestDuration.WithLabelValues(route, method, requestType).Observe(time.Since(startedAt).Seconds())
+	if ginCtx.Request.ContentLength > 0 {
+		requestSize.WithLabelValues(route, method, requestType).Observe(float64(ginCtx.Request.ContentLength))
+	}
+	if size := ginCtx.Writer.Size(); size > 0 {
+		responseSize.WithLabelValues(route, method, requestType).Observe(float64(size))
+	}
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/auth"
+)
+
+type (
+	metricsTestRequest struct {
+		Name string `json:"name"`
+	}
+	metricsTestState struct {
+		State
+	}
+)
+
+func (*metricsTestState) RegisterRoutes(*Router) {}
+
+func TestObserveRequest(t *testing.T) {
+	t.Parallel()
+	router := gin.New()
+	router.POST("/metrics-test", RootHandler(func(context.Context, *Request[metricsTestRequest, string]) (*Response[string], *Response[ErrorResponse]) { //nolint:lll // .
+		resp := "bogus"
+
+		return OK(&resp), nil
+	}))
+	const requestType = "*server.metricsTestRequest"
+	total := requestsTotal.WithLabelValues("/metrics-test", http.MethodPost, requestType, "200")
+	totalBefore, countBefore := testutil.ToFloat64(total), requestDurationCount(t, "/metrics-test", http.MethodPost, requestType)
+
+	ctx := context.WithValue(t.Context(), authClientCtxValueKey, auth.Client(new(webSocketTestAuth))) //nolint:staticcheck,revive // .
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/metrics-test", strings.NewReader(`{"name":"bogus"}`))
+	req.Header.Set("Authorization", "Bearer valid")
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	assert.InDelta(t, totalBefore+1, testutil.ToFloat64(total), 0)
+	assert.Equal(t, countBefore+1, requestDurationCount(t, "/metrics-test", http.MethodPost, requestType))
+}
+
+func requestDurationCount(t *testing.T, labels ...string) uint64 {
+	t.Helper()
+	metric := new(dto.Metric)
+	require.NoError(t, requestDuration.WithLabelValues(labels...).(prometheus.Histogram).Write(metric)) //nolint:forcetypeassert // We know for sure.
+
+	return metric.GetHistogram().GetSampleCount()
+}
+
+//nolint:paralleltest // It changes the global config.
+func TestMetricsServer(t *testing.T) {
+	previous := cfg
+	t.Cleanup(func() { cfg = previous })
+	s := &srv{State: new(metricsTestState)}
+	s.setupRouter(context.WithValue(t.Context(), authClientCtxValueKey, auth.Client(&serviceTokenTestAuth{withoutClients: true}))) //nolint:staticcheck,revive // .
+	s.setupMetricsServer()
+	assert.Nil(t, s.metricsServer)
+	for _, route := range s.router.Routes() {
+		assert.NotEqual(t, metricsPath, route.Path)
+	}
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	cfg.Metrics.ListenAddress = ":9090"
+	s.setupMetricsServer()
+	require.NotNil(t, s.metricsServer)
+	assert.Equal(t, ":9090", s.metricsServer.Addr)
+	recorder = httptest.NewRecorder()
+	s.metricsServer.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "http_requests_in_flight")
+}
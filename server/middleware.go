@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/ice-blockchain/wintr/log"
+)
+
+// WithTimeout overrides DefaultEndpointTimeout for the route. Config.EndpointTimeouts, if specified for the route, takes precedence over it.
+func WithTimeout(timeout time.Duration) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.timeout = timeout
+	}
+}
+
+func endpointTimeout(ginCtx *gin.Context, options *handlerOptions) time.Duration {
+	if timeout, found := cfg.EndpointTimeouts[ginCtx.Request.Method+" "+ginCtx.FullPath()]; found && timeout > 0 {
+		return timeout
+	}
+	if options.timeout > 0 {
+		return options.timeout
+	}
+
+	return cfg.DefaultEndpointTimeout
+}
+
+func (s *srv) setupMiddlewares() {
+	s.router.Use(s.trackInFlight)
+	if !cfg.SecurityHeaders.Disabled {
+		s.router.Use(securityHeaders)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 0 {
+		if cfg.CORS.AllowCredentials && slices.Contains(cfg.CORS.AllowedOrigins, "*") {
+			log.Panic(errors.New("cors allowCredentials can't be used with the `*` origin, the allowed origins must be listed explicitly"))
+		}
+		s.router.Use(cors)
+	}
+	if cfg.MaxRequestBodySize > 0 {
+		s.router.Use(limitRequestBodySize)
+	}
+}
+
+func securityHeaders(ginCtx *gin.Context) {
+	hstsMaxAge := cfg.SecurityHeaders.HSTSMaxAge
+	if hstsMaxAge <= 0 {
+		hstsMaxAge = defaultHSTSMaxAge
+	}
+	ginCtx.Header("Strict-Transport-Security", fmt.Sprintf("max-age=%v; includeSubDomains", int64(hstsMaxAge.Seconds())))
+	ginCtx.Header("X-Content-Type-Options", "nosniff")
+	ginCtx.Header("X-Frame-Options", "DENY")
+	ginCtx.Header("Referrer-Policy", "no-referrer")
+	if csp := cfg.SecurityHeaders.ContentSecurityPolicy; csp != "" {
+		ginCtx.Header("Content-Security-Policy", csp)
+	}
+	ginCtx.Next()
+}
+
+func cors(ginCtx *gin.Context) {
+	origin := ginCtx.GetHeader("Origin")
+	if origin == "" {
+		ginCtx.Next()
+
+		return
+	}
+	ginCtx.Writer.Header().Add("Vary", "Origin")
+	allowAny := slices.Contains(cfg.CORS.AllowedOrigins, "*")
+	if !allowAny && !slices.Contains(cfg.CORS.AllowedOrigins, origin) {
+		if ginCtx.Request.Method == http.MethodOptions {
+			ginCtx.AbortWithStatus(http.StatusForbidden)
+
+			return
+		}
+		ginCtx.Next()
+
+		return
+	}
+	if allowAny {
+		ginCtx.Header("Access-Control-Allow-Origin", "*")
+	} else {
+		ginCtx.Header("Access-Control-Allow-Origin", origin)
+	}
+	if cfg.CORS.AllowCredentials {
+		ginCtx.Header("Access-Control-Allow-Credentials", "true")
+	}
+	if ginCtx.Request.Method != http.MethodOptions || ginCtx.GetHeader("Access-Control-Request-Method") == "" {
+		if len(cfg.CORS.ExposedHeaders) != 0 {
+			ginCtx.Header("Access-Control-Expose-Headers", strings.Join(cfg.CORS.ExposedHeaders, ", "))
+		}
+		ginCtx.Next()
+
+		return
+	}
+	methods := cfg.CORS.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead}
+	}
+	ginCtx.Header("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(cfg.CORS.AllowedHeaders) != 0 {
+		ginCtx.Header("Access-Control-Allow-Headers", strings.Join(cfg.CORS.AllowedHeaders, ", "))
+	} else if requested := ginCtx.GetHeader("Access-Control-Request-Headers"); requested != "" {
+		ginCtx.Header("Access-Control-Allow-Headers", requested)
+	}
+	if cfg.CORS.MaxAge > 0 {
+		ginCtx.Header("Access-Control-Max-Age", strconv.FormatInt(int64(cfg.CORS.MaxAge.Seconds()), 10))
+	}
+	ginCtx.AbortWithStatus(http.StatusNoContent)
+}
+
+func limitRequestBodySize(ginCtx *gin.Context) {
+	if ginCtx.Request.ContentLength > cfg.MaxRequestBodySize {
+		resp := RequestEntityTooLarge(errors.Errorf("request body of %v bytes exceeds the limit of %v bytes", ginCtx.Request.ContentLength, cfg.MaxRequestBodySize),
+			cfg.MaxRequestBodySize)
+		ginCtx.AbortWithStatusJSON(resp.Code, resp.Data)
+
+		return
+	}
+	ginCtx.Request.Body = http.MaxBytesReader(ginCtx.Writer, ginCtx.Request.Body, cfg.MaxRequestBodySize)
+	ginCtx.Next()
+}
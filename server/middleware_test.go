@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//nolint:paralleltest // It changes the global config.
+func TestMiddlewares(t *testing.T) {
+	previous := cfg
+	t.Cleanup(func() { cfg = previous })
+	cfg.CORS.AllowedOrigins = []string{"https://ice.io"}
+	cfg.CORS.AllowedHeaders = []string{"Authorization"}
+	cfg.CORS.MaxAge = time.Hour
+	cfg.SecurityHeaders.ContentSecurityPolicy = "default-src 'none'"
+	cfg.MaxRequestBodySize = 10
+	s := &srv{router: gin.New()}
+	s.setupMiddlewares()
+	s.router.POST("echo", func(ginCtx *gin.Context) {
+		body := make(map[string]any)
+		if err := ginCtx.ShouldBindJSON(&body); err != nil {
+			ginCtx.Status(http.StatusRequestEntityTooLarge)
+
+			return
+		}
+		ginCtx.Status(http.StatusOK)
+	})
+	do := func(method, origin, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/echo", strings.NewReader(body))
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		s.router.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	resp := do(http.MethodOptions, "https://ice.io", "")
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, "https://ice.io", resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Authorization", resp.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "3600", resp.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodOptions, "https://bogus.io", "").Code)
+
+	resp = do(http.MethodPost, "https://bogus.io", `{}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "nosniff", resp.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "max-age=31536000; includeSubDomains", resp.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "default-src 'none'", resp.Header().Get("Content-Security-Policy"))
+
+	resp = do(http.MethodPost, "", `{"a":"too long"}`)
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	assert.JSONEq(t, `{"error":"request body of 16 bytes exceeds the limit of 10 bytes","code":"REQUEST_BODY_TOO_LARGE","data":{"maxBytes":10}}`, resp.Body.String())
+}
+
+//nolint:paralleltest // It changes the global config.
+//nolint:paralleltest // It changes the global config.
+func TestCORSWithCredentials(t *testing.T) {
+	previous := cfg
+	t.Cleanup(func() { cfg = previous })
+	cfg.CORS.AllowedOrigins = []string{"*"}
+	cfg.CORS.AllowCredentials = true
+	assert.Panics(t, func() { (&srv{router: gin.New()}).setupMiddlewares() })
+
+	cfg.CORS.AllowedOrigins = []string{"https://ice.io"}
+	s := &srv{router: gin.New()}
+	s.setupMiddlewares()
+	s.router.GET("ping", func(ginCtx *gin.Context) { ginCtx.Status(http.StatusOK) })
+	for origin, allowed := range map[string]string{"https://ice.io": "https://ice.io", "https://evil.io": ""} {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/ping", http.NoBody)
+		req.Header.Set("Origin", origin)
+		recorder := httptest.NewRecorder()
+		s.router.ServeHTTP(recorder, req)
+		assert.Equal(t, allowed, recorder.Header().Get("Access-Control-Allow-Origin"), origin)
+		if allowed != "" {
+			assert.Equal(t, "true", recorder.Header().Get("Access-Control-Allow-Credentials"))
+		} else {
+			assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Credentials"))
+		}
+	}
+}
+
+func TestEndpointTimeout(t *testing.T) {
+	previous := cfg
+	t.Cleanup(func() { cfg = previous })
+	cfg.DefaultEndpointTimeout = time.Second
+	cfg.EndpointTimeouts = map[string]time.Duration{"GET /export": time.Minute}
+	router := gin.New()
+	var timeouts []time.Duration
+	for _, path := range []string{"/export", "/other"} {
+		router.GET(path, func(ginCtx *gin.Context) {
+			timeouts = append(timeouts, endpointTimeout(ginCtx, new(handlerOptions)), endpointTimeout(ginCtx, &handlerOptions{timeout: time.Hour}))
+		})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	assert.Equal(t, []time.Duration{time.Minute, time.Minute, time.Second, time.Hour}, timeouts)
+}
@@ -0,0 +1,462 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"encoding"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	stdlibtime "time"
+
+	"github.com/gin-gonic/gin"
+	gojson "github.com/goccy/go-json"
+	"github.com/pkg/errors"
+
+	"github.com/ice-blockchain/wintr/log"
+)
+
+//nolint:gochecknoglobals // They're stateless singletons.
+var (
+	openAPIOperations        = new(sync.Map) // Is a map[string]openAPIOperationDescriber, keyed by route, filled when the RootHandlers are built.
+	openAPITypeNameSanitizer = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+	textMarshalerType        = reflect.TypeFor[encoding.TextMarshaler]()
+	timeType                 = reflect.TypeFor[stdlibtime.Time]()
+	fileHeaderType           = reflect.TypeFor[multipart.FileHeader]()
+)
+
+func (s *srv) setupOpenAPIRoutes() {
+	doc := s.buildOpenAPIDocument()
+	body, err := gojson.Marshal(doc)
+	log.Panic(errors.Wrap(err, "failed to encode openapi document")) //nolint:revive // That's intended.
+	s.router.GET(s.openAPIPath(), func(ginCtx *gin.Context) {
+		ginCtx.Data(http.StatusOK, contentTypeJSON, body)
+	})
+	log.Info(fmt.Sprintf("openapi document with %v paths served on %v", len(doc.Paths), s.openAPIPath()))
+}
+
+func (s *srv) openAPIPath() string {
+	if s.swaggerRoot == "" {
+		return "/openapi.json"
+	}
+
+	return strings.TrimSuffix(s.swaggerRoot, "/") + "/openapi.json"
+}
+
+func (s *srv) buildOpenAPIDocument() *openAPIDocument {
+	builder := &openAPIBuilder{schemas: make(map[string]openAPISchema), names: make(map[reflect.Type]string)}
+	doc := &openAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info:    openAPIInfo{Title: s.applicationYAMLKey, Version: cfg.Version},
+		Paths:   make(map[string]map[string]*openAPIOperation),
+	}
+	if doc.Info.Version == "" {
+		doc.Info.Version = "local"
+	}
+	if cfg.Host != "" {
+		doc.Servers = []openAPIServer{{URL: fmt.Sprintf("https://%v%v", cfg.Host, s.nginxPrefix)}}
+	}
+	for _, route := range s.router.Routes() {
+		operation := describeRoute(builder, route)
+		if operation == nil {
+			continue
+		}
+		path := openAPIRoutePath(route.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*openAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = operation
+	}
+	doc.Components.Schemas = builder.schemas
+	doc.Components.SecuritySchemes = map[string]openAPISchema{
+		openAPIBearerAuth: {"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+	}
+
+	return doc
+}
+
+// WithRoute declares the method and the full path of the route the handler is registered for, i.e. `/v1/users/:userId`,
+// so that it's described in the openapi document. Handlers without it are left out.
+func WithRoute(method, path string) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.route = openAPIRouteKey(method, path)
+	}
+}
+
+func openAPIRouteKey(method, path string) string {
+	return strings.ToUpper(method) + " /" + strings.TrimPrefix(path, "/")
+}
+
+// registerOpenAPIOperation records how to describe the handler of the route, if it's declared via WithRoute.
+func registerOpenAPIOperation(route string, describe openAPIOperationDescriber) {
+	if route != "" {
+		openAPIOperations.Store(route, describe)
+	}
+}
+
+// describeRoute describes the route, if its handler was built with RootHandler, WithRoute. Any other route is skipped.
+func describeRoute(builder *openAPIBuilder, route gin.RouteInfo) *openAPIOperation {
+	registered, found := openAPIOperations.Load(openAPIRouteKey(route.Method, route.Path))
+	if !found {
+		return nil
+	}
+	operation := registered.(openAPIOperationDescriber)(builder) //nolint:forcetypeassert // We know for sure.
+	operation.OperationID = openAPIOperationID(route.Method, route.Path)
+	if segments := strings.Split(strings.Trim(route.Path, "/"), "/"); segments[0] != "" {
+		operation.Tags = []string{segments[0]}
+	}
+
+	return operation
+}
+
+func openAPIRoutePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func openAPIOperationID(method, path string) string {
+	parts := []string{strings.ToLower(method)}
+	for segment := range strings.SplitSeq(path, "/") {
+		if segment = strings.TrimLeft(segment, ":*"); segment != "" {
+			parts = append(parts, openAPITypeNameSanitizer.ReplaceAllString(segment, "_"))
+		}
+	}
+
+	return strings.Join(parts, "_")
+}
+
+func describeOperation[REQ, RESP any](options *handlerOptions) openAPIOperationDescriber {
+	return func(builder *openAPIBuilder) *openAPIOperation {
+		req := new(Request[REQ, RESP])
+		req.Data = new(REQ)
+		req.processTags(options)
+		operation := &openAPIOperation{
+			Responses: map[string]*openAPIResponse{"default": builder.errorResponse("Unexpected error.")},
+			XRoles:    req.roles,
+		}
+		builder.describeParameters(operation, reflect.TypeFor[REQ]())
+		if _, found := req.bindings[json]; found {
+			operation.RequestBody = &openAPIRequestBody{
+				Required: true,
+				Content:  map[string]openAPIMediaType{contentTypeJSON: {Schema: builder.bodySchema(reflect.TypeFor[REQ](), isJSONBodyField)}},
+			}
+		}
+		if _, found := req.bindings[formMultipart]; found {
+			operation.RequestBody = &openAPIRequestBody{
+				Required: true,
+				Content:  map[string]openAPIMediaType{"multipart/form-data": {Schema: builder.bodySchema(reflect.TypeFor[REQ](), isMultipartBodyField)}},
+			}
+		}
+		operation.Responses[strconv.Itoa(http.StatusOK)] = builder.successResponse(reflect.TypeFor[RESP]())
+		if len(req.bindings) != 0 || len(req.requiredFields) != 0 {
+			operation.Responses[strconv.Itoa(http.StatusUnprocessableEntity)] = builder.errorResponse("Invalid properties.")
+		}
+		operation.Security = []map[string][]string{{openAPIBearerAuth: {}}}
+		if req.allowUnauthorized {
+			operation.Security = append([]map[string][]string{{}}, operation.Security...)
+		} else {
+			operation.Responses[strconv.Itoa(http.StatusUnauthorized)] = builder.errorResponse("Invalid or missing token.")
+		}
+		if len(req.roles) != 0 || len(req.requiredClaims) != 0 || len(req.policies) != 0 {
+			operation.Responses[strconv.Itoa(http.StatusForbidden)] = builder.errorResponse("Operation not allowed.")
+		}
+		if req.rateLimit != nil {
+			operation.Responses[strconv.Itoa(http.StatusTooManyRequests)] = builder.errorResponse("Rate limit exceeded.")
+		}
+
+		return operation
+	}
+}
+
+func (b *openAPIBuilder) describeParameters(operation *openAPIOperation, reqType reflect.Type) {
+	for _, field := range flattenFields(reqType) {
+		var in, name string
+		switch {
+		case field.Tag.Get("uri") != "":
+			in, name = "path", field.Tag.Get("uri")
+		case field.Tag.Get("form") != "" && field.Tag.Get("formMultipart") == "":
+			in, name = "query", field.Tag.Get("form")
+		case field.Tag.Get("header") != "":
+			in, name = "header", field.Tag.Get("header")
+		default:
+			continue
+		}
+		name, _, _ = strings.Cut(name, ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		schema := b.schema(field.Type)
+		applyValidationRules(schema, field)
+		operation.Parameters = append(operation.Parameters, &openAPIParameter{
+			Name:     name,
+			In:       in,
+			Required: in == "path" || isRequiredField(field),
+			Schema:   schema,
+		})
+	}
+}
+
+func (b *openAPIBuilder) bodySchema(reqType reflect.Type, include func(reflect.StructField) bool) openAPISchema {
+	properties := make(map[string]openAPISchema)
+	var required []string
+	for _, field := range flattenFields(reqType) {
+		if !include(field) {
+			continue
+		}
+		name := fieldName(field)
+		properties[name] = b.fieldSchema(field)
+		if isRequiredField(field) {
+			required = append(required, name)
+		}
+	}
+	schema := openAPISchema{"type": "object", "properties": properties}
+	if len(required) != 0 {
+		schema["required"] = required
+	}
+
+	return schema
+}
+
+func (b *openAPIBuilder) successResponse(respType reflect.Type) *openAPIResponse {
+	var mediaType string
+	var schema openAPISchema
+	switch respType {
+	case reflect.TypeFor[File]():
+		mediaType, schema = contentTypeOctet, openAPISchema{"type": "string", "format": "binary"}
+	case reflect.TypeFor[CSV]():
+		mediaType, schema = contentTypeCSV, openAPISchema{"type": "string"}
+	case reflect.TypeFor[EventStream]():
+		mediaType, schema = contentTypeSSE, openAPISchema{"type": "string"}
+	default:
+		mediaType, schema = contentTypeJSON, b.schema(respType)
+	}
+
+	return &openAPIResponse{Description: "Success.", Content: map[string]openAPIMediaType{mediaType: {Schema: schema}}}
+}
+
+func (b *openAPIBuilder) errorResponse(description string) *openAPIResponse {
+	return &openAPIResponse{
+		Description: description,
+		Content:     map[string]openAPIMediaType{contentTypeJSON: {Schema: b.schema(reflect.TypeFor[ErrorResponse]())}},
+	}
+}
+
+//nolint:gocyclo,revive,cyclop // It's a type switch.
+func (b *openAPIBuilder) schema(typ reflect.Type) openAPISchema {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch {
+	case typ == timeType || isTimeWrapper(typ):
+		return openAPISchema{"type": "string", "format": "date-time"}
+	case typ == fileHeaderType:
+		return openAPISchema{"type": "string", "format": "binary"}
+	case typ.Kind() != reflect.String && (typ.Implements(textMarshalerType) || reflect.PointerTo(typ).Implements(textMarshalerType)):
+		return openAPISchema{"type": "string"}
+	}
+	switch typ.Kind() { //nolint:exhaustive // The rest is described as `any`.
+	case reflect.Bool:
+		return openAPISchema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return openAPISchema{"type": "integer", "format": "int" + strconv.Itoa(max(32, typ.Bits()))} //nolint:mnd,gomnd // .
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return openAPISchema{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return openAPISchema{"type": "number"}
+	case reflect.String:
+		return openAPISchema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return openAPISchema{"type": "string", "format": "byte"}
+		}
+
+		return openAPISchema{"type": "array", "items": b.schema(typ.Elem())}
+	case reflect.Map:
+		return openAPISchema{"type": "object", "additionalProperties": b.schema(typ.Elem())}
+	case reflect.Struct:
+		return b.structSchema(typ)
+	default:
+		return openAPISchema{}
+	}
+}
+
+// isTimeWrapper checks for structs like wintr/time.Time, that only embed *time.Time and are serialized as such.
+func isTimeWrapper(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Struct || typ.NumField() != 1 || !typ.Field(0).Anonymous {
+		return false
+	}
+	embedded := typ.Field(0).Type
+
+	return embedded == timeType || (embedded.Kind() == reflect.Pointer && embedded.Elem() == timeType)
+}
+
+// structSchema registers named structs as components, so that they can be referenced (recursively, if needed).
+func (b *openAPIBuilder) structSchema(typ reflect.Type) openAPISchema {
+	if typ.Name() == "" {
+		return b.objectSchema(typ)
+	}
+	name, found := b.names[typ]
+	if !found {
+		name = openAPITypeNameSanitizer.ReplaceAllString(typ.String(), "_")
+		for i := 2; b.schemas[name] != nil; i++ {
+			name = openAPITypeNameSanitizer.ReplaceAllString(typ.String(), "_") + strconv.Itoa(i)
+		}
+		b.names[typ] = name
+		b.schemas[name] = openAPISchema{}
+		b.schemas[name] = b.objectSchema(typ)
+	}
+
+	return openAPISchema{"$ref": "#/components/schemas/" + name}
+}
+
+func (b *openAPIBuilder) objectSchema(typ reflect.Type) openAPISchema {
+	properties := make(map[string]openAPISchema)
+	var required []string
+	for _, field := range flattenFields(typ) {
+		name := fieldName(field)
+		if jsonTag := field.Tag.Get("json"); jsonTag == "-" || name == "_" {
+			continue
+		}
+		properties[name] = b.fieldSchema(field)
+		if isRequiredField(field) {
+			required = append(required, name)
+		}
+	}
+	schema := openAPISchema{"type": "object", "properties": properties}
+	if len(required) != 0 {
+		schema["required"] = required
+	}
+
+	return schema
+}
+
+func (b *openAPIBuilder) fieldSchema(field reflect.StructField) openAPISchema {
+	schema := b.schema(field.Type)
+	if _, isRef := schema["$ref"]; isRef {
+		return schema
+	}
+	applyValidationRules(schema, field)
+	if example := field.Tag.Get("example"); example != "" {
+		schema["examples"] = []string{example}
+	}
+
+	return schema
+}
+
+// flattenFields returns the exported fields of the struct, including the ones promoted from embedded structs without a json name.
+func flattenFields(typ reflect.Type) []reflect.StructField {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+	fields := make([]reflect.StructField, 0, typ.NumField())
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && jsonName == "" && fieldType.Kind() == reflect.Struct && fieldType != timeType {
+			fields = append(fields, flattenFields(fieldType)...)
+
+			continue
+		}
+		if field.IsExported() {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+func isJSONBodyField(field reflect.StructField) bool {
+	jsonTag := field.Tag.Get("json")
+
+	return jsonTag != "" && jsonTag != "-"
+}
+
+func isMultipartBodyField(field reflect.StructField) bool {
+	return field.Tag.Get("formMultipart") != ""
+}
+
+func isRequiredField(field reflect.StructField) bool {
+	return field.Tag.Get("required") == "true" || slices.Contains(strings.Split(field.Tag.Get(validateTag), ","), "required")
+}
+
+// applyValidationRules describes the most common `validate` rules as json schema keywords.
+func applyValidationRules(schema openAPISchema, field reflect.StructField) {
+	applyRules(schema, strings.Split(field.Tag.Get(validateTag), ","))
+}
+
+// applyRules applies the rules before `dive` to the schema and the ones after it to its items, or to its values, for maps.
+func applyRules(schema openAPISchema, rules []string) {
+	for ix, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "dive":
+			elemRules := rules[ix+1:]
+			if len(elemRules) != 0 && elemRules[0] == "keys" {
+				elemRules = elemRules[min(slices.Index(elemRules, "endkeys")+1, len(elemRules)):]
+			}
+			for _, key := range []string{"items", "additionalProperties"} {
+				if elemSchema, isSchema := schema[key].(openAPISchema); isSchema {
+					if _, isRef := elemSchema["$ref"]; !isRef {
+						applyRules(elemSchema, elemRules)
+					}
+				}
+			}
+
+			return
+		case "oneof":
+			schema["enum"] = strings.Fields(param)
+		case "email", "uuid", "uri", "ipv4", "ipv6", "hostname":
+			schema["format"] = name
+		case "url":
+			schema["format"] = "uri"
+		case "phone", "e164":
+			schema["pattern"] = `^\+[1-9]\d{1,14}$`
+		case "regexp":
+			schema["pattern"] = param
+		case "min", "max", "gte", "lte":
+			applyBoundRule(schema, name, param)
+		}
+	}
+}
+
+func applyBoundRule(schema openAPISchema, rule, param string) {
+	value, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+	var keyword string
+	switch schema["type"] {
+	case "string":
+		keyword = "Length"
+	case "array":
+		keyword = "Items"
+	case "integer", "number":
+		keyword = "imum"
+	default:
+		return
+	}
+	if rule == "min" || rule == "gte" {
+		schema["min"+keyword] = value
+	} else {
+		schema["max"+keyword] = value
+	}
+}
@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/time"
+)
+
+type (
+	openAPITestUser struct {
+		CreatedAt *time.Time       `json:"createdAt,omitempty"`
+		Parent    *openAPITestUser `json:"parent,omitempty"`
+		ID        string           `json:"id"`
+		Tags      []string         `json:"tags"`
+	}
+	openAPITestRequest struct {
+		_        struct{} `roles:"admin"` //nolint:revive // It's processed by the router.
+		UserID   string   `uri:"userId" json:"-"`
+		Language string   `header:"X-Language" json:"-"`
+		Name     string   `json:"name" validate:"required,min=3,max=10"`
+		Kind     string   `json:"kind" validate:"oneof=a b"`
+		Friends  []string `json:"friends" validate:"max=2,dive,uuid"`
+		Limit    uint64   `form:"limit" json:"-"`
+	}
+)
+
+func TestBuildOpenAPIDocument(t *testing.T) {
+	t.Parallel()
+	s := &srv{router: gin.New(), applicationYAMLKey: "self"}
+	s.router.PUT("users/:userId", RootHandler(func(context.Context, *Request[openAPITestRequest, openAPITestUser]) (*Response[openAPITestUser], *Response[ErrorResponse]) { //nolint:lll // .
+		return OK(new(openAPITestUser)), nil
+	}, WithRoute(http.MethodPut, "users/:userId")))
+	s.router.GET("files", RootHandler(func(context.Context, *Request[healthCheck, File]) (*Response[File], *Response[ErrorResponse]) {
+		return OK(new(File)), nil
+	}, WithRoute(http.MethodGet, "/files")))
+	s.router.GET("raw", func(ginCtx *gin.Context) { ginCtx.Status(http.StatusOK) })
+	s.router.GET("decorated", func(ginCtx *gin.Context) { ginCtx.Next() }, RootHandler(func(context.Context, *Request[healthCheck, string]) (*Response[string], *Response[ErrorResponse]) { //nolint:lll // .
+		return OK(new(string)), nil
+	}, WithRoute(http.MethodGet, "/decorated")))
+	s.router.GET("undeclared", RootHandler(func(context.Context, *Request[healthCheck, string]) (*Response[string], *Response[ErrorResponse]) {
+		return OK(new(string)), nil
+	}))
+
+	doc := s.buildOpenAPIDocument()
+	assert.Equal(t, openAPIVersion, doc.OpenAPI)
+	require.Len(t, doc.Paths, 3)
+	assert.NotNil(t, doc.Paths["/decorated"]["get"])
+
+	operation := doc.Paths["/users/{userId}"]["put"]
+	require.NotNil(t, operation)
+	assert.Equal(t, "put_users_userId", operation.OperationID)
+	assert.Equal(t, []string{"admin"}, operation.XRoles)
+	require.Len(t, operation.Parameters, 3)
+	assert.Equal(t, &openAPIParameter{Name: "userId", In: "path", Required: true, Schema: openAPISchema{"type": "string"}}, operation.Parameters[0])
+	assert.Equal(t, "header", operation.Parameters[1].In)
+	assert.Equal(t, &openAPIParameter{Name: "limit", In: "query", Schema: openAPISchema{"type": "integer", "minimum": 0}}, operation.Parameters[2])
+	body := operation.RequestBody.Content[contentTypeJSON].Schema
+	assert.Equal(t, []string{"name"}, body["required"])
+	assert.Equal(t, map[string]openAPISchema{
+		"name":    {"type": "string", "minLength": 3.0, "maxLength": 10.0},
+		"kind":    {"type": "string", "enum": []string{"a", "b"}},
+		"friends": {"type": "array", "maxItems": 2.0, "items": openAPISchema{"type": "string", "format": "uuid"}},
+	}, body["properties"])
+	assert.Contains(t, operation.Responses, "401")
+	assert.Contains(t, operation.Responses, "403")
+	assert.Contains(t, operation.Responses, "422")
+	assert.Equal(t, openAPISchema{"$ref": "#/components/schemas/server.openAPITestUser"}, operation.Responses["200"].Content[contentTypeJSON].Schema)
+
+	user := doc.Components.Schemas["server.openAPITestUser"]["properties"].(map[string]openAPISchema) //nolint:forcetypeassert // We know for sure.
+	assert.Equal(t, openAPISchema{"type": "string", "format": "date-time"}, user["createdAt"])
+	assert.Equal(t, openAPISchema{"$ref": "#/components/schemas/server.openAPITestUser"}, user["parent"])
+	assert.Equal(t, openAPISchema{"type": "array", "items": openAPISchema{"type": "string"}}, user["tags"])
+
+	operation = doc.Paths["/files"]["get"]
+	require.NotNil(t, operation)
+	assert.Nil(t, operation.RequestBody)
+	assert.Equal(t, []map[string][]string{{}, {openAPIBearerAuth: {}}}, operation.Security)
+	assert.Contains(t, operation.Responses["200"].Content, contentTypeOctet)
+}
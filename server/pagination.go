@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// OKPage responds with the page of items. If there's a next page, it's linked via the `Link` header, with `rel="next"`.
+// For cursor based pagination, nextCursor is the one returned by storage.SelectPage, empty for the last page.
+// For offset based pagination, it's left empty and the next page is assumed to exist, if this one is full.
+func OKPage[REQ, T any](req *Request[REQ, Page[T]], items []*T, nextCursor string) *Response[Page[T]] {
+	if items == nil {
+		items = []*T{}
+	}
+	resp := OK(&Page[T]{Items: items, NextCursor: nextCursor})
+	pagination := paginationOf(req.Data)
+	if pagination == nil || req.ginCtx == nil || req.ginCtx.Request == nil {
+		return resp
+	}
+	links := make([]string, 0, 2) //nolint:mnd,gomnd // Next and prev.
+	switch {
+	case nextCursor != "":
+		links = append(links, pageLink(req.ginCtx.Request.URL, map[string]string{"cursor": nextCursor, "offset": ""}, "next"))
+	case pagination.Cursor == "" && uint64(len(items)) == pagination.Limit:
+		links = append(links, pageLink(req.ginCtx.Request.URL, map[string]string{"offset": strconv.FormatUint(pagination.Offset+pagination.Limit, 10)}, "next")) //nolint:lll // .
+	}
+	if pagination.Cursor == "" && pagination.Offset > 0 {
+		prevOffset := uint64(0)
+		if pagination.Offset > pagination.Limit {
+			prevOffset = pagination.Offset - pagination.Limit
+		}
+		links = append(links, pageLink(req.ginCtx.Request.URL, map[string]string{"offset": strconv.FormatUint(prevOffset, 10)}, "prev"))
+	}
+	if len(links) != 0 {
+		resp.Headers = map[string]string{"Link": strings.Join(links, ", ")}
+	}
+
+	return resp
+}
+
+func (p *Pagination) pagination() *Pagination {
+	return p
+}
+
+func paginationOf(data any) *Pagination {
+	if paginated, ok := data.(paginatedRequest); ok {
+		return paginated.pagination()
+	}
+
+	return nil
+}
+
+// paginate applies the configured defaults and bounds to the Pagination embedded in the request, if any.
+func (req *Request[REQ, RESP]) paginate() *Response[ErrorResponse] {
+	pagination := paginationOf(req.Data)
+	if pagination == nil {
+		return nil
+	}
+	defaultLimit, maxLimit := cfg.DefaultPagination.Limit, cfg.DefaultPagination.MaxLimit
+	if defaultLimit == 0 {
+		defaultLimit = defaultPaginationLimit
+	}
+	if maxLimit == 0 {
+		maxLimit = defaultPaginationMaxLimit
+	}
+	if pagination.Limit == 0 {
+		pagination.Limit = min(defaultLimit, maxLimit)
+	}
+	switch {
+	case pagination.Limit > maxLimit:
+		return UnprocessableEntity(errors.Errorf("properties `limit` are invalid, max is %v", maxLimit), "INVALID_PROPERTIES",
+			map[string]any{"limit": fmt.Sprintf("INVALID_MAX=%v", maxLimit)})
+	case pagination.Cursor != "" && pagination.Offset != 0:
+		return UnprocessableEntity(errors.New("properties `offset` are invalid, it can't be used together with a cursor"), "INVALID_PROPERTIES",
+			map[string]any{"offset": "INVALID_WITH_CURSOR"})
+	default:
+		return nil
+	}
+}
+
+func pageLink(current *url.URL, params map[string]string, rel string) string {
+	query := current.Query()
+	for k, v := range params {
+		if v == "" {
+			query.Del(k)
+		} else {
+			query.Set(k, v)
+		}
+	}
+	link := url.URL{Path: current.Path, RawPath: current.RawPath, RawQuery: query.Encode()}
+
+	return fmt.Sprintf("<%v>; rel=%q", link.RequestURI(), rel)
+}
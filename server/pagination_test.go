@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/auth"
+)
+
+type (
+	paginationTestRequest struct {
+		Filter string `form:"filter" json:"-"`
+		Pagination
+	}
+	paginationTestItem struct {
+		ID int `json:"id"`
+	}
+)
+
+func TestOKPage(t *testing.T) { //nolint:paralleltest // It changes the global config.
+	previous := cfg
+	t.Cleanup(func() { cfg = previous })
+	cfg.DefaultPagination.Limit, cfg.DefaultPagination.MaxLimit = 2, 3
+
+	var lastRequest *paginationTestRequest
+	router := gin.New()
+	router.GET("/items", RootHandler(func(_ context.Context, req *Request[paginationTestRequest, Page[paginationTestItem]]) (*Response[Page[paginationTestItem]], *Response[ErrorResponse]) { //nolint:lll // .
+		lastRequest = req.Data
+		items := make([]*paginationTestItem, 0, req.Data.Limit)
+		for ix := range req.Data.Limit {
+			items = append(items, &paginationTestItem{ID: int(req.Data.Offset + ix)})
+		}
+		nextCursor := ""
+		if req.Data.Cursor == "first" {
+			nextCursor = "second"
+		}
+
+		return OKPage(req, items, nextCursor), nil
+	}))
+	call := func(query string) *httptest.ResponseRecorder {
+		ctx := context.WithValue(t.Context(), authClientCtxValueKey, auth.Client(new(webSocketTestAuth))) //nolint:staticcheck,revive // .
+		req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/items?"+query, http.NoBody)
+		req.Header.Set("Authorization", "Bearer valid")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := call("filter=a")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, Pagination{Limit: 2}, lastRequest.Pagination)
+	assert.Equal(t, "a", lastRequest.Filter)
+	assert.JSONEq(t, `{"items":[{"id":0},{"id":1}]}`, recorder.Body.String())
+	assert.Equal(t, `</items?filter=a&offset=2>; rel="next"`, recorder.Header().Get("Link"))
+
+	recorder = call("filter=a&offset=4&limit=3")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, `</items?filter=a&limit=3&offset=7>; rel="next", </items?filter=a&limit=3&offset=1>; rel="prev"`, recorder.Header().Get("Link"))
+
+	recorder = call("cursor=first")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.JSONEq(t, `{"items":[{"id":0},{"id":1}],"nextCursor":"second"}`, recorder.Body.String())
+	assert.Equal(t, `</items?cursor=second>; rel="next"`, recorder.Header().Get("Link"))
+
+	recorder = call("cursor=last")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Empty(t, recorder.Header().Get("Link"))
+
+	recorder = call("limit=4")
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.JSONEq(t, `{"code":"INVALID_PROPERTIES","data":{"limit":"INVALID_MAX=3"},"error":"properties `+"`limit`"+` are invalid, max is 3"}`, recorder.Body.String()) //nolint:lll // .
+
+	recorder = call("cursor=first&offset=1")
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "INVALID_WITH_CURSOR")
+}
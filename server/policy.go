@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ice-blockchain/wintr/auth"
+	"github.com/ice-blockchain/wintr/log"
+	wintrtime "github.com/ice-blockchain/wintr/time"
+)
+
+// WithRoles allows only users having one of the specified roles to call the endpoint. It's the programmatic equivalent of the `roles` tag.
+func WithRoles(roles ...string) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.roles = append(opts.roles, roles...)
+	}
+}
+
+// WithRequiredClaim requires the custom claim to be set or, if value is specified, to be equal to it.
+// It's the programmatic equivalent of the `requiredClaims` tag.
+func WithRequiredClaim(claim string, value ...string) HandlerOption {
+	return func(opts *handlerOptions) {
+		if opts.requiredClaims == nil {
+			opts.requiredClaims = make(map[string]string, 1)
+		}
+		opts.requiredClaims[claim] = ""
+		if len(value) == 1 {
+			opts.requiredClaims[claim] = value[0]
+		}
+	}
+}
+
+// WithMFA requires the user to have passed a second factor in the last maxAge, i.e. for withdrawals. It's the programmatic equivalent of the `mfa` tag.
+func WithMFA(maxAge time.Duration) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.mfaMaxAge = maxAge
+	}
+}
+
+// WithScopes allows only services having all the specified scopes to call the endpoint. It's the programmatic equivalent of the `scopes` tag.
+func WithScopes(scopes ...string) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.scopes = append(opts.scopes, scopes...)
+	}
+}
+
+// WithPolicy adds custom authorization logic to the endpoint. Policies are evaluated in order, after roles and required claims.
+func WithPolicy(policies ...Policy) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.policies = append(opts.policies, policies...)
+	}
+}
+
+func parseRoles(value string) []string {
+	roles := strings.Split(value, ",")
+	for i := range roles {
+		roles[i] = strings.TrimSpace(roles[i])
+	}
+
+	return slices.DeleteFunc(roles, func(role string) bool { return role == "" })
+}
+
+func parseRequiredClaims(value string, claims map[string]string) map[string]string {
+	for _, claim := range parseRoles(value) {
+		if claims == nil {
+			claims = make(map[string]string, 1)
+		}
+		name, expected, _ := strings.Cut(claim, "=")
+		claims[strings.TrimSpace(name)] = strings.TrimSpace(expected)
+	}
+
+	return claims
+}
+
+func parseMFAMaxAge(value string) time.Duration {
+	maxAge, err := time.ParseDuration(value)
+	log.Panic(errors.Wrapf(err, "invalid mfa `%v`, expected a duration, i.e. `5m`", value)) //nolint:revive // That's intended.
+	if maxAge <= 0 {
+		log.Panic(errors.Errorf("invalid mfa `%v`, it must be positive", value))
+	}
+
+	return maxAge
+}
+
+func (req *Request[REQ, RESP]) checkPolicies(ctx context.Context) *Response[ErrorResponse] {
+	if len(req.roles) == 0 && len(req.requiredClaims) == 0 && len(req.policies) == 0 && req.mfaMaxAge == 0 && len(req.scopes) == 0 {
+		return nil
+	}
+	if req.AuthenticatedUser.UserID == "" && req.AuthenticatedUser.Provider != auth.ProviderService {
+		return Unauthorized(errors.New("authentication is required"))
+	}
+	if len(req.scopes) != 0 {
+		if err := auth.RequireScopes(&req.AuthenticatedUser.Token, req.scopes...); err != nil {
+			return ForbiddenWithCode(errors.Wrap(err, "scopes required"), "MISSING_SCOPE", map[string]any{"scopes": req.scopes})
+		}
+	}
+	if len(req.roles) != 0 && !slices.Contains(req.roles, req.AuthenticatedUser.Role) {
+		return ForbiddenWithCode(errors.Errorf("role `%v` not allowed, expected one of `%v`", req.AuthenticatedUser.Role, strings.Join(req.roles, ",")),
+			"ROLE_NOT_ALLOWED")
+	}
+	for claim, expected := range req.requiredClaims {
+		actual, found := req.AuthenticatedUser.Claims[claim]
+		if !found || actual == nil || (expected != "" && fmt.Sprint(actual) != expected) {
+			return ForbiddenWithCode(errors.Errorf("required claim `%v` is missing or invalid", claim), "MISSING_REQUIRED_CLAIM", map[string]any{"claim": claim})
+		}
+	}
+	if req.mfaMaxAge > 0 {
+		if err := auth.RequireMFA(&req.AuthenticatedUser.Token, wintrtime.Now(), req.mfaMaxAge); err != nil {
+			return ForbiddenWithCode(errors.Wrap(err, "second factor required"), "MFA_REQUIRED", map[string]any{"maxAge": req.mfaMaxAge.String()})
+		}
+	}
+	for _, policy := range req.policies {
+		if err := policy(ctx, req.ginCtx, &req.AuthenticatedUser); err != nil {
+			return Forbidden(errors.Wrap(err, "policy check failed"))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/auth"
+)
+
+func TestCheckPolicies(t *testing.T) {
+	t.Parallel()
+	type (
+		adminRequest struct {
+			_ struct{} `roles:"admin, moderator" requiredClaims:"kycPassed=true,tenant"` //nolint:revive // It's processed by the router.
+		}
+	)
+	newReq := func(role string, claims map[string]any, opts ...HandlerOption) *Request[adminRequest, any] {
+		options := new(handlerOptions)
+		for _, opt := range opts {
+			opt(options)
+		}
+		req := new(Request[adminRequest, any])
+		req.Data = new(adminRequest)
+		req.processTags(options)
+		req.AuthenticatedUser.UserID = "bogus"
+		req.AuthenticatedUser.Role = role
+		req.AuthenticatedUser.Claims = claims
+
+		return req
+	}
+	assert.Equal(t, []string{"admin", "moderator"}, newReq("", nil).roles)
+	assert.Equal(t, map[string]string{"kycPassed": "true", "tenant": ""}, newReq("", nil).requiredClaims)
+
+	require.Nil(t, newReq("moderator", map[string]any{"kycPassed": true, "tenant": "x"}).checkPolicies(t.Context()))
+
+	resp := newReq("author", map[string]any{"kycPassed": true, "tenant": "x"}).checkPolicies(t.Context())
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Equal(t, "ROLE_NOT_ALLOWED", resp.Data.Code)
+
+	resp = newReq("admin", map[string]any{"kycPassed": false, "tenant": "x"}).checkPolicies(t.Context())
+	require.NotNil(t, resp)
+	assert.Equal(t, "MISSING_REQUIRED_CLAIM", resp.Data.Code)
+	assert.Equal(t, map[string]any{"claim": "kycPassed"}, resp.Data.Data)
+
+	resp = newReq("admin", map[string]any{"kycPassed": true}).checkPolicies(t.Context())
+	require.NotNil(t, resp)
+	assert.Equal(t, "MISSING_REQUIRED_CLAIM", resp.Data.Code)
+
+	denyAll := WithPolicy(func(context.Context, *gin.Context, *AuthenticatedUser) error { return errors.New("nope") })
+	resp = newReq("admin", map[string]any{"kycPassed": true, "tenant": "x"}, denyAll).checkPolicies(t.Context())
+	require.NotNil(t, resp)
+	assert.Equal(t, "OPERATION_NOT_ALLOWED", resp.Data.Code)
+
+	req := newReq("admin", nil)
+	req.AuthenticatedUser.UserID = ""
+	resp = req.checkPolicies(t.Context())
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestCheckPoliciesMFA(t *testing.T) {
+	t.Parallel()
+	type (
+		withdrawalRequest struct {
+			_ struct{} `mfa:"5m"` //nolint:revive // It's processed by the router.
+		}
+	)
+	newReq := func(claims map[string]any, opts ...HandlerOption) *Request[withdrawalRequest, any] {
+		options := new(handlerOptions)
+		for _, opt := range opts {
+			opt(options)
+		}
+		processOptionTags[withdrawalRequest](options)
+		req := new(Request[withdrawalRequest, any])
+		req.Data = new(withdrawalRequest)
+		req.processTags(options)
+		req.AuthenticatedUser.UserID = "bogus"
+		req.AuthenticatedUser.Claims = claims
+
+		return req
+	}
+	assert.Equal(t, 5*time.Minute, newReq(nil).mfaMaxAge)
+	assert.Equal(t, time.Hour, newReq(nil, WithMFA(time.Hour)).mfaMaxAge)
+
+	resp := newReq(nil).checkPolicies(t.Context())
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Equal(t, "MFA_REQUIRED", resp.Data.Code)
+	assert.Equal(t, map[string]any{"maxAge": "5m0s"}, resp.Data.Data)
+
+	stale := map[string]any{auth.MFAClaim: map[string]any{"method": auth.MFAMethodTOTP, "authTime": float64(time.Now().Add(-10 * time.Minute).Unix())}}
+	resp = newReq(stale).checkPolicies(t.Context())
+	require.NotNil(t, resp)
+	assert.Equal(t, "MFA_REQUIRED", resp.Data.Code)
+	require.Nil(t, newReq(stale, WithMFA(time.Hour)).checkPolicies(t.Context()))
+
+	fresh := map[string]any{auth.MFAClaim: map[string]any{"method": auth.MFAMethodTOTP, "authTime": float64(time.Now().Unix())}}
+	require.Nil(t, newReq(fresh).checkPolicies(t.Context()))
+}
+
+func TestCheckPoliciesScopes(t *testing.T) {
+	t.Parallel()
+	type (
+		internalRequest struct {
+			_ struct{} `scopes:"users:read, users:write"` //nolint:revive // It's processed by the router.
+		}
+	)
+	newReq := func(provider, scope string, opts ...HandlerOption) *Request[internalRequest, any] {
+		options := new(handlerOptions)
+		for _, opt := range opts {
+			opt(options)
+		}
+		req := new(Request[internalRequest, any])
+		req.Data = new(internalRequest)
+		req.processTags(options)
+		req.AuthenticatedUser.Provider = provider
+		req.AuthenticatedUser.Claims = map[string]any{"clientId": "eskimo", "scope": scope}
+		if provider != auth.ProviderService {
+			req.AuthenticatedUser.UserID = "bogus"
+		}
+
+		return req
+	}
+	assert.Equal(t, []string{"users:read", "users:write"}, newReq("", "").scopes)
+	assert.Equal(t, []string{"users:read", "users:write", "users:delete"}, newReq("", "", WithScopes("users:delete")).scopes)
+
+	require.Nil(t, newReq(auth.ProviderService, "users:write users:read").checkPolicies(t.Context()))
+
+	resp := newReq(auth.ProviderService, "users:read").checkPolicies(t.Context())
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Equal(t, "MISSING_SCOPE", resp.Data.Code)
+	assert.Equal(t, map[string]any{"scopes": []string{"users:read", "users:write"}}, resp.Data.Data)
+
+	resp = newReq("ice", "users:write users:read").checkPolicies(t.Context())
+	require.NotNil(t, resp)
+	assert.Equal(t, "MISSING_SCOPE", resp.Data.Code)
+}
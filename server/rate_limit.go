@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+
+	"github.com/ice-blockchain/wintr/connectors/storage/v3"
+	"github.com/ice-blockchain/wintr/log"
+)
+
+//nolint:gochecknoglobals // It's a stateless singleton.
+var (
+	// | gcraScript is an atomic GCRA (the token bucket equivalent that needs a single value per key) based on the redis clock.
+	gcraScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local emissionInterval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+local newTat = tat + emissionInterval
+local allowAt = newTat - emissionInterval * burst
+if allowAt > now then
+	return allowAt - now
+end
+redis.call('SET', KEYS[1], newTat, 'PX', newTat - now)
+return 0`)
+)
+
+func WithRateLimit(limit *RateLimit, keyFunc ...RateLimitKeyFunc) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.rateLimit = limit
+		if len(keyFunc) == 1 {
+			opts.rateLimitKey = keyFunc[0]
+		}
+	}
+}
+
+// RateLimitByUserID counts requests per authenticated user, falling back to the client IP for unauthenticated ones.
+func RateLimitByUserID(ginCtx *gin.Context, user *AuthenticatedUser) string {
+	if user.UserID == "" {
+		return RateLimitByClientIP(ginCtx, user)
+	}
+
+	return "user:" + user.UserID
+}
+
+func RateLimitByClientIP(ginCtx *gin.Context, _ *AuthenticatedUser) string {
+	return "ip:" + ginCtx.ClientIP()
+}
+
+func parseRateLimit(value string) *RateLimit {
+	requests, per, found := strings.Cut(value, "/")
+	if !found {
+		log.Panic(errors.Errorf("invalid rateLimit `%v`, expected format is `requests/duration`, i.e. `10/1m`", value))
+	}
+	requestCount, err := strconv.Atoi(requests)
+	log.Panic(errors.Wrapf(err, "invalid rateLimit requests `%v`", value)) //nolint:revive // That's intended.
+	duration, err := time.ParseDuration(per)
+	log.Panic(errors.Wrapf(err, "invalid rateLimit duration `%v`", value))
+	if requestCount <= 0 || duration <= 0 {
+		log.Panic(errors.Errorf("invalid rateLimit `%v`, both requests and duration must be positive", value))
+	}
+
+	return &RateLimit{Requests: requestCount, Per: duration}
+}
+
+func parseRateLimitKey(value string) RateLimitKeyFunc {
+	switch value {
+	case "", "userId":
+		return RateLimitByUserID
+	case "clientIp":
+		return RateLimitByClientIP
+	default:
+		log.Panic(errors.Errorf("invalid rateLimitBy `%v`, expected one of `userId`, `clientIp`", value))
+
+		return nil
+	}
+}
+
+func (req *Request[REQ, RESP]) checkRateLimit(ctx context.Context) *Response[ErrorResponse] {
+	if req.rateLimit == nil {
+		return nil
+	}
+	key := fmt.Sprintf("%v:%v:%v", req.ginCtx.Request.Method, req.ginCtx.FullPath(), req.rateLimitKey(req.ginCtx, &req.AuthenticatedUser))
+	if retryAfter := allowRequest(ctx, key, req.rateLimit); retryAfter > 0 {
+		return TooManyRequests(errors.Errorf("rate limit of %v requests per %v exceeded for %v", req.rateLimit.Requests, req.rateLimit.Per, key), retryAfter)
+	}
+
+	return nil
+}
+
+// allowRequest returns how long to wait for the next request, for the key, or 0 if it's allowed.
+// Requests are allowed if there's no RateLimiter in the context or if it fails.
+func allowRequest(ctx context.Context, key string, limit *RateLimit) time.Duration {
+	limiter, ok := ctx.Value(rateLimiterCtxValueKey).(RateLimiter)
+	if !ok {
+		return 0
+	}
+	retryAfter, err := limiter.Allow(ctx, key, limit)
+	if err != nil {
+		log.Error(errors.Wrapf(err, "rate limiting failed for %v, allowing request", key))
+
+		return 0
+	}
+
+	return retryAfter
+}
+
+func newRateLimiter(ctx context.Context, applicationYAMLKey string) RateLimiter {
+	if cfg.RateLimiter.Distributed {
+		return NewDistributedRateLimiter(storage.MustConnect(ctx, applicationYAMLKey))
+	}
+
+	return NewInMemoryRateLimiter(ctx)
+}
+
+// NewInMemoryRateLimiter builds a token bucket based RateLimiter, that holds its limits per process/replica only.
+func NewInMemoryRateLimiter(ctx context.Context) RateLimiter {
+	rl := &inMemoryRateLimiter{limiters: new(sync.Map)}
+	go rl.startCleanup(ctx)
+
+	return rl
+}
+
+func (rl *inMemoryRateLimiter) Allow(ctx context.Context, key string, limit *RateLimit) (time.Duration, error) {
+	if ctx.Err() != nil {
+		return 0, errors.Wrap(ctx.Err(), "context failed")
+	}
+	now := time.Now()
+	val, found := rl.limiters.Load(key)
+	if !found {
+		val, _ = rl.limiters.LoadOrStore(key, &inMemoryRateLimit{
+			Limiter: rate.NewLimiter(rate.Every(limit.Per/time.Duration(limit.Requests)), limit.Requests),
+			per:     limit.Per,
+		})
+	}
+	limiter := val.(*inMemoryRateLimit) //nolint:forcetypeassert // We know for sure.
+	limiter.lastSeenAt.Store(now.UnixNano())
+	reservation := limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+
+		return delay, nil
+	}
+
+	return 0, nil
+}
+
+func (rl *inMemoryRateLimiter) startCleanup(ctx context.Context) {
+	ticker := time.NewTicker(rateLimitCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			rl.limiters.Range(func(key, val any) bool {
+				limiter := val.(*inMemoryRateLimit) //nolint:forcetypeassert // We know for sure.
+				if now.Sub(time.Unix(0, limiter.lastSeenAt.Load())) > limiter.per {
+					rl.limiters.Delete(key)
+				}
+
+				return true
+			})
+		}
+	}
+}
+
+func (*inMemoryRateLimiter) Close() error {
+	return nil
+}
+
+// NewDistributedRateLimiter builds a RateLimiter backed by storage/v3, so that limits are shared across all replicas.
+func NewDistributedRateLimiter(db storage.DB) RateLimiter {
+	return &distributedRateLimiter{db: db}
+}
+
+func (rl *distributedRateLimiter) Allow(ctx context.Context, key string, limit *RateLimit) (time.Duration, error) {
+	emissionInterval := int64(math.Ceil(float64(limit.Per.Milliseconds()) / float64(limit.Requests)))
+	retryAfterMs, err := gcraScript.Run(ctx, rl.db, []string{"rate_limit:" + key}, emissionInterval, limit.Requests).Int64()
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to evaluate rate limit for %v", key)
+	}
+
+	return time.Duration(retryAfterMs) * time.Millisecond, nil
+}
+
+func (rl *distributedRateLimiter) Close() error {
+	return errors.Wrap(rl.db.Close(), "failed to close rate limiter storage")
+}
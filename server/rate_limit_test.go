@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, &RateLimit{Requests: 10, Per: time.Minute}, parseRateLimit("10/1m"))
+	assert.Panics(t, func() { parseRateLimit("10") })
+	assert.Panics(t, func() { parseRateLimit("0/1m") })
+	assert.Panics(t, func() { parseRateLimit("10/bogus") })
+	assert.Panics(t, func() { parseRateLimitKey("bogus") })
+}
+
+func TestProcessOptionTags(t *testing.T) {
+	t.Parallel()
+	type (
+		limitedRequest struct {
+			_ struct{} `rateLimit:"10/1m" rateLimitBy:"clientIp" mfa:"5m"` //nolint:revive // It's processed by the router.
+		}
+		invalidRequest struct {
+			_ struct{} `rateLimit:"10/bogus"` //nolint:revive // It's processed by the router.
+		}
+	)
+	options := new(handlerOptions)
+	processOptionTags[limitedRequest](options)
+	assert.Equal(t, &RateLimit{Requests: 10, Per: time.Minute}, options.rateLimit)
+	assert.NotNil(t, options.rateLimitKey)
+	assert.Equal(t, 5*time.Minute, options.mfaMaxAge)
+
+	options = new(handlerOptions)
+	WithRateLimit(&RateLimit{Requests: 1, Per: time.Second})(options)
+	WithMFA(time.Hour)(options)
+	processOptionTags[limitedRequest](options)
+	assert.Equal(t, &RateLimit{Requests: 1, Per: time.Second}, options.rateLimit)
+	assert.Equal(t, time.Hour, options.mfaMaxAge)
+
+	assert.Panics(t, func() {
+		RootHandler(func(context.Context, *Request[invalidRequest, any]) (*Response[any], *Response[ErrorResponse]) {
+			return nil, nil
+		})
+	})
+}
+
+func TestInMemoryRateLimiter(t *testing.T) {
+	t.Parallel()
+	limiter := NewInMemoryRateLimiter(t.Context())
+	limit := &RateLimit{Requests: 2, Per: time.Hour}
+	for range limit.Requests {
+		retryAfter, err := limiter.Allow(t.Context(), "bogus", limit)
+		require.NoError(t, err)
+		require.Zero(t, retryAfter)
+	}
+	retryAfter, err := limiter.Allow(t.Context(), "bogus", limit)
+	require.NoError(t, err)
+	assert.Greater(t, retryAfter, 29*time.Minute)
+	retryAfter, err = limiter.Allow(t.Context(), "other", limit)
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+	require.NoError(t, limiter.Close())
+}
@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ice-blockchain/wintr/log"
+)
+
+// render writes the successful response based on its type or, for plain structs, based on the `Accept` header.
+func render[RESP any](ctx context.Context, ginCtx *gin.Context, resp *Response[RESP]) {
+	for k, v := range resp.Headers {
+		ginCtx.Header(k, v)
+	}
+	if resp.Data == nil {
+		ginCtx.Status(resp.Code)
+
+		return
+	}
+	switch data := any(resp.Data).(type) {
+	case *File:
+		renderFile(ginCtx, resp.Code, data)
+	case *CSV:
+		renderCSV(ctx, ginCtx, resp.Code, data)
+	case *EventStream:
+		renderEventStream(ctx, ginCtx, resp.Code, data)
+	default:
+		renderNegotiated(ginCtx, resp.Code, data)
+	}
+}
+
+func renderNegotiated(ginCtx *gin.Context, code int, data any) {
+	offered := []string{contentTypeJSON, contentTypeMsgPack, contentTypeXMsgPack}
+	message, isProto := data.(proto.Message)
+	if isProto {
+		offered = append(offered, contentTypeProtobuf)
+	}
+	switch format := ginCtx.NegotiateFormat(offered...); format {
+	case contentTypeMsgPack, contentTypeXMsgPack:
+		body, err := encodeMsgPack(data)
+		if err != nil {
+			log.Error(errors.Wrapf(err, "failed to encode %T as msgpack", data))
+			ginCtx.Status(http.StatusInternalServerError)
+
+			return
+		}
+		ginCtx.Data(code, format, body)
+	case contentTypeProtobuf:
+		body, err := proto.Marshal(message)
+		if err != nil {
+			log.Error(errors.Wrapf(err, "failed to encode %T as protobuf", data))
+			ginCtx.Status(http.StatusInternalServerError)
+
+			return
+		}
+		ginCtx.Data(code, format, body)
+	default:
+		renderJSON(ginCtx, code, data)
+	}
+}
+
+// encodeMsgPack uses the `json` tags, so that msgpack clients get the same field names as json ones.
+func encodeMsgPack(data any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetCustomStructTag("json")
+	if err := encoder.Encode(data); err != nil {
+		return nil, errors.Wrap(err, "msgpack encoding failed")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func renderFile(ginCtx *gin.Context, code int, file *File) {
+	if closer, ok := file.Content.(io.Closer); ok {
+		defer func() {
+			log.Error(errors.Wrapf(closer.Close(), "failed to close file %v", file.Name))
+		}()
+	}
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = contentTypeOctet
+	}
+	disposition := "attachment"
+	if file.Inline {
+		disposition = "inline"
+	}
+	size := file.Size
+	if size <= 0 {
+		size = -1
+	}
+	ginCtx.DataFromReader(code, size, contentType, file.Content, map[string]string{"Content-Disposition": contentDisposition(disposition, file.Name)})
+}
+
+func renderCSV(ctx context.Context, ginCtx *gin.Context, code int, data *CSV) {
+	ginCtx.Header("Content-Type", contentTypeCSV)
+	ginCtx.Header("Content-Disposition", contentDisposition("attachment", data.Name))
+	ginCtx.Status(code)
+	writer := csv.NewWriter(ginCtx.Writer)
+	if len(data.Header) != 0 {
+		if err := writer.Write(data.Header); err != nil {
+			log.Error(errors.Wrapf(err, "failed to write csv header for %v", data.Name))
+
+			return
+		}
+	}
+	if data.Records != nil {
+		for record := range data.Records {
+			if ctx.Err() != nil {
+				log.Error(errors.Wrapf(ctx.Err(), "csv export %v interrupted", data.Name))
+
+				break
+			}
+			if err := writer.Write(record); err != nil {
+				log.Error(errors.Wrapf(err, "failed to write csv record for %v", data.Name))
+
+				break
+			}
+		}
+	}
+	writer.Flush()
+	log.Error(errors.Wrapf(writer.Error(), "failed to flush csv for %v", data.Name))
+}
+
+func renderEventStream(ctx context.Context, ginCtx *gin.Context, code int, data *EventStream) {
+	ginCtx.Header("Content-Type", contentTypeSSE)
+	ginCtx.Header("Cache-Control", "no-cache")
+	ginCtx.Header("Connection", "keep-alive")
+	ginCtx.Header("X-Accel-Buffering", "no")
+	ginCtx.Status(code)
+	ginCtx.Writer.Flush()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-data.Events:
+			if !ok {
+				return
+			}
+			ginCtx.Render(-1, sse.Event{
+				Id:    event.ID,
+				Event: event.Name,
+				Retry: uint(event.Retry.Milliseconds()), //nolint:gosec // It's never negative.
+				Data:  event.Data,
+			})
+			ginCtx.Writer.Flush()
+		}
+	}
+}
+
+func contentDisposition(disposition, fileName string) string {
+	if fileName == "" {
+		return disposition
+	}
+
+	return mime.FormatMediaType(disposition, map[string]string{"filename": fileName})
+}
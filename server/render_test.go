@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func newRenderTestContext(accept string) (*gin.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	ginCtx, _ := gin.CreateTestContext(recorder)
+	ginCtx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	ginCtx.Request.Header.Set("Accept", accept)
+
+	return ginCtx, recorder
+}
+
+func TestRenderNegotiated(t *testing.T) {
+	t.Parallel()
+	type resp struct {
+		UserID string `json:"userId"`
+		Empty  string `json:"empty,omitempty"`
+		Hidden string `json:"-"`
+	}
+	ginCtx, recorder := newRenderTestContext("")
+	render(t.Context(), ginCtx, OK(&resp{UserID: "x", Hidden: "y"}))
+	assert.JSONEq(t, `{"userId":"x"}`, recorder.Body.String())
+
+	ginCtx, recorder = newRenderTestContext(contentTypeMsgPack)
+	render(t.Context(), ginCtx, OK(&resp{UserID: "x", Hidden: "y"}))
+	assert.Equal(t, contentTypeMsgPack, recorder.Header().Get("Content-Type"))
+	var decoded map[string]any
+	require.NoError(t, msgpack.Unmarshal(recorder.Body.Bytes(), &decoded))
+	assert.Equal(t, map[string]any{"userId": "x"}, decoded)
+}
+
+func TestRenderFile(t *testing.T) {
+	t.Parallel()
+	ginCtx, recorder := newRenderTestContext("")
+	render(t.Context(), ginCtx, OK(&File{Content: strings.NewReader("abc"), Name: "report.txt", ContentType: "text/plain", Size: 3}))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/plain", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=report.txt`, recorder.Header().Get("Content-Disposition"))
+	assert.Equal(t, "3", recorder.Header().Get("Content-Length"))
+	assert.Equal(t, "abc", recorder.Body.String())
+}
+
+func TestRenderCSV(t *testing.T) {
+	t.Parallel()
+	ginCtx, recorder := newRenderTestContext("")
+	render(t.Context(), ginCtx, OK(&CSV{Name: "users.csv", Header: []string{"id", "name"}, Records: slices.Values([][]string{{"1", "a,b"}})}))
+	assert.Equal(t, contentTypeCSV, recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=users.csv", recorder.Header().Get("Content-Disposition"))
+	assert.Equal(t, "id,name\n1,\"a,b\"\n", recorder.Body.String())
+}
+
+func TestRenderEventStream(t *testing.T) {
+	t.Parallel()
+	ginCtx, recorder := newRenderTestContext("")
+	events := make(chan *Event, 2)
+	events <- &Event{ID: "1", Name: "update", Data: "hello"}
+	events <- &Event{Data: map[string]int{"a": 1}}
+	close(events)
+	render(t.Context(), ginCtx, OK(&EventStream{Events: events}))
+	assert.Equal(t, contentTypeSSE, recorder.Result().Header.Get("Content-Type")) //nolint:bodyclose // Not needed.
+	assert.Equal(t, "id:1\nevent:update\ndata:hello\n\ndata:{\"a\":1}\n\n", recorder.Body.String())
+}
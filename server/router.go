@@ -5,10 +5,13 @@ package server
 import (
 	"context"
 	"fmt"
+	"maps"
 	"net"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -28,42 +31,79 @@ func init() {
 }
 
 //nolint:funlen // .
-func RootHandler[REQ, RESP any](handleRequest func(context.Context, *Request[REQ, RESP]) (*Response[RESP], *Response[ErrorResponse])) func(*gin.Context) {
+func RootHandler[REQ, RESP any](
+	handleRequest func(context.Context, *Request[REQ, RESP]) (*Response[RESP], *Response[ErrorResponse]), opts ...HandlerOption,
+) func(*gin.Context) {
+	options := new(handlerOptions)
+	for _, opt := range opts {
+		opt(options)
+	}
+	requestType := fmt.Sprintf("%[1]T", new(REQ))
+	compileRequestValidations[REQ]()
+	processOptionTags[REQ](options)
+	registerOpenAPIOperation(options.route, describeOperation[REQ, RESP](options))
+
 	return func(ginCtx *gin.Context) {
-		ctx, cancel := context.WithTimeout(ginCtx.Request.Context(), cfg.DefaultEndpointTimeout)
+		defer observeRequest(ginCtx, requestType, time.Now())
+		spanCtx, span := startRequestSpan(ginCtx, requestType)
+		defer endRequestSpan(ginCtx, span)
+		ctx, cancel := context.WithTimeout(spanCtx, endpointTimeout(ginCtx, options))
 		defer cancel()
-		if ginCtx.Request.Proto != "HTTP/2.0" {
-			log.Warn(fmt.Sprintf("suboptimal http version used for %[1]T", new(REQ)), "expected", "HTTP/2.0", "actual", ginCtx.Request.Proto)
+		if ginCtx.Request.ProtoMajor < 2 { //nolint:mnd,gomnd // HTTP/2.0 and HTTP/3.0 are fine.
+			log.Warn("suboptimal http version used for "+requestType, "expected", "HTTP/2.0", "actual", ginCtx.Request.Proto)
 		}
 		req := new(Request[REQ, RESP]).init(ginCtx)
-		if err := req.processRequest(); err != nil {
+		defer req.audit(ctx, options, time.Now())
+		if err := req.processRequest(options); err != nil {
 			log.Error(errors.Wrap(err.Data.InternalErr(), "endpoint processing failed"), fmt.Sprintf("%[1]T", req.Data), req, "Response", err)
-			ginCtx.JSON(err.Code, err.Data)
+			ginCtx.JSON(err.Code, localize(ctx, ginCtx.GetHeader(languageHeader), err.Data))
 
 			return
 		}
 		if err := req.authorize(ctx); err != nil {
 			log.Error(errors.Wrap(err.Data.InternalErr(), "endpoint authentication failed"), fmt.Sprintf("%[1]T", req.Data), req, "Response", err)
-			ginCtx.JSON(err.Code, err.Data)
+			ginCtx.JSON(err.Code, localize(ctx, ginCtx.GetHeader(languageHeader), err.Data))
+
+			return
+		}
+		if err := req.checkPolicies(ctx); err != nil {
+			log.Error(errors.Wrap(err.Data.InternalErr(), "endpoint authorization failed"), fmt.Sprintf("%[1]T", req.Data), req, "Response", err)
+			ginCtx.JSON(err.Code, localize(ctx, ginCtx.GetHeader(languageHeader), err.Data))
+
+			return
+		}
+		if err := req.checkRateLimit(ctx); err != nil {
+			log.Error(errors.Wrap(err.Data.InternalErr(), "endpoint rate limited"), fmt.Sprintf("%[1]T", req.Data), req, "Response", err)
+			for k, v := range err.Headers {
+				ginCtx.Header(k, v)
+			}
+			ginCtx.JSON(err.Code, localize(ctx, ginCtx.GetHeader(languageHeader), err.Data))
 
 			return
 		}
+		idempotent, err := req.beginIdempotentRequest(ctx, options)
+		if err != nil {
+			log.Error(errors.Wrap(err.Data.InternalErr(), "endpoint idempotency check failed"), fmt.Sprintf("%[1]T", req.Data), req, "Response", err)
+			ginCtx.JSON(err.Code, localize(ctx, ginCtx.GetHeader(languageHeader), err.Data))
+
+			return
+		}
+		if idempotent.replayed(ginCtx) {
+			return
+		}
+		defer idempotent.end(ctx, ginCtx)
 		reqCtx := context.WithValue(ctx, requestingUserIDCtxValueKey, req.AuthenticatedUser.UserID) //nolint:staticcheck,revive // .
 		success, failure := handleRequest(reqCtx, req)
 		if failure != nil {
 			log.Error(errors.Wrap(failure.Data.InternalErr(), "endpoint failed"), fmt.Sprintf("%[1]T", req.Data), req, "Response", failure)
+			for k, v := range failure.Headers {
+				ginCtx.Header(k, v)
+			}
 			ginCtx.JSON(req.processErrorResponse(ctx, failure))
 
 			return
 		}
-		for k, v := range success.Headers {
-			ginCtx.Header(k, v)
-		}
-		if success.Data != nil {
-			ginCtx.JSON(success.Code, success.Data)
-		} else {
-			ginCtx.Status(success.Code)
-		}
+		render(ctx, ginCtx, success)
 	}
 }
 
@@ -71,12 +111,43 @@ func (req *Request[REQ, RESP]) init(ginCtx *gin.Context) *Request[REQ, RESP] {
 	req.Data = new(REQ)
 	req.ClientIP = net.ParseIP(ginCtx.ClientIP())
 	req.ginCtx = ginCtx
+	req.fingerprintRequest()
 
 	return req
 }
 
+// processOptionTags parses the `rateLimit`, `rateLimitBy` and `mfa` tags once, when the handler is built, so that invalid ones fail at startup.
+// The handler options take precedence over them.
+func processOptionTags[REQ any](options *handlerOptions) {
+	elem := reflect.TypeOf(new(REQ)).Elem()
+	if elem.Kind() != reflect.Struct {
+		return
+	}
+	var (
+		rateLimit    *RateLimit
+		rateLimitKey RateLimitKeyFunc
+		mfaMaxAge    time.Duration
+	)
+	for i := range elem.NumField() {
+		tag := elem.Field(i).Tag
+		if mfa := tag.Get(mfaTag); mfa != "" {
+			mfaMaxAge = parseMFAMaxAge(mfa)
+		}
+		if limit := tag.Get("rateLimit"); limit != "" {
+			rateLimit = parseRateLimit(limit)
+			rateLimitKey = parseRateLimitKey(tag.Get("rateLimitBy"))
+		}
+	}
+	if options.rateLimit == nil {
+		options.rateLimit, options.rateLimitKey = rateLimit, rateLimitKey
+	}
+	if options.mfaMaxAge == 0 {
+		options.mfaMaxAge = mfaMaxAge
+	}
+}
+
 //nolint:funlen,gocognit,revive // Alot of usecases.
-func (req *Request[REQ, RESP]) processTags() {
+func (req *Request[REQ, RESP]) processTags(options *handlerOptions) {
 	elem := reflect.TypeOf(req.Data).Elem()
 	if elem.Kind() != reflect.Struct {
 		log.Panic("request data's have to be structs")
@@ -100,6 +171,15 @@ func (req *Request[REQ, RESP]) processTags() {
 		if tag.Get("allowForbiddenWriteOperation") == enabled {
 			req.allowForbiddenWriteOperation = true
 		}
+		if roles := tag.Get(rolesTag); roles != "" {
+			req.roles = append(req.roles, parseRoles(roles)...)
+		}
+		if scopes := tag.Get(scopesTag); scopes != "" {
+			req.scopes = append(req.scopes, parseRoles(scopes)...)
+		}
+		if claims := tag.Get(requiredClaimsTag); claims != "" {
+			req.requiredClaims = parseRequiredClaims(claims, req.requiredClaims)
+		}
 		if jsonTag := tag.Get("json"); jsonTag != "" && jsonTag != "-" {
 			req.bindings[json] = struct{}{}
 		}
@@ -118,10 +198,32 @@ func (req *Request[REQ, RESP]) processTags() {
 			req.bindings[formMultipart] = struct{}{}
 		}
 	}
+	if paginationOf(req.Data) != nil {
+		req.bindings[query] = struct{}{}
+	}
+	if options.rateLimit != nil {
+		req.rateLimit = options.rateLimit
+		req.rateLimitKey = options.rateLimitKey
+	}
+	req.roles = append(req.roles, options.roles...)
+	req.scopes = append(req.scopes, options.scopes...)
+	for claim, value := range options.requiredClaims {
+		if req.requiredClaims == nil {
+			req.requiredClaims = make(map[string]string, len(options.requiredClaims))
+		}
+		req.requiredClaims[claim] = value
+	}
+	req.policies = options.policies
+	if options.mfaMaxAge > 0 {
+		req.mfaMaxAge = options.mfaMaxAge
+	}
+	if req.rateLimit != nil && req.rateLimitKey == nil {
+		req.rateLimitKey = RateLimitByUserID
+	}
 }
 
-func (req *Request[REQ, RESP]) processRequest() *Response[ErrorResponse] {
-	req.processTags()
+func (req *Request[REQ, RESP]) processRequest(options *handlerOptions) *Response[ErrorResponse] {
+	req.processTags(options)
 	var errs []error
 	for b := range req.bindings {
 		switch b { //nolint:revive // .
@@ -138,28 +240,44 @@ func (req *Request[REQ, RESP]) processRequest() *Response[ErrorResponse] {
 		}
 	}
 	if err := multierror.Append(nil, errs...).ErrorOrNil(); err != nil {
+		if maxBytesErr := new(http.MaxBytesError); errors.As(err, &maxBytesErr) {
+			return RequestEntityTooLarge(errors.Wrapf(err, "binding failed"), maxBytesErr.Limit)
+		}
+
 		return UnprocessableEntity(errors.Wrapf(err, "binding failed"), "STRUCTURE_VALIDATION_FAILED")
 	}
+	if err := req.paginate(); err != nil {
+		return err
+	}
 
 	return req.validate()
 }
 
 func (req *Request[REQ, RESP]) validate() *Response[ErrorResponse] {
-	if len(req.requiredFields) == 0 {
-		return nil
-	}
+	invalidFields := req.invalidFields()
 	value := reflect.ValueOf(req.Data).Elem()
+	stdType := reflect.ToReflectType(value.Type())
 	requiredFields := make([]string, 0, len(req.requiredFields))
 	for _, field := range req.requiredFields {
 		if value.FieldByName(field).IsZero() {
 			requiredFields = append(requiredFields, field)
+			if invalidFields == nil {
+				invalidFields = make(map[string]any, len(req.requiredFields))
+			}
+			stdField, _ := stdType.FieldByName(field)
+			invalidFields[fieldName(stdField)] = missingPropertyCode
 		}
 	}
-	if len(requiredFields) == 0 {
-		return nil
+	if len(requiredFields) != 0 {
+		return UnprocessableEntity(errors.Errorf("properties `%v` are required", strings.Join(requiredFields, ",")), "MISSING_PROPERTIES", invalidFields)
+	}
+	if len(invalidFields) != 0 {
+		properties := slices.Sorted(maps.Keys(invalidFields))
+
+		return UnprocessableEntity(errors.Errorf("properties `%v` are invalid", strings.Join(properties, ",")), "INVALID_PROPERTIES", invalidFields)
 	}
 
-	return UnprocessableEntity(errors.Errorf("properties `%v` are required", strings.Join(requiredFields, ",")), "MISSING_PROPERTIES")
+	return nil
 }
 
 //nolint:gocyclo,revive,cyclop,gocognit // .
@@ -172,22 +290,17 @@ func (req *Request[REQ, RESP]) authorize(ctx context.Context) (errResp *Response
 			}
 		}()
 	}
-	authToken := strings.TrimPrefix(req.ginCtx.GetHeader("Authorization"), "Bearer ")
-	token, err := Auth(ctx).VerifyToken(ctx, authToken)
-	if err != nil {
-		if errors.Is(err, auth.ErrForbidden) {
-			return Forbidden(err)
-		}
-
-		return Unauthorized(err)
+	token, errResp := verifyToken(ctx, Auth(ctx), req.ginCtx.GetHeader("Authorization"), req.ginCtx.GetHeader("X-Account-Metadata"))
+	if errResp != nil {
+		return errResp
 	}
-	metadataHeader := req.ginCtx.GetHeader("X-Account-Metadata")
-	if token, err = Auth(ctx).ModifyTokenWithMetadata(token, metadataHeader); err != nil {
-		return Unauthorized(err)
+	isService := token.Provider == auth.ProviderService
+	if isService && len(req.scopes) == 0 {
+		return ForbiddenWithCode(errors.Errorf("service %v can't call endpoints without scopes", token.Claims["clientId"]), "SERVICE_TOKEN_NOT_ALLOWED")
 	}
 	req.AuthenticatedUser.Token = *token
 	req.AuthenticatedUser.Language = req.ginCtx.GetHeader(languageHeader)
-	if userID != "" && userID != "-" && req.AuthenticatedUser.UserID != userID &&
+	if !isService && userID != "" && userID != "-" && req.AuthenticatedUser.UserID != userID &&
 		((!req.allowForbiddenWriteOperation && req.ginCtx.Request.Method != http.MethodGet) ||
 			(req.ginCtx.Request.Method == http.MethodGet && !req.allowForbiddenGet && !strings.HasSuffix(req.ginCtx.Request.URL.Path, userID))) {
 		return Forbidden(errors.Errorf("operation not allowed. uri>%v!=token>%v", userID, req.AuthenticatedUser.UserID))
@@ -196,6 +309,22 @@ func (req *Request[REQ, RESP]) authorize(ctx context.Context) (errResp *Response
 	return nil
 }
 
+func verifyToken(ctx context.Context, authClient auth.Client, authorization, metadata string) (*auth.Token, *Response[ErrorResponse]) {
+	token, err := authClient.VerifyToken(ctx, strings.TrimPrefix(authorization, "Bearer "))
+	if err != nil {
+		if errors.Is(err, auth.ErrForbidden) {
+			return nil, Forbidden(err)
+		}
+
+		return nil, Unauthorized(err)
+	}
+	if token, err = authClient.ModifyTokenWithMetadataContext(ctx, token, metadata); err != nil {
+		return nil, Unauthorized(err)
+	}
+
+	return token, nil
+}
+
 func (req *Request[REQ, RESP]) processErrorResponse(ctx context.Context, failure *Response[ErrorResponse]) (int, *ErrorResponse) {
 	err := failure.Data.InternalErr()
 	if errors.Is(err, req.ginCtx.Request.Context().Err()) {
@@ -208,7 +337,7 @@ func (req *Request[REQ, RESP]) processErrorResponse(ctx context.Context, failure
 		return http.StatusInternalServerError, &ErrorResponse{Error: "oops, something went wrong"}
 	}
 
-	return failure.Code, failure.Data
+	return failure.Code, localize(ctx, req.ginCtx.GetHeader(languageHeader), failure.Data)
 }
 
 func Auth(ctx context.Context) auth.Client {
@@ -4,14 +4,20 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
@@ -21,6 +27,9 @@ import (
 	"github.com/ice-blockchain/wintr/auth"
 	appcfg "github.com/ice-blockchain/wintr/config"
 	"github.com/ice-blockchain/wintr/log"
+	wintrtime "github.com/ice-blockchain/wintr/time"
+	"github.com/ice-blockchain/wintr/tracing"
+	"github.com/ice-blockchain/wintr/translations"
 )
 
 func New(state State, cfgKey, swaggerRoot string, nginxPrefixOpt ...string) Server {
@@ -35,17 +44,37 @@ func New(state State, cfgKey, swaggerRoot string, nginxPrefixOpt ...string) Serv
 }
 
 func (s *srv) ListenAndServe(ctx context.Context, cancel context.CancelFunc) {
-	authClient := auth.New(ctx, s.applicationYAMLKey)
-	ctx = context.WithValue(ctx, authClientCtxValueKey, authClient) //nolint:staticcheck,revive // .
+	s.shutdownTracing = tracing.MustInit(ctx, s.applicationYAMLKey)
+	s.authClient = auth.New(ctx, s.applicationYAMLKey)
+	ctx = context.WithValue(ctx, authClientCtxValueKey, s.authClient) //nolint:staticcheck,revive // .
+	s.rateLimiter = newRateLimiter(ctx, s.applicationYAMLKey)
+	ctx = context.WithValue(ctx, rateLimiterCtxValueKey, s.rateLimiter) //nolint:staticcheck,revive // .
+	if s.idempotencyStore = newIdempotencyStore(ctx, s.applicationYAMLKey); s.idempotencyStore != nil {
+		ctx = context.WithValue(ctx, idempotencyStoreCtxValueKey, s.idempotencyStore) //nolint:staticcheck,revive // .
+	}
+	if cfg.LocalizeErrors {
+		ctx = context.WithValue(ctx, translationsCtxValueKey, translations.New(ctx, s.applicationYAMLKey)) //nolint:staticcheck,revive // .
+	}
+	s.webSockets = newWebSockets()
+	ctx = context.WithValue(ctx, webSocketsCtxValueKey, s.webSockets) //nolint:staticcheck,revive // .
 	s.Init(ctx, cancel)
-	s.setupRouter() //nolint:contextcheck // Nope, we don't need it.
+	if s.auditor = newAuditor(ctx, s.State, s.applicationYAMLKey); s.auditor != nil {
+		ctx = context.WithValue(ctx, auditorCtxValueKey, s.auditor) //nolint:staticcheck,revive // .
+	}
+	s.setupRouter(ctx)
+	s.setupGRPCServer(ctx)
 	s.setupServer(ctx)
+	s.setupMetricsServer()
+	s.ready.Store(true)
 	go s.startServer()
+	go s.startMetricsServer()
+	go s.startGRPCServer()
+	go s.startHTTP3Server()
 	s.wait(ctx)
 	s.shutDown() //nolint:contextcheck // Nope, we want to gracefully shutdown on a different context.
 }
 
-func (s *srv) setupRouter() {
+func (s *srv) setupRouter(ctx context.Context) {
 	if !development {
 		gin.SetMode(gin.ReleaseMode)
 		s.router = gin.New()
@@ -55,6 +84,7 @@ func (s *srv) setupRouter() {
 		s.router = gin.Default()
 	}
 	log.Info(fmt.Sprintf("GIN Mode: %v\n", gin.Mode()))
+	s.setupMiddlewares()
 	s.router.RemoteIPHeaders = []string{"cf-connecting-ip", "X-Real-IP", "X-Forwarded-For"}
 	s.router.TrustedPlatform = gin.PlatformCloudflare
 	s.router.HandleMethodNotAllowed = true
@@ -67,6 +97,85 @@ func (s *srv) setupRouter() {
 	log.Info(fmt.Sprintf("%v routes registered", len(s.router.Routes())))
 	s.setupSwaggerRoutes()
 	s.setupHealthCheckRoutes()
+	s.setupErrorCodesRoutes()
+	s.setupOpenAPIRoutes()
+	s.setupJWKSRoutes()
+	s.setupServiceTokenRoutes(ctx)
+}
+
+// setupJWKSRoutes serves the public keys of the ice tokens, so that other services can verify them without the signing keys.
+func (s *srv) setupJWKSRoutes() {
+	s.router.GET(".well-known/jwks.json", func(ginCtx *gin.Context) {
+		authClient, ok := ginCtx.Request.Context().Value(authClientCtxValueKey).(auth.Client)
+		if !ok {
+			ginCtx.Status(http.StatusNotFound)
+
+			return
+		}
+		set := authClient.JWKS()
+		if set == nil || len(set.Keys) == 0 {
+			ginCtx.Status(http.StatusNotFound)
+
+			return
+		}
+		ginCtx.Header("Cache-Control", jwksCacheControl)
+		ginCtx.JSON(http.StatusOK, set)
+	})
+}
+
+// setupServiceTokenRoutes issues service tokens (see auth.IssueServiceToken) via the OAuth2 client credentials grant.
+// The clients authenticate with their secret, in the form or via basic auth, or with their certificate, if mTLS is enabled.
+// It's registered only if there are services that can get service tokens and it's rate limited per client IP and per client id.
+func (s *srv) setupServiceTokenRoutes(ctx context.Context) {
+	authClient := Auth(ctx)
+	if !authClient.IssuesServiceTokens() {
+		return
+	}
+	rateLimit := cfg.RateLimiter.ServiceTokens
+	if rateLimit == "" {
+		rateLimit = defaultServiceTokenRateLimit
+	}
+	limit := parseRateLimit(rateLimit)
+	s.router.POST(serviceTokenPath, func(ginCtx *gin.Context) {
+		ginCtx.Header("Cache-Control", "no-store")
+		if ginCtx.PostForm("grant_type") != "client_credentials" {
+			ginCtx.JSON(http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+
+			return
+		}
+		credentials := &auth.ServiceCredentials{ClientID: ginCtx.PostForm("client_id"), ClientSecret: ginCtx.PostForm("client_secret")}
+		if clientID, clientSecret, found := ginCtx.Request.BasicAuth(); found && credentials.ClientSecret == "" {
+			credentials.ClientID, credentials.ClientSecret = clientID, clientSecret
+		}
+		keys := []string{"POST:" + serviceTokenPath + ":ip:" + ginCtx.ClientIP()}
+		if credentials.ClientID != "" {
+			keys = append(keys, "POST:"+serviceTokenPath+":client:"+credentials.ClientID)
+		}
+		for _, key := range keys {
+			if retryAfter := allowRequest(ginCtx.Request.Context(), key, limit); retryAfter > 0 {
+				ginCtx.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+				ginCtx.JSON(http.StatusTooManyRequests, map[string]string{"error": "slow_down"})
+
+				return
+			}
+		}
+		if tlsState := ginCtx.Request.TLS; tlsState != nil && len(tlsState.VerifiedChains) != 0 && len(tlsState.VerifiedChains[0]) != 0 {
+			credentials.Certificate = tlsState.VerifiedChains[0][0]
+		}
+		token, err := authClient.IssueServiceToken(wintrtime.Now(), credentials, strings.Fields(ginCtx.PostForm("scope"))...)
+		switch {
+		case err == nil:
+			ginCtx.JSON(http.StatusOK, token)
+		case errors.Is(err, auth.ErrInvalidScope):
+			ginCtx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid_scope"})
+		case errors.Is(err, auth.ErrInvalidClient):
+			log.Error(errors.Wrap(err, "service authentication failed"), "clientId", credentials.ClientID)
+			ginCtx.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		default:
+			log.Error(errors.Wrap(err, "failed to issue service token"), "clientId", credentials.ClientID)
+			ginCtx.JSON(http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		}
+	})
 }
 
 func (s *srv) setupHealthCheckRoutes() {
@@ -76,7 +185,31 @@ func (s *srv) setupHealthCheckRoutes() {
 		}
 
 		return OK(&map[string]string{"clientIp": "1.2.3.4"}), nil
-	}))
+	}, WithRoute(http.MethodGet, "health-check")))
+	s.router.GET("health/live", RootHandler(func(context.Context, *Request[healthCheck, map[string]string]) (*Response[map[string]string], *Response[ErrorResponse]) { //nolint:lll // .
+		return OK(&map[string]string{"status": "live"}), nil
+	}, WithRoute(http.MethodGet, "health/live")))
+	s.router.GET("health/ready", RootHandler(func(ctx context.Context, _ *Request[healthCheck, map[string]string]) (*Response[map[string]string], *Response[ErrorResponse]) { //nolint:lll // .
+		if !s.ready.Load() {
+			return nil, ServiceUnavailable(errors.New("server is draining"), "NOT_READY")
+		}
+		if err := s.State.CheckHealth(ctx); err != nil { //nolint:staticcheck // .
+			return nil, ServiceUnavailable(errors.Wrapf(err, "health check failed"), "NOT_READY")
+		}
+
+		return OK(&map[string]string{"status": "ready"}), nil
+	}, WithRoute(http.MethodGet, "health/ready")))
+}
+
+// trackInFlight counts the requests being handled, so that shutDown can wait for them, including the ones outliving http.Server.Shutdown.
+func (s *srv) trackInFlight(ginCtx *gin.Context) {
+	s.inFlight.Add(1)
+	requestsInFlight.Inc()
+	defer func() {
+		requestsInFlight.Dec()
+		s.inFlight.Add(-1)
+	}()
+	ginCtx.Next()
 }
 
 func (s *srv) setupSwaggerRoutes() {
@@ -88,17 +221,34 @@ func (s *srv) setupSwaggerRoutes() {
 		GET(root, func(c *gin.Context) {
 			c.Redirect(http.StatusFound, (&url.URL{Path: fmt.Sprintf("%v%v/swagger/index.html", s.nginxPrefix, root)}).RequestURI())
 		}).
-		GET(fmt.Sprintf("%v/swagger/*any", root), ginswagger.WrapHandler(swaggerfiles.Handler))
+		GET(fmt.Sprintf("%v/swagger/*any", root), ginswagger.WrapHandler(swaggerfiles.Handler, ginswagger.URL(s.nginxPrefix+s.openAPIPath())))
 }
 
 func (s *srv) setupServer(ctx context.Context) {
+	s.setupHTTP3Server(ctx, s.router)
 	s.server = &http.Server{ //nolint:gosec // Not an issue, each request has a deadline set by the handler; and we're behind a proxy.
 		Addr:    fmt.Sprintf(":%v", cfg.HTTPServer.Port),
-		Handler: s.router,
+		Handler: s.advertiseHTTP3(s.handler()),
 		BaseContext: func(_ net.Listener) context.Context {
 			return ctx
 		},
+		TLSConfig: clientCATLSConfig(),
+	}
+}
+
+// clientCATLSConfig enables mTLS, if HTTPServer.ClientCAPath is set. Client certificates are optional, the endpoints that need them check them.
+func clientCATLSConfig() *tls.Config {
+	if cfg.HTTPServer.ClientCAPath == "" {
+		return nil
+	}
+	pem, err := os.ReadFile(cfg.HTTPServer.ClientCAPath)
+	log.Panic(errors.Wrapf(err, "failed to read client CAs from %v", cfg.HTTPServer.ClientCAPath)) //nolint:revive // That's intended.
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		log.Panic(errors.Errorf("no client CAs found in %v", cfg.HTTPServer.ClientCAPath))
 	}
+
+	return &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven, MinVersion: tls.VersionTLS12}
 }
 
 func (s *srv) startServer() {
@@ -128,7 +278,42 @@ func (s *srv) wait(ctx context.Context) {
 	}
 }
 
+func (s *srv) drain() {
+	s.ready.Store(false)
+	if s.grpcHealth != nil {
+		s.grpcHealth.Shutdown()
+	}
+	if cfg.DrainPeriod <= 0 {
+		return
+	}
+	log.Info(fmt.Sprintf("draining server for %v...", cfg.DrainPeriod))
+	time.Sleep(cfg.DrainPeriod)
+}
+
+func (s *srv) waitForInFlightRequests(ctx context.Context) {
+	ticker := time.NewTicker(inFlightPollInterval)
+	defer ticker.Stop()
+	for inFlight := s.inFlight.Load(); inFlight > 0; inFlight = s.inFlight.Load() {
+		select {
+		case <-ctx.Done():
+			log.Error(errors.Wrapf(ctx.Err(), "%v in-flight requests did not finish in time", inFlight))
+
+			return
+		case <-ticker.C:
+		}
+	}
+	log.Info("all in-flight requests finished")
+}
+
+// shutDown stops serving, giving the requests in flight up to DefaultEndpointTimeout to finish, and then closes the resources,
+// with their own shutDownCloseTimeout, so that they're closed properly even if the requests used up all of theirs.
 func (s *srv) shutDown() {
+	s.drain()
+	s.stopServing()
+	s.closeResources()
+}
+
+func (s *srv) stopServing() {
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.DefaultEndpointTimeout)
 	defer cancel()
 	log.Info("shutting down server...")
@@ -138,10 +323,44 @@ func (s *srv) shutDown() {
 	} else {
 		log.Info("server shutdown succeeded")
 	}
+	s.shutDownHTTP3Server(ctx)
+	s.stopGRPCServer(ctx)
+	s.webSockets.closeAll(ctx)
+	s.waitForInFlightRequests(ctx)
+}
+
+func (s *srv) closeResources() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutDownCloseTimeout)
+	defer cancel()
+	s.shutDownMetricsServer(ctx)
+
+	if s.auditor != nil {
+		if err := s.auditor.close(); err != nil && !errors.Is(err, io.EOF) {
+			log.Error(errors.Wrap(err, "auditor close failed"))
+		}
+	}
 
 	if err := s.State.Close(ctx); err != nil && !errors.Is(err, io.EOF) { //nolint:staticcheck // .
 		log.Error(errors.Wrap(err, "state close failed"))
 	} else {
 		log.Info("state close succeeded")
 	}
+
+	if err := s.authClient.Close(); err != nil && !errors.Is(err, io.EOF) {
+		log.Error(errors.Wrap(err, "auth client close failed"))
+	}
+
+	if err := s.rateLimiter.Close(); err != nil && !errors.Is(err, io.EOF) {
+		log.Error(errors.Wrap(err, "rate limiter close failed"))
+	}
+
+	if s.idempotencyStore != nil {
+		if err := s.idempotencyStore.Close(); err != nil && !errors.Is(err, io.EOF) {
+			log.Error(errors.Wrap(err, "idempotency store close failed"))
+		}
+	}
+
+	if err := s.shutdownTracing(ctx); err != nil {
+		log.Error(errors.Wrap(err, "tracing shutdown failed"))
+	}
 }
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/auth"
+)
+
+type (
+	healthTestState struct {
+		State
+	}
+)
+
+func (*healthTestState) CheckHealth(context.Context) error {
+	return nil
+}
+
+func serveHealthTest(s *srv, path string) *httptest.ResponseRecorder {
+	ctx := context.WithValue(context.Background(), authClientCtxValueKey, auth.Client(new(webSocketTestAuth))) //nolint:staticcheck,revive // .
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, httptest.NewRequestWithContext(ctx, http.MethodGet, path, nil))
+
+	return recorder
+}
+
+func TestHealthCheckRoutes(t *testing.T) {
+	t.Parallel()
+	s := &srv{State: new(healthTestState), router: gin.New()}
+	s.setupHealthCheckRoutes()
+	s.ready.Store(true)
+	assert.Equal(t, http.StatusOK, serveHealthTest(s, "/health/live").Code)
+	resp := serveHealthTest(s, "/health/ready")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"status":"ready"}`, resp.Body.String())
+
+	s.drain()
+	assert.Equal(t, http.StatusOK, serveHealthTest(s, "/health/live").Code)
+	resp = serveHealthTest(s, "/health/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"NOT_READY"`)
+}
+
+func TestTrackInFlight(t *testing.T) {
+	t.Parallel()
+	s := &srv{router: gin.New()}
+	s.router.Use(s.trackInFlight)
+	started, release := make(chan struct{}), make(chan struct{})
+	s.router.GET("/slow", RootHandler(func(context.Context, *Request[healthCheck, string]) (*Response[string], *Response[ErrorResponse]) {
+		close(started)
+		<-release
+
+		return OK(new(string)), nil
+	}))
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serveHealthTest(s, "/slow") }()
+	<-started
+	assert.EqualValues(t, 1, s.inFlight.Load())
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	s.waitForInFlightRequests(ctx)
+	require.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+
+	close(release)
+	assert.Equal(t, http.StatusOK, (<-done).Code)
+	assert.EqualValues(t, 0, s.inFlight.Load())
+	s.waitForInFlightRequests(t.Context())
+}
@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	gojson "github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/auth"
+	"github.com/ice-blockchain/wintr/time"
+)
+
+type (
+	serviceTokenTestAuth struct {
+		auth.Client
+		withoutClients bool
+	}
+	serviceTokenTestRequest struct {
+		UserID string `uri:"userId" required:"true" scopes:"users:read"`
+	}
+	userTokenTestRequest struct {
+		UserID string `uri:"userId" required:"true"`
+	}
+)
+
+func (*serviceTokenTestAuth) VerifyToken(_ context.Context, token string) (*auth.Token, error) {
+	switch token {
+	case "service":
+		return &auth.Token{Provider: auth.ProviderService, Claims: map[string]any{"clientId": "eskimo", "scope": "users:read"}}, nil
+	case "user":
+		return &auth.Token{UserID: "bogus"}, nil
+	default:
+		return nil, errors.New("invalid token")
+	}
+}
+
+func (*serviceTokenTestAuth) ModifyTokenWithMetadataContext(_ context.Context, token *auth.Token, _ string) (*auth.Token, error) {
+	return token, nil
+}
+
+func (*serviceTokenTestAuth) IssueServiceToken(_ *time.Time, credentials *auth.ServiceCredentials, scopes ...string) (*auth.ServiceToken, error) {
+	if credentials.ClientID != "eskimo" || credentials.ClientSecret != "bogus" {
+		return nil, errors.Wrap(auth.ErrInvalidClient, "wrong secret")
+	}
+	if len(scopes) != 0 && scopes[0] != "users:read" {
+		return nil, errors.Wrap(auth.ErrInvalidScope, "not granted")
+	}
+
+	return &auth.ServiceToken{AccessToken: "service", TokenType: "Bearer", Scope: "users:read", ExpiresIn: 300}, nil
+}
+
+func (a *serviceTokenTestAuth) IssuesServiceTokens() bool {
+	return !a.withoutClients
+}
+
+func newServiceTokenTestRouter(t *testing.T, authClient auth.Client, rateLimiter RateLimiter) *srv {
+	t.Helper()
+	s := &srv{router: gin.New()}
+	ctx := context.WithValue(t.Context(), authClientCtxValueKey, authClient) //nolint:staticcheck,revive // .
+	if rateLimiter != nil {
+		ctx = context.WithValue(ctx, rateLimiterCtxValueKey, rateLimiter) //nolint:staticcheck,revive // .
+	}
+	s.router.Use(func(ginCtx *gin.Context) {
+		ginCtx.Request = ginCtx.Request.WithContext(ctx)
+	})
+	s.setupServiceTokenRoutes(ctx)
+
+	return s
+}
+
+func TestServiceTokenRoute(t *testing.T) {
+	t.Parallel()
+	s := newServiceTokenTestRouter(t, new(serviceTokenTestAuth), nil)
+	issue := func(form url.Values, basicAuth ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/"+serviceTokenPath, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if len(basicAuth) == 2 { //nolint:mnd // User and password.
+			req.SetBasicAuth(basicAuth[0], basicAuth[1])
+		}
+		recorder := httptest.NewRecorder()
+		s.router.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := issue(url.Values{"grant_type": {"client_credentials"}, "client_id": {"eskimo"}, "client_secret": {"bogus"}, "scope": {"users:read"}})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+	token := new(auth.ServiceToken)
+	require.NoError(t, gojson.Unmarshal(recorder.Body.Bytes(), token))
+	assert.Equal(t, &auth.ServiceToken{AccessToken: "service", TokenType: "Bearer", Scope: "users:read", ExpiresIn: 300}, token)
+
+	assert.Equal(t, http.StatusOK, issue(url.Values{"grant_type": {"client_credentials"}}, "eskimo", "bogus").Code)
+	assert.Equal(t, http.StatusUnauthorized, issue(url.Values{"grant_type": {"client_credentials"}}, "eskimo", "wrong").Code)
+	recorder = issue(url.Values{"grant_type": {"client_credentials"}, "client_id": {"eskimo"}, "client_secret": {"bogus"}, "scope": {"users:delete"}})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.JSONEq(t, `{"error":"invalid_scope"}`, recorder.Body.String())
+	recorder = issue(url.Values{"grant_type": {"password"}, "client_id": {"eskimo"}, "client_secret": {"bogus"}})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.JSONEq(t, `{"error":"unsupported_grant_type"}`, recorder.Body.String())
+}
+
+func TestServiceTokenAuthorization(t *testing.T) {
+	t.Parallel()
+	s := newServiceTokenTestRouter(t, new(serviceTokenTestAuth), nil)
+	s.router.GET("internal/users/:userId", RootHandler(func(_ context.Context, req *Request[serviceTokenTestRequest, string]) (*Response[string], *Response[ErrorResponse]) { //nolint:lll // .
+		return OK(&req.Data.UserID), nil
+	}))
+	s.router.GET("users/:userId", RootHandler(func(_ context.Context, req *Request[userTokenTestRequest, string]) (*Response[string], *Response[ErrorResponse]) { //nolint:lll // .
+		return OK(&req.Data.UserID), nil
+	}))
+	call := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, path, http.NoBody)
+		req.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		s.router.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusOK, call("/internal/users/someone", "service").Code)
+	recorder := call("/internal/users/bogus", "user")
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "MISSING_SCOPE")
+	recorder = call("/users/someone", "service")
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "SERVICE_TOKEN_NOT_ALLOWED")
+	assert.Equal(t, http.StatusOK, call("/users/bogus", "user").Code)
+}
+
+func TestServiceTokenRouteRateLimit(t *testing.T) {
+	t.Parallel()
+	s := newServiceTokenTestRouter(t, new(serviceTokenTestAuth), NewInMemoryRateLimiter(t.Context()))
+	issue := func(clientIP, clientID string) *httptest.ResponseRecorder {
+		form := url.Values{"grant_type": {"client_credentials"}, "client_id": {clientID}, "client_secret": {"wrong"}}
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/"+serviceTokenPath, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = clientIP + ":1234"
+		recorder := httptest.NewRecorder()
+		s.router.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	for range 10 {
+		require.Equal(t, http.StatusUnauthorized, issue("1.1.1.1", "eskimo").Code)
+	}
+	recorder := issue("1.1.1.1", "santa")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.NotEmpty(t, recorder.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusTooManyRequests, issue("2.2.2.2", "eskimo").Code)
+	assert.Equal(t, http.StatusUnauthorized, issue("2.2.2.2", "santa").Code)
+}
+
+func TestServiceTokenRouteWithoutClients(t *testing.T) {
+	t.Parallel()
+	s := newServiceTokenTestRouter(t, &serviceTokenTestAuth{withoutClients: true}, nil)
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/"+serviceTokenPath, http.NoBody))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Empty(t, s.router.Routes())
+}
@@ -0,0 +1,35 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/ice-blockchain/wintr/tracing"
+)
+
+func startRequestSpan(ginCtx *gin.Context, requestType string) (context.Context, tracing.Span) {
+	ctx := tracing.ExtractHTTP(ginCtx.Request.Context(), ginCtx.Request.Header)
+
+	return tracing.Start(ctx, ginCtx.Request.Method+" "+ginCtx.FullPath(), tracing.SpanKindServer,
+		attribute.String("http.request.method", ginCtx.Request.Method),
+		attribute.String("http.route", ginCtx.FullPath()),
+		attribute.String("client.address", ginCtx.ClientIP()),
+		attribute.String("request.type", requestType),
+	)
+}
+
+func endRequestSpan(ginCtx *gin.Context, span tracing.Span) {
+	status := ginCtx.Writer.Status()
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	var err error
+	if status >= http.StatusInternalServerError {
+		err = errors.Errorf("request failed with %v", status)
+	}
+	tracing.End(span, err)
+}
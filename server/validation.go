@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+
+	"github.com/ice-blockchain/wintr/log"
+)
+
+//nolint:gochecknoglobals // Because its loaded once, at runtime.
+var (
+	fieldValidator      *validator.Validate
+	fieldValidatorOnce  = new(sync.Once)
+	compiledValidations = new(sync.Map) // Is a map[string]*regexp.Regexp.
+)
+
+func structValidator() *validator.Validate {
+	fieldValidatorOnce.Do(func() {
+		fieldValidator = validator.New(validator.WithRequiredStructEnabled())
+		fieldValidator.SetTagName(validateTag)
+		fieldValidator.RegisterTagNameFunc(fieldName)
+		fieldValidator.RegisterAlias("phone", "e164")
+		log.Panic(errors.Wrap(fieldValidator.RegisterValidation("regexp", matchesRegexp), "failed to register regexp validation")) //nolint:revive // .
+	})
+
+	return fieldValidator
+}
+
+func fieldName(field reflect.StructField) string {
+	for _, tagName := range []string{"json", "uri", "form", "formMultipart", "header"} {
+		if name, _, _ := strings.Cut(field.Tag.Get(tagName), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return field.Name
+}
+
+func matchesRegexp(fl validator.FieldLevel) bool {
+	if fl.Field().Kind() != reflect.String {
+		return false
+	}
+	compiled, found := compiledValidations.Load(fl.Param())
+	if !found {
+		log.Error(errors.Errorf("regexp validation `%v` was not compiled when the handler was built", fl.Param()))
+
+		return false
+	}
+
+	return compiled.(*regexp.Regexp).MatchString(fl.Field().String()) //nolint:forcetypeassert // We know for sure.
+}
+
+func compileRequestValidations[REQ any]() {
+	compileValidationPatterns(reflect.TypeFor[REQ](), make(map[reflect.Type]struct{}))
+}
+
+// compileValidationPatterns compiles the `regexp=` rules of the request upfront, so that a bad pattern fails at startup, rather than in a request.
+func compileValidationPatterns(typ reflect.Type, visited map[reflect.Type]struct{}) {
+	for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array || typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+	}
+	if _, found := visited[typ]; found || typ.Kind() != reflect.Struct {
+		return
+	}
+	visited[typ] = struct{}{}
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		for rule := range strings.SplitSeq(field.Tag.Get(validateTag), ",") {
+			for alternative := range strings.SplitSeq(rule, "|") {
+				pattern, found := strings.CutPrefix(alternative, "regexp=")
+				if !found {
+					continue
+				}
+				compiled, err := regexp.Compile(pattern)
+				log.Panic(errors.Wrapf(err, "invalid regexp validation for %v.%v", typ, field.Name)) //nolint:revive // .
+				compiledValidations.LoadOrStore(pattern, compiled)
+			}
+		}
+		compileValidationPatterns(field.Type, visited)
+	}
+}
+
+func (req *Request[REQ, RESP]) invalidFields() map[string]any {
+	err := structValidator().Struct(req.Data)
+	if err == nil {
+		return nil
+	}
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		log.Panic(errors.Wrapf(err, "unexpected validation failure for %[1]T", req.Data))
+	}
+	fields := make(map[string]any, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		_, namespace, _ := strings.Cut(fieldErr.Namespace(), ".")
+		fields[namespace] = validationCode(fieldErr.Tag())
+	}
+
+	return fields
+}
+
+func validationCode(tag string) string {
+	if tag == "required" {
+		return missingPropertyCode
+	}
+
+	return "INVALID_" + strings.ToUpper(tag)
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	validatedAddress struct {
+		Country string `json:"country" validate:"len=2"`
+	}
+	validatedRequest struct {
+		Nested   *validatedAddress  `json:"nested"`
+		UserID   string             `uri:"userId" required:"true"`
+		Username string             `json:"username" validate:"min=3,max=10,regexp=^[a-z]+$"`
+		Email    string             `json:"email" validate:"omitempty,email"`
+		Phone    string             `json:"phone" validate:"omitempty,phone"`
+		Kind     string             `form:"kind" validate:"oneof=a b"`
+		Tags     []string           `json:"tags" validate:"max=2,dive,uuid"`
+		Children []validatedAddress `json:"children" validate:"dive"`
+		Age      int                `json:"age" validate:"gte=18,lte=130"`
+	}
+)
+
+func TestValidate_Valid(t *testing.T) {
+	t.Parallel()
+	req := new(Request[validatedRequest, any])
+	req.Data = &validatedRequest{
+		UserID:   "bogus",
+		Username: "bogus",
+		Email:    "bogus@bogus.com",
+		Phone:    "+14155552671",
+		Kind:     "a",
+		Tags:     []string{"00000000-0000-0000-0000-000000000001"},
+		Nested:   &validatedAddress{Country: "US"},
+		Children: []validatedAddress{{Country: "RO"}},
+		Age:      18,
+	}
+	compileRequestValidations[validatedRequest]()
+	req.processTags(new(handlerOptions))
+	require.Nil(t, req.validate())
+}
+
+func TestValidate_Invalid(t *testing.T) {
+	t.Parallel()
+	req := new(Request[validatedRequest, any])
+	req.Data = &validatedRequest{
+		Username: "Bo",
+		Email:    "bogus",
+		Phone:    "123",
+		Kind:     "c",
+		Tags:     []string{"bogus"},
+		Nested:   &validatedAddress{Country: "USA"},
+		Children: []validatedAddress{{Country: "RO"}, {Country: "R"}},
+		Age:      17,
+	}
+	compileRequestValidations[validatedRequest]()
+	req.processTags(new(handlerOptions))
+	resp := req.validate()
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	assert.Equal(t, "MISSING_PROPERTIES", resp.Data.Code)
+	assert.Equal(t, map[string]any{
+		"userId":              "MISSING",
+		"username":            "INVALID_MIN",
+		"email":               "INVALID_EMAIL",
+		"phone":               "INVALID_PHONE",
+		"kind":                "INVALID_ONEOF",
+		"tags[0]":             "INVALID_UUID",
+		"nested.country":      "INVALID_LEN",
+		"children[1].country": "INVALID_LEN",
+		"age":                 "INVALID_GTE",
+	}, resp.Data.Data)
+
+	req.Data.UserID = "bogus"
+	resp = req.validate()
+	require.NotNil(t, resp)
+	assert.Equal(t, "INVALID_PROPERTIES", resp.Data.Code)
+	assert.Equal(t, "properties `age,children[1].country,email,kind,nested.country,phone,tags[0],username` are invalid", resp.Data.Error)
+}
+
+func TestCompileRequestValidations(t *testing.T) {
+	t.Parallel()
+	type (
+		invalidNested struct {
+			Code string `json:"code" validate:"regexp=^[a-z+$"`
+		}
+		invalidRequest struct {
+			Nested []*invalidNested `json:"nested" validate:"dive"`
+		}
+	)
+	assert.Panics(t, func() { compileRequestValidations[invalidRequest]() })
+	assert.Panics(t, func() {
+		RootHandler(func(context.Context, *Request[invalidRequest, any]) (*Response[any], *Response[ErrorResponse]) {
+			return nil, nil
+		})
+	})
+
+	compileRequestValidations[validatedRequest]()
+	req := new(Request[validatedRequest, any])
+	req.Data = &validatedRequest{UserID: "bogus", Username: "Bogus", Kind: "a", Age: 18}
+	req.processTags(new(handlerOptions))
+	resp := req.validate()
+	require.NotNil(t, resp)
+	assert.Equal(t, map[string]any{"username": "INVALID_REGEXP"}, resp.Data.Data)
+}
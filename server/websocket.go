@@ -0,0 +1,288 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gojson "github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+
+	"github.com/ice-blockchain/wintr/log"
+)
+
+//nolint:gochecknoglobals // It's a stateless singleton.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+
+		return origin == "" || len(cfg.CORS.AllowedOrigins) == 0 ||
+			slices.Contains(cfg.CORS.AllowedOrigins, "*") || slices.Contains(cfg.CORS.AllowedOrigins, origin)
+	},
+}
+
+// WebSocketHandler builds a route that upgrades to a websocket, after the request is processed and authorized exactly like RootHandler does.
+// The connection is closed when handleConnection returns, with an error close code if it returned an error.
+func WebSocketHandler[REQ any](
+	handleConnection func(context.Context, *Request[REQ, WebSocket], WebSocket) error, opts ...HandlerOption,
+) func(*gin.Context) {
+	options := new(handlerOptions)
+	for _, opt := range opts {
+		opt(options)
+	}
+	requestType := fmt.Sprintf("%[1]T", new(REQ))
+
+	return func(ginCtx *gin.Context) {
+		defer observeRequest(ginCtx, requestType, time.Now())
+		ctx := ginCtx.Request.Context()
+		req := new(Request[REQ, WebSocket]).init(ginCtx)
+		if err := req.accept(ctx, options); err != nil {
+			log.Error(errors.Wrap(err.Data.InternalErr(), "websocket endpoint rejected"), fmt.Sprintf("%[1]T", req.Data), req, "Response", err)
+			for k, v := range err.Headers {
+				ginCtx.Header(k, v)
+			}
+			ginCtx.JSON(err.Code, localize(ctx, ginCtx.GetHeader(languageHeader), err.Data))
+
+			return
+		}
+		sockets, ok := ctx.Value(webSocketsCtxValueKey).(*webSockets)
+		if !ok {
+			sockets = newWebSockets()
+		}
+		conn, err := upgrader.Upgrade(ginCtx.Writer, ginCtx.Request, nil)
+		if err != nil {
+			log.Error(errors.Wrapf(err, "websocket upgrade failed for %v", requestType))
+
+			return
+		}
+		ws := newWebSocket(conn)
+		go ws.write()
+		if !sockets.add(ws) {
+			ws.closeWith(websocket.CloseGoingAway)
+			<-ws.done
+
+			return
+		}
+		defer sockets.remove(ws)
+		wsCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go ws.read(cancel)
+		if err = handleConnection(wsCtx, req, ws); err != nil && !errors.Is(err, ErrWebSocketClosed) && !errors.Is(err, wsCtx.Err()) {
+			log.Error(errors.Wrapf(err, "websocket handler failed for %v", requestType), "userID", req.AuthenticatedUser.UserID)
+			ws.closeWith(websocket.CloseInternalServerErr)
+		}
+		ws.closeWith(websocket.CloseNormalClosure)
+		<-ws.done
+	}
+}
+
+func (req *Request[REQ, RESP]) accept(ctx context.Context, options *handlerOptions) *Response[ErrorResponse] {
+	if err := req.processRequest(options); err != nil {
+		return err
+	}
+	if err := req.authorize(ctx); err != nil {
+		return err
+	}
+	if err := req.checkPolicies(ctx); err != nil {
+		return err
+	}
+
+	return req.checkRateLimit(ctx)
+}
+
+func newWebSocket(conn *websocket.Conn) *webSocket {
+	sendBufferSize := cfg.WebSockets.SendBufferSize
+	if sendBufferSize <= 0 {
+		sendBufferSize = defaultWebSocketSendBufferSize
+	}
+
+	return &webSocket{
+		conn:      conn,
+		send:      make(chan []byte, sendBufferSize),
+		received:  make(chan []byte, webSocketReceiveBufferSize),
+		closed:    make(chan struct{}),
+		done:      make(chan struct{}),
+		closeCode: websocket.CloseNormalClosure,
+	}
+}
+
+func (ws *webSocket) Send(ctx context.Context, message any) error {
+	data, err := gojson.MarshalContext(ctx, message)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode %#v", message)
+	}
+	select {
+	case <-ws.closed:
+		return ErrWebSocketClosed
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "send buffer is full")
+	case ws.send <- data:
+		return nil
+	}
+}
+
+func (ws *webSocket) Receive(ctx context.Context, message any) error {
+	select {
+	case <-ws.closed:
+		return ErrWebSocketClosed
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "context failed")
+	case data := <-ws.received:
+		return errors.Wrapf(gojson.UnmarshalContext(ctx, data, message), "failed to decode %v", string(data))
+	}
+}
+
+func (ws *webSocket) Close() error {
+	ws.closeWith(websocket.CloseNormalClosure)
+
+	return nil
+}
+
+func (ws *webSocket) closeWith(code int) {
+	ws.closeOnce.Do(func() {
+		ws.closeCode = code
+		close(ws.closed)
+	})
+}
+
+func (ws *webSocket) read(cancel context.CancelFunc) {
+	defer cancel()
+	defer ws.closeWith(websocket.CloseNormalClosure)
+	maxMessageSize, pongTimeout := cfg.WebSockets.MaxMessageSize, cfg.WebSockets.PongTimeout
+	if maxMessageSize <= 0 {
+		maxMessageSize = defaultWebSocketMaxMessageSize
+	}
+	if pongTimeout <= 0 {
+		pongTimeout = defaultWebSocketPongTimeout
+	}
+	ws.conn.SetReadLimit(maxMessageSize)
+	ws.conn.SetPongHandler(func(string) error {
+		return errors.Wrap(ws.conn.SetReadDeadline(time.Now().Add(pongTimeout)), "failed to extend read deadline")
+	})
+	for {
+		if err := ws.conn.SetReadDeadline(time.Now().Add(pongTimeout)); err != nil {
+			return
+		}
+		_, data, err := ws.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				log.Error(errors.Wrap(err, "websocket read failed"))
+			}
+
+			return
+		}
+		select {
+		case <-ws.closed:
+			return
+		case ws.received <- data:
+		}
+	}
+}
+
+func (ws *webSocket) write() {
+	defer close(ws.done)
+	defer func() {
+		log.Error(errors.Wrap(ws.conn.Close(), "failed to close websocket"))
+	}()
+	pingInterval, writeTimeout := cfg.WebSockets.PingInterval, cfg.WebSockets.WriteTimeout
+	if pingInterval <= 0 {
+		pingInterval = defaultWebSocketPingInterval
+	}
+	if writeTimeout <= 0 {
+		writeTimeout = defaultWebSocketWriteTimeout
+	}
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	writeMessage := func(data []byte) bool {
+		if err := ws.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+			return false
+		}
+
+		return ws.conn.WriteMessage(websocket.TextMessage, data) == nil
+	}
+	for {
+		select {
+		case data := <-ws.send:
+			if !writeMessage(data) {
+				ws.closeWith(websocket.CloseAbnormalClosure)
+
+				return
+			}
+		case <-ticker.C:
+			if err := ws.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				ws.closeWith(websocket.CloseAbnormalClosure)
+
+				return
+			}
+		case <-ws.closed:
+			for flushed := false; !flushed; {
+				select {
+				case data := <-ws.send:
+					flushed = !writeMessage(data)
+				default:
+					flushed = true
+				}
+			}
+			closeMessage := websocket.FormatCloseMessage(ws.closeCode, "")
+			_ = ws.conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(writeTimeout)) //nolint:errcheck // Best effort.
+
+			return
+		}
+	}
+}
+
+func newWebSockets() *webSockets {
+	return &webSockets{sockets: make(map[*webSocket]struct{})}
+}
+
+func (w *webSockets) add(ws *webSocket) bool {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	if w.closing {
+		return false
+	}
+	w.sockets[ws] = struct{}{}
+	w.wg.Add(1)
+	webSocketConnections.Inc()
+
+	return true
+}
+
+func (w *webSockets) remove(ws *webSocket) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	delete(w.sockets, ws)
+	webSocketConnections.Dec()
+	w.wg.Done()
+}
+
+// closeAll closes every open websocket with `1001 going away` and waits for their handlers to return.
+func (w *webSockets) closeAll(ctx context.Context) {
+	w.mx.Lock()
+	w.closing = true
+	count := len(w.sockets)
+	for ws := range w.sockets {
+		ws.closeWith(websocket.CloseGoingAway)
+	}
+	w.mx.Unlock()
+	if count == 0 {
+		return
+	}
+	log.Info(fmt.Sprintf("closing %v websockets...", count))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.wg.Wait()
+	}()
+	select {
+	case <-ctx.Done():
+		log.Error(errors.Wrap(ctx.Err(), "websockets did not close in time"))
+	case <-done:
+	}
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ice-blockchain/wintr/auth"
+)
+
+type (
+	webSocketTestAuth struct {
+		auth.Client
+	}
+	webSocketTestRequest struct {
+		Topic string `form:"topic" json:"-" required:"true"`
+	}
+	webSocketTestMessage struct {
+		UserID string `json:"userId,omitempty"`
+		Topic  string `json:"topic,omitempty"`
+		Text   string `json:"text,omitempty"`
+	}
+)
+
+func (*webSocketTestAuth) VerifyToken(_ context.Context, token string) (*auth.Token, error) {
+	if token != "valid" {
+		return nil, errors.New("invalid token")
+	}
+
+	return &auth.Token{UserID: "bogus"}, nil
+}
+
+func (*webSocketTestAuth) ModifyTokenWithMetadataContext(_ context.Context, token *auth.Token, _ string) (*auth.Token, error) {
+	return token, nil
+}
+
+func TestWebSocketHandler(t *testing.T) {
+	t.Parallel()
+	sockets := newWebSockets()
+	router := gin.New()
+	router.Use(func(ginCtx *gin.Context) {
+		ctx := context.WithValue(ginCtx.Request.Context(), authClientCtxValueKey, auth.Client(new(webSocketTestAuth))) //nolint:staticcheck,revive // .
+		ginCtx.Request = ginCtx.Request.WithContext(context.WithValue(ctx, webSocketsCtxValueKey, sockets))            //nolint:staticcheck,revive // .
+	})
+	router.GET("ws", WebSocketHandler(func(ctx context.Context, req *Request[webSocketTestRequest, WebSocket], ws WebSocket) error {
+		for {
+			msg := new(webSocketTestMessage)
+			if err := ws.Receive(ctx, msg); err != nil {
+				return err
+			}
+			if err := ws.Send(ctx, &webSocketTestMessage{UserID: req.AuthenticatedUser.UserID, Topic: req.Data.Topic, Text: msg.Text}); err != nil {
+				return err
+			}
+		}
+	}))
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	_, resp, err := websocket.DefaultDialer.Dial(url+"?topic=balance", http.Header{"Authorization": {"Bearer invalid"}})
+	require.ErrorIs(t, err, websocket.ErrBadHandshake)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url+"?topic=balance", http.Header{"Authorization": {"Bearer valid"}})
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	defer conn.Close()
+	require.NoError(t, conn.WriteJSON(&webSocketTestMessage{Text: "hello"}))
+	received := new(webSocketTestMessage)
+	require.NoError(t, conn.ReadJSON(received))
+	assert.Equal(t, &webSocketTestMessage{UserID: "bogus", Topic: "balance", Text: "hello"}, received)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	sockets.closeAll(ctx)
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+}
@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Public API.
+
+const (
+	SpanKindInternal = trace.SpanKindInternal
+	SpanKindServer   = trace.SpanKindServer
+	SpanKindClient   = trace.SpanKindClient
+	SpanKindProducer = trace.SpanKindProducer
+	SpanKindConsumer = trace.SpanKindConsumer
+)
+
+type (
+	SpanKind = trace.SpanKind
+	Span     = trace.Span
+	// Shutdown flushes all the pending spans and stops the exporting of new ones.
+	Shutdown func(ctx context.Context) error
+)
+
+// Private API.
+
+const (
+	instrumentationName = "github.com/ice-blockchain/wintr"
+)
+
+type (
+	config struct {
+		WintrTracing struct {
+			Endpoint    string  `yaml:"endpoint" mapstructure:"endpoint"`
+			SampleRatio float64 `yaml:"sampleRatio" mapstructure:"sampleRatio"`
+			Insecure    bool    `yaml:"insecure" mapstructure:"insecure"`
+		} `yaml:"wintr/tracing" mapstructure:"wintr/tracing"` //nolint:tagliatelle // Nope.
+	}
+)
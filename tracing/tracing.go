@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	appcfg "github.com/ice-blockchain/wintr/config"
+	"github.com/ice-blockchain/wintr/log"
+)
+
+//nolint:gochecknoinits // Because we want to set it up globally.
+func init() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// MustInit starts exporting the spans of the whole process to the configured OTLP/HTTP endpoint.
+// If there's no endpoint configured, spans are still propagated, but never exported.
+func MustInit(ctx context.Context, applicationYAMLKey string) Shutdown {
+	var cfg config
+	appcfg.MustLoadFromKey(applicationYAMLKey, &cfg)
+	cfg.setEndpoint(applicationYAMLKey)
+	if cfg.WintrTracing.Endpoint == "" {
+		log.Info("tracing is not initialized, because it is not configured")
+
+		return func(context.Context) error { return nil }
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.WintrTracing.Endpoint)}
+	if cfg.WintrTracing.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	log.Panic(errors.Wrapf(err, "[%v] failed to build otlp trace exporter", applicationYAMLKey)) //nolint:revive // That's intended.
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", applicationYAMLKey)))
+	log.Panic(errors.Wrapf(err, "[%v] failed to build tracing resource", applicationYAMLKey))
+	sampleRatio := cfg.WintrTracing.SampleRatio
+	if sampleRatio == 0 {
+		sampleRatio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		return errors.Wrap(provider.Shutdown(ctx), "failed to shutdown tracer provider")
+	}
+}
+
+func Start(ctx context.Context, name string, kind SpanKind, attrs ...attribute.KeyValue) (context.Context, Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...)) //nolint:spancheck // It's ended by the caller.
+}
+
+func End(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject writes the span context of ctx into the carrier, i.e. into message headers.
+func Inject(ctx context.Context, carrier map[string]string) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(carrier))
+}
+
+// Extract reads the remote span context from the carrier, i.e. from message headers.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// ExtractHTTP reads the remote span context from the W3C `traceparent`/`tracestate`/`baggage` http headers.
+func ExtractHTTP(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+func (cfg *config) setEndpoint(applicationYAMLKey string) {
+	if cfg.WintrTracing.Endpoint == "" {
+		module := strings.ToUpper(strings.ReplaceAll(strings.ReplaceAll(applicationYAMLKey, "-", "_"), "/", "_"))
+		cfg.WintrTracing.Endpoint = os.Getenv(module + "_TRACING_ENDPOINT")
+		if cfg.WintrTracing.Endpoint == "" {
+			cfg.WintrTracing.Endpoint = os.Getenv("TRACING_ENDPOINT")
+		}
+	}
+}
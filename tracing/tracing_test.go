@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: ice License 1.0
+
+package tracing
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestPropagation(t *testing.T) { //nolint:paralleltest // It changes the global tracer provider.
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	ctx, parent := Start(t.Context(), "parent", SpanKindServer)
+	headers := make(map[string]string)
+	Inject(ctx, headers)
+	require.NotEmpty(t, headers["traceparent"])
+	End(parent, nil)
+
+	_, child := Start(Extract(t.Context(), headers), "child", SpanKindConsumer)
+	End(child, errors.New("bogus"))
+
+	httpHeaders := make(http.Header)
+	httpHeaders.Set("traceparent", headers["traceparent"])
+	_, httpChild := Start(ExtractHTTP(t.Context(), httpHeaders), "httpChild", SpanKindServer)
+	End(httpChild, nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	assert.Equal(t, spans[0].SpanContext().TraceID(), spans[1].SpanContext().TraceID())
+	assert.Equal(t, spans[0].SpanContext().SpanID(), spans[1].Parent().SpanID())
+	assert.Equal(t, spans[0].SpanContext().SpanID(), spans[2].Parent().SpanID())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}